@@ -1,101 +1,174 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
-	"log"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func makeCallbackData(command string, mHash string) string {
-	return command + CallbackDataDelimiter + mHash
+// issued time of buttons is counted from it
+var callbackEpoch = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// callback data is "command|payload|user|issued|signature". user is base36 id of the only
+// user allowed to press the button (0 for anyone), issued is base36 minutes since callbackEpoch.
+// Signature is a truncated HMAC of the rest, so clients can't forge or alter buttons.
+// Telegram rejects buttons with more than MaxCallbackDataLength bytes of data
+func makeCallbackData(command string, payload string, userID int) (data string, err error) {
+	data = strings.Join([]string{command, payload, strconv.FormatInt(int64(userID), 36),
+		strconv.FormatInt(callbackMinutes(time.Now()), 36)}, CallbackDataDelimiter)
+	data += CallbackDataDelimiter + callbackSignature(data)
+	if len(data) > MaxCallbackDataLength {
+		err = CallbackDataTooLong
+		return
+	}
+	return
 }
 
-func parseCallbackData(data string) (command string, mHash string, err error) {
-	parts := strings.SplitN(data, CallbackDataDelimiter, 2)
-	if len(parts) != 2 {
+// minutes keep issued time short, buttons may expire up to a minute early
+func callbackMinutes(t time.Time) int64 {
+	return int64(t.Sub(callbackEpoch) / time.Minute)
+}
+
+func parseCallbackData(data string, userID int) (command string, payload string, err error) {
+	parts := strings.Split(data, CallbackDataDelimiter)
+	if len(parts) != 5 {
+		err = WrongCallbackDataFormat
+		return
+	}
+	signed := strings.Join(parts[:4], CallbackDataDelimiter)
+	if !hmac.Equal([]byte(parts[4]), []byte(callbackSignature(signed))) {
+		err = ForgedCallbackData
+		return
+	}
+	boundUser, err := strconv.ParseInt(parts[2], 36, 64)
+	if err != nil {
 		err = WrongCallbackDataFormat
 		return
 	}
+	issued, err := strconv.ParseInt(parts[3], 36, 64)
+	if err != nil {
+		err = WrongCallbackDataFormat
+		return
+	}
+	issuedAt := callbackEpoch.Add(time.Duration(issued) * time.Minute)
+	if time.Since(issuedAt) > time.Duration(currentConfig().CallbackTTL)*time.Second {
+		err = ExpiredCallbackData
+		return
+	}
+	if boundUser != 0 && boundUser != int64(userID) {
+		err = ForeignCallbackData
+		return
+	}
 	command = parts[0]
-	mHash = parts[1]
+	payload = parts[1]
 	return
 }
 
-func processQuestionCallback(bot *tgbotapi.BotAPI, question *Question, store *SQLStore) (reply string, err error) {
+func callbackSignature(data string) string {
+	mac := hmac.New(sha256.New, callbackKey())
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSignatureSize])
+}
+
+// CallbackSecret from config, without it the key is derived from the bot token
+func callbackKey() []byte {
+	if currentConfig().CallbackSecret != "" {
+		return []byte(currentConfig().CallbackSecret)
+	}
+	key := sha256.Sum256([]byte("callback|" + currentConfig().TelegramBotToken))
+	return key[:]
+}
+
+func processQuestionCallback(bot *tgbotapi.BotAPI, question *Question, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	err = resolveReceiver(store, question.Rec)
+	if err != nil {
+		logger.Error("Error resolving receiver", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
 	question.QuestionID, err = store.addQuestion(question)
 	if err != nil {
-		log.Printf("Error adding question database: %v", err)
-		reply = "Ошибка доступа к базе данных"
+		logger.Error("Error adding question", "err", err)
+		reply = tr(lang, "error.db")
 		return
 	}
-	reply = "Вопрос успешно добавлен"
+	reply = tr(lang, "question.added")
 
-	var chatID int64
-	if question.Rec.User == AllGroupName {
-		chatID = AllGroupChatID
-	} else {
-		chatID, err = store.getUserChatID(question.Rec.User)
-		if err == sql.ErrNoRows {
-			log.Printf("Don't know user personal chat adress: %v", err)
-			return
-		} else if err != nil {
-			log.Printf("Error accesing sql database : %v", err)
-			return
-		}
+	chatID, err := receiverNotificationChat(store, question.Rec)
+	if err == UnknownUserChat {
+		logger.Info("Personal chat of the user is unknown", "err", err)
+		return
+	} else if err != nil {
+		logger.Error("Error accessing database", "err", err)
+		return
 	}
 
-	msg := makeAskedPersonNotification(question, chatID)
-	_, err = bot.Send(msg)
+	msg := makeAskedPersonNotification(store, question, chatID, chatLang(store, question.Rec.ID))
+	err = outbox.send(bot, msg, nil, logger)
 
 	if err != nil {
-		log.Printf("Error sending notification")
+		logger.Error("Error sending notification", "err", err)
 		return
 	}
 
 	return
 }
 
-func processAnswerCallback(bot *tgbotapi.BotAPI, answer *Answer, store *SQLStore) (reply string, err error) {
+func processAnswerCallback(bot *tgbotapi.BotAPI, answer *Answer, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
 
 	question, err := store.getQuestion(answer.QuestionID)
 	if err == QuestionDoesntExist {
-		reply = fmt.Sprintf("Вопроса с id %d не существует", answer.QuestionID)
+		reply = tr(lang, "question.not_found_id", answer.QuestionID)
+		return
+	} else if err != nil {
+		reply = tr(lang, "error.db")
+		return
 	}
 
-
 	answer.AnswerID, err = store.addAnswer(answer)
 	if err != nil {
-		reply = "Ошибка доступа к базе данных"
+		reply = tr(lang, "error.db")
 		return
 	}
 
 	var chatID int64
 
-	chatID, err = store.getUserChatID(question.User)
-	if err == sql.ErrNoRows {
-		log.Printf("Don't know user personal chat adress: %v", err)
+	chatID, err = store.getUserChatID(question.UserID)
+	if err == UnknownUserChat {
+		logger.Info("Personal chat of the user is unknown", "err", err)
 		return
 	} else if err != nil {
-		log.Printf("Error accesing sql database : %v", err)
+		logger.Error("Error accessing database", "err", err)
 		return
 	}
 
-	msg := makeAskerNotification(answer, question, chatID)
-	_, err = bot.Send(msg)
+	msg := makeAskerNotification(store, answer, question, chatID, chatLang(store, chatID))
+	err = outbox.send(bot, msg, nil, logger)
 
 	if err != nil {
-		log.Printf("Error sending notification")
+		logger.Error("Error sending notification", "err", err)
 		return
 	}
 
-	msg = makeAskerNotification(answer, question, AllGroupChatID)
-	_, err = bot.Send(msg)
+	if !question.Rec.IsGroup() {
+		return
+	}
+	chatID, err = receiverNotificationChat(store, question.Rec)
+	if err != nil {
+		logger.Error("Error accessing database", "err", err)
+		return
+	}
+	msg = makeAskerNotification(store, answer, question, chatID, chatLang(store, question.Rec.ID))
+	err = outbox.send(bot, msg, nil, logger)
 
 	if err != nil {
-		log.Printf("Error sending notification")
+		logger.Error("Error sending notification", "err", err)
 		return
 	}
 
@@ -103,107 +176,168 @@ func processAnswerCallback(bot *tgbotapi.BotAPI, answer *Answer, store *SQLStore
 
 }
 
-func proccessCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, store *SQLStore) (reply string) {
-	log.Println(query.InlineMessageID)
-	log.Println(query.Message)
+func proccessCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, store Store, logger *Logger) (reply string) {
+	logger.Info("Callback received")
 
-	command, mHash, err := parseCallbackData(query.Data)
+	lang := userLang(store, query.From, nil)
+	command, mHash, err := parseCallbackData(query.Data, query.From.ID)
 	if err != nil {
-		log.Printf("Error processing callback data: %v", err)
-		reply = "Ошибка приложения"
+		logger.Warn("Rejected callback data", "data", RedactedText(query.Data), "err", err)
+		switch err {
+		case ForgedCallbackData:
+			reply = tr(lang, "callback.forged")
+		case ExpiredCallbackData:
+			reply = tr(lang, "callback.expired")
+		case ForeignCallbackData:
+			reply = tr(lang, "callback.foreign")
+		default:
+			reply = tr(lang, "error.app")
+		}
 		return
 	}
 
 	switch command {
 	case CallbackCancelCommand:
-			messagePull.Delete(mHash)
-			reply = "Команда успешно отменена"
-			return
+			messagePull.Delete(mHash, logger)
+			reply = tr(lang, "callback.cancelled")
 	case CallbackAddCommand:
-			reply, err = processCallbackAddComand(bot, store, mHash)
-			return
+			reply, err = processCallbackAddComand(bot, store, mHash, lang, logger)
 	case CallbackCloseCommand:
-			reply, err = processCallbackCloseCommand(bot, store, mHash, query.From.UserName)
-			return
+			reply, err = processCallbackCloseCommand(bot, store, mHash, query.From.ID, lang, logger)
+	case CallbackOpenCommand:
+			reply, err = processCallbackOpenCommand(bot, store, mHash, query.From.ID, lang, logger)
 	default:
-		reply = "Ошибка приложения"
+		reply = tr(lang, "error.app")
 		err = WrongValue
 	}
+	if err != nil {
+		logger.Info("Callback failed", "err", err)
+	}
 	return
 }
 
-func processCallbackCloseCommand(bot *tgbotapi.BotAPI, store *SQLStore, mHash string,
-	user string) (reply string, err error) {
+func processCallbackCloseCommand(bot *tgbotapi.BotAPI, store Store, mHash string,
+	userID int, lang Lang, logger *Logger) (reply string, err error) {
 	qID, err := strconv.Atoi(mHash)
 	if err != nil {
-		log.Printf("Error while converting qID: %v", err)
-		reply = "Ошибка приложения"
+		logger.Warn("Wrong question id in callback data", "err", err)
+		reply = tr(lang, "error.app")
 		return
 	}
 
 	question, err := store.getQuestion(qID)
-	if err == QuestionDoesntExist {
-		log.Printf("Error getting question from database: %v", err)
-		reply = "Ошибка приложения"
+	if err != nil {
+		logger.Error("Error getting question", "question_id", qID, "err", err)
+		reply = tr(lang, "error.app")
 		return
 	}
 
-	if question.User != user && question.Rec.User != user && !inGroup(appConfig.Admins, user) {
-		reply = "Недостаточно прав"
+	if !authorizeCloseQuestion(store, userID, question, logger) {
+		reply = tr(lang, "error.permissions")
 		return
 	}
 
 	err = store.closeQuestion(qID)
 	if err != nil {
-		log.Printf("Error deleting question from database: %v", err)
-		reply = "Ошибка приложения"
+		logger.Error("Error closing question", "question_id", qID, "err", err)
+		reply = tr(lang, "error.app")
 		return
 	}
-	reply = "Вопрос успешно закрыт"
+	reply = tr(lang, "question.closed")
 
-	notificationText := fmt.Sprintf("Ваш вопрос [%d] был закрыт: \n%s",
-		qID, question.Text)
+	notificationText := tr(chatLang(store, question.ChatID), "notify.closed", qID, question.Text)
 
-	log.Println(question.ChatID)
 	err = sendSimpleNotification(bot, notificationText, question.ChatID)
 	if err != nil {
-		log.Printf("Error sending notification")
+		logger.Error("Error sending notification", "err", err)
+	}
+	return
+}
+
+func processCallbackOpenCommand(bot *tgbotapi.BotAPI, store Store, mHash string,
+	userID int, lang Lang, logger *Logger) (reply string, err error) {
+	qID, err := strconv.Atoi(mHash)
+	if err != nil {
+		logger.Warn("Wrong question id in callback data", "err", err)
+		reply = tr(lang, "error.app")
+		return
+	}
+
+	question, err := store.getQuestion(qID)
+	if err != nil {
+		logger.Error("Error getting question", "question_id", qID, "err", err)
+		reply = tr(lang, "error.app")
+		return
+	}
+
+	if !authorizeCloseQuestion(store, userID, question, logger) {
+		reply = tr(lang, "error.permissions")
+		return
+	}
+
+	if !question.IsClosed {
+		reply = tr(lang, "question.already_open")
+		return
+	}
+
+	err = store.openQuestion(qID)
+	if err != nil {
+		logger.Error("Error opening question", "question_id", qID, "err", err)
+		reply = tr(lang, "error.app")
+		return
+	}
+	reply = tr(lang, "question.reopened")
+
+	if question.UserID == userID {
+		return
+	}
+
+	chatID, err := store.getUserChatID(question.UserID)
+	if err == UnknownUserChat {
+		logger.Info("Personal chat of the user is unknown", "err", err)
+		err = nil
+		return
+	} else if err != nil {
+		logger.Error("Error accessing database", "err", err)
+		return
+	}
+
+	notificationText := tr(chatLang(store, chatID), "notify.reopened", qID, question.Text)
+	err = sendSimpleNotification(bot, notificationText, chatID)
+	if err != nil {
+		logger.Error("Error sending notification", "err", err)
 	}
 	return
 }
 
 func sendSimpleNotification(bot *tgbotapi.BotAPI, messageText string, chatID int64) (err error) {
 	msg := tgbotapi.NewMessage(chatID, messageText)
-	resMsg, err := bot.Send(msg)
+	err = sendTemporary(bot, msg, currentConfig().NotificationsTimeToDelete, logger)
 	if err != nil {
-		log.Printf("Error sending notification: %v", err)
 		return
 	}
-	config := tgbotapi.DeleteMessageConfig{
-		MessageID: resMsg.MessageID,
-		ChatID:    resMsg.Chat.ID,
-	}
-	go messageDeleter(bot, config, appConfig.NotificationsTimeToDelete)
 	return
 }
 
-func processCallbackAddComand(bot *tgbotapi.BotAPI, store *SQLStore, messageHash string) (reply string, err error) {
-	m, err := messagePull.getMessage(messageHash)
+func processCallbackAddComand(bot *tgbotapi.BotAPI, store Store, messageHash string,
+	lang Lang, logger *Logger) (reply string, err error) {
+	// a second press of the button finds nothing, so the message is added once
+	m, err := messagePull.takeMessage(messageHash)
 	if err != nil {
-		log.Printf("Access to deleted question: %v", err)
-		reply = "К сожалению, ваш вопрос был удален из временной базы"
+		logger.Info("Confirmed message is gone", "err", err)
+		reply = tr(lang, "callback.pending_gone")
 		return
 	}
 
 	switch m.(type) {
 	case *Question:
-		log.Println("Adding question")
+		logger.Debug("Adding question")
 		question := m.(*Question)
-		reply, err = processQuestionCallback(bot, question, store)
+		reply, err = processQuestionCallback(bot, question, store, lang, logger)
 	case *Answer:
-		log.Println("Adding answer")
+		logger.Debug("Adding answer")
 		answer := m.(*Answer)
-		reply, err = processAnswerCallback(bot, answer, store)
+		reply, err = processAnswerCallback(bot, answer, store, lang, logger)
 	}
 	return
 }
@@ -214,9 +348,9 @@ func sendCallbackNotification(bot *tgbotapi.BotAPI, callbackID string, message_t
 		Text:            message_text,
 	}
 
-	_, err = bot.AnswerCallbackQuery(config)
-	if err != nil {
+	err = outbox.call(func() (err error) {
+		_, err = bot.AnswerCallbackQuery(config)
 		return
-	}
+	})
 	return
 }
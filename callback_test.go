@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// callback data issued at the time, signed like makeCallbackData does
+func signedCallbackData(command string, payload string, userID int, issued time.Time) string {
+	data := strings.Join([]string{command, payload, strconv.FormatInt(int64(userID), 36),
+		strconv.FormatInt(callbackMinutes(issued), 36)}, CallbackDataDelimiter)
+	return data + CallbackDataDelimiter + callbackSignature(data)
+}
+
+func TestCallbackData(t *testing.T) {
+	old := currentConfig()
+	defer setAppConfig(old)
+	config := defaultAppConfig()
+	config.TelegramBotToken = "123:token"
+	setAppConfig(config)
+
+	const userID = 1234567890
+	tag := GetMD5Hash("question")
+	fresh, err := makeCallbackData(CallbackAddCommand, tag, userID)
+	if err != nil {
+		t.Fatalf("makeCallbackData with a question tag: %v", err)
+	}
+	if len(fresh) > MaxCallbackDataLength {
+		t.Fatalf("callback data %q is %d bytes, telegram accepts %d", fresh, len(fresh), MaxCallbackDataLength)
+	}
+	anyone, err := makeCallbackData(CallbackCloseCommand, "12", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := signedCallbackData(CallbackAddCommand, tag, userID,
+		time.Now().Add(-time.Duration(config.CallbackTTL+120)*time.Second))
+	tampered := strings.Replace(fresh, tag, GetMD5Hash("other question"), 1)
+	otherSignature := fresh[:len(fresh)-1] + "A"
+	if otherSignature == fresh {
+		otherSignature = fresh[:len(fresh)-1] + "B"
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		userID  int
+		command string
+		payload string
+		err     error
+	}{
+		{"round trip", fresh, userID, CallbackAddCommand, tag, nil},
+		{"button for anyone", anyone, 42, CallbackCloseCommand, "12", nil},
+		{"tampered payload", tampered, userID, "", "", ForgedCallbackData},
+		{"tampered signature", otherSignature, userID, "", "", ForgedCallbackData},
+		{"another user", fresh, 42, "", "", ForeignCallbackData},
+		{"expired", expired, userID, "", "", ExpiredCallbackData},
+		{"old format", CallbackAddCommand + CallbackDataDelimiter + tag, userID, "", "", WrongCallbackDataFormat},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			command, payload, err := parseCallbackData(test.data, test.userID)
+			if err != test.err {
+				t.Fatalf("parseCallbackData(%q) got error %v, want %v", test.data, err, test.err)
+			}
+			if err == nil && (command != test.command || payload != test.payload) {
+				t.Errorf("parseCallbackData(%q) = %q, %q, want %q, %q",
+					test.data, command, payload, test.command, test.payload)
+			}
+		})
+	}
+
+	_, err = makeCallbackData(CallbackAddCommand, tag+tag, userID)
+	if err != CallbackDataTooLong {
+		t.Errorf("makeCallbackData with a long payload got error %v, want %v", err, CallbackDataTooLong)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ChatAdminsSync reads administrators of groups' telegram chats into Group.ChatAdmins,
+// they are admins of their group. Between reads chat_member updates keep the lists fresh
+type ChatAdminsSync struct {
+	bot      *tgbotapi.BotAPI
+	store    Store
+	interval time.Duration // 0 for no reads after the first one
+	logger   *Logger
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var chatAdminsSync *ChatAdminsSync
+
+func NewChatAdminsSync(bot *tgbotapi.BotAPI, store Store, intervalSeconds int, logger *Logger) (s *ChatAdminsSync) {
+	s = &ChatAdminsSync{
+		bot:      bot,
+		store:    store,
+		interval: time.Duration(intervalSeconds) * time.Second,
+		logger:   logger.With("component", "chat_admins"),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	return
+}
+
+func (s *ChatAdminsSync) init() {
+	go s.worker()
+}
+
+func (s *ChatAdminsSync) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *ChatAdminsSync) worker() {
+	defer close(s.done)
+	// admins could change while the bot was down
+	s.syncAll()
+	if s.interval == 0 {
+		<-s.stop
+		return
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.syncAll()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *ChatAdminsSync) syncAll() {
+	groups, err := s.store.findGroups()
+	if err != nil {
+		s.logger.Error("Error listing groups", "err", err)
+		return
+	}
+	changed := false
+	for _, g := range groups {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		groupChanged, err := syncGroupAdmins(s.bot, s.store, g, s.logger)
+		if err != nil {
+			// the bot may be not in the chat or the group may be gone
+			s.logger.Warn("Error getting administrators", "group_chat_id", g.ChatID, "err", err)
+			continue
+		}
+		changed = changed || groupChanged
+	}
+	if changed {
+		syncBotCommands(s.bot, s.store, s.logger)
+	}
+}
+
+// reads administrators of the group's chat, bots are skipped
+func syncGroupAdmins(bot *tgbotapi.BotAPI, store Store, g *Group, logger *Logger) (changed bool, err error) {
+	members, err := bot.GetChatAdministrators(tgbotapi.ChatConfig{ChatID: g.ChatID})
+	if err != nil {
+		return
+	}
+	admins := []int{}
+	for _, member := range members {
+		if member.User != nil && !member.User.IsBot {
+			admins = append(admins, member.User.ID)
+		}
+	}
+	changed, err = saveChatAdmins(store, g, admins, logger)
+	return
+}
+
+func saveChatAdmins(store Store, g *Group, admins []int, logger *Logger) (changed bool, err error) {
+	sort.Ints(admins)
+	old := append([]int{}, g.ChatAdmins...)
+	sort.Ints(old)
+	if reflect.DeepEqual(old, admins) {
+		return
+	}
+	err = store.setGroupChatAdmins(g.ChatID, admins)
+	if err != nil {
+		return
+	}
+	changed = true
+	logger.Info("Administrators of the group changed", "group", g.Name, "group_chat_id", g.ChatID,
+		"old", old, "new", admins)
+	return
+}
+
+func isChatAdminStatus(member tgbotapi.ChatMember) bool {
+	return member.IsAdministrator() || member.IsCreator()
+}
+
+// promotions and demotions in group chats change admins of the group,
+// when the bot itself becomes an administrator it reads all of them
+func processChatMemberUpdate(bot *tgbotapi.BotAPI, update *Update, store Store, logger *Logger) {
+	if update.MyChatMember != nil {
+		u := update.MyChatMember
+		logger.Info("Bot status in the chat changed", "old_status", u.OldChatMember.Status,
+			"new_status", u.NewChatMember.Status)
+		if !isChatAdminStatus(u.NewChatMember) {
+			return
+		}
+		g, err := store.getGroup(u.Chat.ID)
+		if err != nil {
+			return
+		}
+		changed, err := syncGroupAdmins(bot, store, g, logger)
+		if err != nil {
+			logger.Warn("Error getting administrators", "err", err)
+			return
+		}
+		if changed {
+			go syncBotCommands(bot, store, logger)
+		}
+		return
+	}
+
+	u := update.ChatMember
+	member := u.NewChatMember.User
+	if member == nil || member.IsBot || isChatAdminStatus(u.OldChatMember) == isChatAdminStatus(u.NewChatMember) {
+		return
+	}
+	err := rememberUser(store, member, nil)
+	if err != nil {
+		logger.Error("Error saving user", "member_id", member.ID, "err", err)
+	}
+	g, err := store.getGroup(u.Chat.ID)
+	if err != nil {
+		if err != GroupDoesntExist {
+			logger.Error("Error getting group", "err", err)
+		}
+		return
+	}
+	admins := []int{}
+	for _, id := range g.ChatAdmins {
+		if id != member.ID {
+			admins = append(admins, id)
+		}
+	}
+	if isChatAdminStatus(u.NewChatMember) {
+		admins = append(admins, member.ID)
+	}
+	changed, err := saveChatAdmins(store, g, admins, logger)
+	if err != nil {
+		logger.Error("Error saving administrators", "err", err)
+		return
+	}
+	if changed {
+		go syncBotCommands(bot, store, logger)
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
-	"log"
 	"strings"
 )
 
@@ -12,13 +11,13 @@ func isUserChat(chat *tgbotapi.Chat) (b bool) {
 	return
 }
 
-func processCommand(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store *SQLStore) (err error) {
+func processCommand(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store Store, config *AppConfig,
+	logger *Logger) (err error) {
 
-	log.Printf("[%s] %s", update.Message.From.UserName, update.Message.Text)
+	logger.Info("Command received", "from", update.Message.From.UserName, "text", RedactedText(update.Message.Text))
 
-	reply, err := commandExec(bot, update, store)
+	reply, err := commandExec(bot, update, store, logger)
 
-	log.Println(err)
 	deleteConfig := tgbotapi.DeleteMessageConfig{
 		ChatID:    update.Message.Chat.ID,
 		MessageID: update.Message.MessageID,
@@ -26,289 +25,329 @@ func processCommand(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store *SQLSto
 
 	var timeBeforeDeletion int
 	if err != nil {
-		timeBeforeDeletion = appConfig.ErrorsTimeToDelete
+		timeBeforeDeletion = config.ErrorsTimeToDelete
 	} else {
-		timeBeforeDeletion = appConfig.CommandsTimeToDelete
+		timeBeforeDeletion = config.CommandsTimeToDelete
 	}
 
-	go messageDeleter(bot, deleteConfig, timeBeforeDeletion)
+	deletionScheduler.schedule(deleteConfig, timeBeforeDeletion, logger)
 
 	if reply != "" {
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, reply)
-		var m tgbotapi.Message
-		m, err = bot.Send(msg)
+		err = sendTemporary(bot, msg, timeBeforeDeletion, logger)
 		if err != nil {
-			log.Printf("Error sending reply to command: %v", err)
+			logger.Error("Error sending reply to command", "err", err)
 			return
 		}
-
-		deleteConfig := tgbotapi.DeleteMessageConfig{
-			ChatID:    m.Chat.ID,
-			MessageID: m.MessageID,
-		}
-		go messageDeleter(bot, deleteConfig, timeBeforeDeletion)
-
 	}
 	return
 }
 
-func questionCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
-	q, err := parseSlashQuestion(m)
+func questionCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	q, groupName, err := parseSlashQuestion(m)
 	if err != nil {
-		log.Println("Unvalid command format")
-		reply = "Неверный формат команды"
+		logger.Info("Invalid command format", "err", err)
+		reply = tr(lang, "error.format")
 		return
 	}
+	group, err := chooseGroup(store, m.Chat, groupName)
+	if err != nil {
+		reply = chooseGroupErrorReply(store, "question", err, lang, logger)
+		return
+	}
+	q.Rec = NewGroupReceiver(group)
 	questionID, err := store.addQuestion(q)
 	if err != nil {
-		log.Printf("Error while adding question : %v\n", err)
-		reply = "Ошибка доступа к базе данных"
+		logger.Error("Error adding question", "err", err)
+		reply = tr(lang, "error.db")
 		return
 	}
-	reply = fmt.Sprintf("Вопрос принят, его id: %d", questionID)
+	reply = tr(lang, "question.accepted", questionID)
 	return
 }
 
-func questionToCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
+func questionToCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
 	q, err := parseSlashQuestionTo(m)
 	if err != nil {
-		log.Printf("Error while parsing message")
-		reply = "Неправильный формат"
+		logger.Info("Invalid command format", "err", err)
+		reply = tr(lang, "error.format")
+		return
+	}
+	err = resolveReceiver(store, q.Rec)
+	if err != nil {
+		logger.Error("Error resolving receiver", "err", err)
+		reply = tr(lang, "error.db")
 		return
 	}
 	questionID, err := store.addQuestion(q)
 	q.QuestionID = questionID
 	if err != nil {
-		log.Printf("Error while adding question : %v\n", err)
-		reply = "Ошибка доступа к базе данных"
+		logger.Error("Error adding question", "err", err)
+		reply = tr(lang, "error.db")
 		return
 	}
-	reply = fmt.Sprintf("Вопрос принят, его id: %d", questionID)
+	reply = tr(lang, "question.accepted", questionID)
 	return
 }
 
-func closeCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
+// binds receiver of a personal question to the id of the user with such username.
+// Receivers unknown to the bot keep UnknownUserID until the user is met
+func resolveReceiver(store Store, rec *Receiver) (err error) {
+	if rec.IsGroup() || rec.ID != UnknownUserID {
+		return
+	}
+	user, err := store.findUserByName(rec.User)
+	if err == UserDoesntExist {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	rec.ID = int64(user.ID)
+	rec.User = user.DisplayName()
+	return
+}
+
+func closeCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
 	qID, err := parseSlashClose(m)
 	if err != nil {
-		log.Print(err)
-		reply = "Неверный формат команды"
+		logger.Info("Invalid command format", "err", err)
+		reply = tr(lang, "error.format")
 		return
 	}
 
 	question, err := store.getQuestion(qID)
 	if err != nil {
 		if err == QuestionDoesntExist {
-			log.Println(err)
-			reply = "Вопрос с таким id не существует"
+			logger.Info("Question not found", "question_id", qID)
+			reply = tr(lang, "question.not_found")
 			return
 		} else {
-			log.Println(err)
-			reply = "Ошибка доступа к базе данных"
+			logger.Error("Error getting question", "question_id", qID, "err", err)
+			reply = tr(lang, "error.db")
 			return
 		}
 	}
 
-	if m.From.UserName != question.User && !(inGroup(appConfig.Admins, m.From.UserName)) {
+	if !authorizeCloseQuestion(store, m.From.ID, question, logger) {
 		err = NotEnoughPermissions
-		reply = "Недостаточно прав"
+		reply = tr(lang, "error.permissions")
 		return
 	}
 
 	err = store.closeQuestion(qID)
 	if err != nil {
-		log.Print(err)
-		reply = "Ошибка доступа к базе данных"
+		logger.Error("Error closing question", "question_id", qID, "err", err)
+		reply = tr(lang, "error.db")
 		return
 	}
-	reply = "Вопрос закрыт"
+	reply = tr(lang, "question.closed")
 	return
 }
 
-func openCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
+func openCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
 	qID, err := parseSlashOpen(m)
 	if err != nil {
-		log.Print(err)
-		reply = "Неверный формат команды"
+		logger.Info("Invalid command format", "err", err)
+		reply = tr(lang, "error.format")
 		return
 	}
 
 	question, err := store.getQuestion(qID)
-	if m.From.UserName != question.User && !(inGroup(appConfig.Admins, m.From.UserName)) {
+	if err != nil {
+		if err == QuestionDoesntExist {
+			reply = tr(lang, "question.not_found")
+		} else {
+			logger.Error("Error getting question", "question_id", qID, "err", err)
+			reply = tr(lang, "error.db")
+		}
+		return
+	}
+	if !authorizeCloseQuestion(store, m.From.ID, question, logger) {
 		err = NotEnoughPermissions
-		reply = "Недостаточно прав"
+		reply = tr(lang, "error.permissions")
 		return
 	}
 
 	err = store.openQuestion(qID)
 	if err != nil {
-		log.Print(err)
-		reply = "Ошибка доступа к базе данных"
+		logger.Error("Error opening question", "question_id", qID, "err", err)
+		reply = tr(lang, "error.db")
 		return
 	}
-	reply = "Вопрос открыт"
+	reply = tr(lang, "question.opened")
 	return
 }
 
-func listToMeQuestionsCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
-	questions, err := store.findAllQuestionsTo(m.From.UserName)
+func listToMeQuestionsCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	questions, err := store.findAllQuestionsTo(int64(m.From.ID))
 	if err != nil {
-		log.Printf("Error while accessing questiong: %v\n", err)
-		reply = "Ошибка доступа к базе данных"
+		logger.Error("Error finding questions", "err", err)
+		reply = tr(lang, "error.db")
 		return
 	}
-	reply = listQuestions(questions)
+	reply = countedQuestions(store, questions, lang)
 	return
 }
 
-func listQuestionsCommandExec(store *SQLStore) (reply string, err error) {
-	questions, err := store.findAllQuestionsTo(AllGroupName)
+func listQuestionsCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	groupName, _ := splitGroupTag(m.CommandArguments())
+	group, err := chooseGroup(store, m.Chat, groupName)
 	if err != nil {
-		log.Printf("Error with list_questions : %v\n", err)
-		reply = "Ошибка доступа к базе данных"
+		reply = chooseGroupErrorReply(store, "list_questions", err, lang, logger)
 		return
 	}
-	reply = listQuestions(questions)
+	questions, err := store.findAllQuestionsTo(group.ChatID)
+	if err != nil {
+		logger.Error("Error finding questions", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	reply = countedQuestions(store, questions, lang)
 	return
 }
 
-func answerCommandExec(m *tgbotapi.Message, store *SQLStore, bot *tgbotapi.BotAPI) (reply string, err error) {
+func answerCommandExec(m *tgbotapi.Message, store Store, bot *tgbotapi.BotAPI, lang Lang,
+	logger *Logger) (reply string, err error) {
 	answer, err := parseSlashAnswer(m)
 	if err != nil {
 		if err == WrongCommandFormat {
-			reply = "Неправильный формат команды"
+			reply = tr(lang, "error.format")
 		} else {
-			reply = "Неправильный id вопроса"
+			reply = tr(lang, "error.question_id")
 		}
 		return
 	}
 
 	question, err := store.getQuestion(answer.QuestionID)
 	if err != nil {
-		log.Printf("Error in getting question by id %v\n", err)
+		logger.Info("Can't get question", "question_id", answer.QuestionID, "err", err)
 		if err == QuestionDoesntExist {
-			reply = "Вопрос с таким id отсутствует в базе данных"
+			reply = tr(lang, "question.not_found")
 		} else {
-			reply = "Ошибка доступа к базе данных"
+			reply = tr(lang, "error.db")
 		}
 		return
 	}
 
 	answerID, err := store.addAnswer(answer)
 	if err != nil {
-		reply = "Ошибка доступа к базе данных"
+		reply = tr(lang, "error.db")
 		return
 	}
 	answer.AnswerID = answerID
 
-	if question.Rec.User != AllGroupName {
+	if !question.Rec.IsGroup() {
 		// answer by Receiver automatically closes question
 		err = store.closeQuestion(question.QuestionID)
 		if err != nil {
-			log.Println(err)
-			reply = "Ошибка доступа к базе данных"
+			logger.Error("Error closing question", "question_id", question.QuestionID, "err", err)
+			reply = tr(lang, "error.db")
 			return
 		}
 	}
 
 	if question.ChatID != m.Chat.ID {
-		err = sendAskerNotification(bot, answer, question)
+		err = sendAskerNotification(bot, store, answer, question, logger)
 		if err != nil {
-			log.Printf("Failed to send notification about new answer: %v", err)
+			logger.Error("Failed to send notification about new answer", "err", err)
 		}
 	}
 
-	reply = fmt.Sprintf("Ответ сохранен, его id: %d", answerID)
+	reply = tr(lang, "answer.saved", answerID)
 	return
 }
 
-func sendAskerNotification(bot *tgbotapi.BotAPI, answer *Answer, question *Question) (err error) {
-	log.Println("Making asker notification")
-	msg := makeAskerNotification(answer, question, question.ChatID)
-	var m tgbotapi.Message
-	m, err = bot.Send(msg)
-
-	if err != nil {
-		err = WrongChatID
-		return
-	}
-
-	deleteConfig := tgbotapi.DeleteMessageConfig{
-		ChatID:    1,
-		MessageID: m.MessageID,
-	}
-	go messageDeleter(bot, deleteConfig, appConfig.NotificationsTimeToDelete)
+func sendAskerNotification(bot *tgbotapi.BotAPI, store Store, answer *Answer, question *Question,
+	logger *Logger) (err error) {
+	msg := makeAskerNotification(store, answer, question, question.ChatID, chatLang(store, question.ChatID))
+	err = sendTemporary(bot, msg, currentConfig().NotificationsTimeToDelete, logger)
 	return
 }
 
-func listAnswersCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
+func listAnswersCommandExec(m *tgbotapi.Message, store Store, lang Lang) (reply string, err error) {
 	questionID, err := parseSlashListAnswers(m)
 	if err != nil {
-		reply = "Неверный формат команды"
+		reply = tr(lang, "error.format")
 		return
 	}
 	question, err := store.getQuestion(questionID)
 	if err != nil {
 		if err == QuestionDoesntExist {
-			reply = "Вопроса с таким id нет в базе данных"
+			reply = tr(lang, "question.not_found")
 		} else {
-			reply = "Ошибка доступа к базе данных"
+			reply = tr(lang, "error.db")
 		}
 		return
 	}
 	answers, err := store.findAllAnswersFor(questionID)
 	if err != nil {
-		reply = "Ошибка доступа к базе данных"
+		reply = tr(lang, "error.db")
 		return
 	}
-	reply = listAnswers(question, answers)
+	reply = listAnswers(store, question, answers, lang)
 	return
 }
 
-func deleteAnswerCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
+func deleteAnswerCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
 	answerID, err := parseSlashDeleteAnswer(m)
 	if err != nil {
-		reply = "Неверный формат команды"
+		reply = tr(lang, "error.format")
 		return
 	}
 	answer, err := store.getAnswer(answerID)
 	if err != nil {
 		if err == AnswerDoesntExist {
-			reply = "Вопроса с таким id нет в базе данных"
+			reply = tr(lang, "answer.not_found")
 		} else {
-			reply = "Ошибка доступа к базе данных"
+			reply = tr(lang, "error.db")
 		}
 		return
 	}
-	if answer.User != m.From.UserName && !(inGroup(appConfig.Admins, m.From.UserName)) {
-		reply = "Недостаточно прав"
+	// moderators of the question's group may delete answers to it
+	chatID := int64(0)
+	question, err := store.getQuestion(answer.QuestionID)
+	if err == nil {
+		chatID = questionChat(question)
+	} else if err != QuestionDoesntExist {
+		reply = tr(lang, "error.db")
+		return
+	}
+	if !authorize(store, m.From.ID, ActionDeleteAnswer, chatID, logger, answer.UserID) {
+		reply = tr(lang, "error.permissions")
 		err = NotEnoughPermissions
 		return
 	}
 	err = store.deleteAnswer(answerID)
 	if err != nil {
-		reply = "Ошибка доступа к базе данных"
+		reply = tr(lang, "error.db")
 		return
 	}
 	return
 }
 
-func deleteQuestionCommandExec(m *tgbotapi.Message, store *SQLStore) (reply string, err error) {
+func deleteQuestionCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
 	questionID, err := parseSlashDeleteQuestion(m)
 	if err != nil {
-		reply = "Неверный формат команды"
+		reply = tr(lang, "error.format")
 		return
 	}
 	question, err := store.getQuestion(questionID)
 	if err != nil {
 		if err == QuestionDoesntExist {
-			reply = "Вопроса с таким id нет в базе данных"
+			reply = tr(lang, "question.not_found")
 		} else {
-			reply = "Ошибка доступа к базе данных"
+			reply = tr(lang, "error.db")
 		}
 		return
 	}
 
-	if question.User != m.From.UserName && !(inGroup(appConfig.Admins, m.From.UserName)) {
+	if !authorize(store, m.From.ID, ActionDeleteQuestion, questionChat(question), logger, question.UserID) {
 		err = NotEnoughPermissions
 		return
 	}
@@ -320,131 +359,222 @@ func deleteQuestionCommandExec(m *tgbotapi.Message, store *SQLStore) (reply stri
 	return
 }
 
-func commandExec(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store *SQLStore) (reply string, err error) {
-	switch update.Message.Command() {
-	case "start":
-		reply = startCommandExec(update.Message, store)
-	case "close":
-		reply, err = closeCommandExec(update.Message, store)
-		if err != nil {
-			break
-		}
-	case "open":
-		reply, err = openCommandExec(update.Message, store)
-		if err != nil {
-			break
-		}
-	case "question":
-		reply, err = questionCommandExec(update.Message, store)
-		if err != nil {
-			break
-		}
-	case "question_to":
-		reply, err = questionToCommandExec(update.Message, store)
-		if err != nil {
-			break
-		}
-	case "list_questions":
-		reply, err = listQuestionsCommandExec(store)
-		if err != nil {
-			break
-		}
-	case "list_questions_to_me":
-		reply, err = listToMeQuestionsCommandExec(update.Message, store)
-		if err != nil {
-			break
-		}
-	case "answer":
-		reply, err = answerCommandExec(update.Message, store, bot)
-		if err != nil {
-			break
-		}
-	case "list_answers":
-		reply, err = listAnswersCommandExec(update.Message, store)
-		if err != nil {
-			break
-		}
-	case "delete_answer":
-		reply, err = deleteAnswerCommandExec(update.Message, store)
-		if err != nil {
-			log.Println(err)
-			break
-		}
-	case "delete_question":
-		reply, err = deleteQuestionCommandExec(update.Message, store)
-		if err != nil {
-			log.Println(err)
-			break
+func listMyQuestionsCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	state, page, err := parseSlashListMy(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	questions, err := store.findQuestionsFromByState(m.From.ID, state,
+		ListPageSize, (page-1)*ListPageSize)
+	if err != nil {
+		logger.Error("Error finding questions", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	reply = listQuestions(store, questions, lang)
+	reply += nextPageHint("list_my_questions", stateName(state), page, len(questions), lang)
+	return
+}
+
+func listMyAnswersCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	state, page, err := parseSlashListMy(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	answers, err := store.findAnswersFrom(m.From.ID, state,
+		ListPageSize, (page-1)*ListPageSize)
+	if err != nil {
+		logger.Error("Error finding answers", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	reply = listUserAnswers(store, answers, lang)
+	reply += nextPageHint("list_my_answers", stateName(state), page, len(answers), lang)
+	return
+}
+
+func importantCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	note, err := parseSlashImportant(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	noteID, err := store.addNote(note)
+	if err != nil {
+		logger.Error("Error adding note", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	reply = tr(lang, "note.saved", noteID)
+	return
+}
+
+func listImportantCommandExec(m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	page, err := parseSlashPage(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	notes, err := store.findNotes(ListPageSize, (page-1)*ListPageSize)
+	if err != nil {
+		logger.Error("Error finding notes", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	reply = listNotes(store, notes, page, lang)
+	return
+}
+
+func deleteImportantCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	noteID, err := parseSlashDeleteImportant(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	note, err := store.getNote(noteID)
+	if err != nil {
+		if err == NoteDoesntExist {
+			reply = tr(lang, "note.not_found")
+		} else {
+			reply = tr(lang, "error.db")
 		}
-	case "list_my_answers":
-		reply = "Command is not implemented yet"
-	case "list_my_questions":
-		reply = "Command is not implemented yet"
-	case "important":
-		reply = "Command is not implemented yet"
-	case "list_important":
-		reply = "Command is not implemented yet"
-	case "delete_important":
-		reply = "Command is not implemented yet"
-	default:
-		log.Printf("%v is uknown command\n", update.Message.Command())
-		err = UknownCommand
-		reply = "Неверная команда"
+		return
+	}
+	if !authorize(store, m.From.ID, ActionDeleteNote, 0, logger, note.UserID) {
+		reply = tr(lang, "error.permissions")
+		err = NotEnoughPermissions
+		return
+	}
+	err = store.deleteNote(noteID)
+	if err != nil {
+		reply = tr(lang, "error.db")
+		return
 	}
+	reply = tr(lang, "note.deleted")
 	return
 }
 
-func makeAskerNotification(answer *Answer, question *Question, chatID int64) (msg tgbotapi.MessageConfig) {
-	message_text := fmt.Sprintf(
-		"На вопрос [%d], заданный @%s:\n        \"%s\"\n появился ответ от @%s:\n        \"%s\"",
-		question.QuestionID, question.User, question.Text, answer.User, answer.Text)
+func makeAskerNotification(store Store, answer *Answer, question *Question, chatID int64, lang Lang) (msg tgbotapi.MessageConfig) {
+	message_text := tr(lang, "notify.answer",
+		question.QuestionID, authorMention(store, question.UserID, question.User), question.Text,
+		authorMention(store, answer.UserID, answer.User), answer.Text)
 
 	msg = tgbotapi.NewMessage(chatID, message_text)
 	return
 }
 
-func makeAskedPersonNotification(question *Question, chatID int64) (msg tgbotapi.MessageConfig) {
-	messageText := fmt.Sprintf(
-		`@%s задал вопрос [%d]:
-"%s"`,
-		question.User, question.QuestionID, question.Text)
+func makeAskedPersonNotification(store Store, question *Question, chatID int64, lang Lang) (msg tgbotapi.MessageConfig) {
+	messageText := tr(lang, "notify.question", authorMention(store, question.UserID, question.User), question.QuestionID, question.Text)
 
 	msg = tgbotapi.NewMessage(chatID, messageText)
 	return
 }
 
-func startCommandExec(message *tgbotapi.Message, store *SQLStore) (reply string) {
-	reply = "Привет, я телеграм бот, созданный для управления чатами групп ФББ"
+func startCommandExec(message *tgbotapi.Message, store Store, lang Lang) (reply string) {
+	reply = tr(lang, "start")
 	return
 }
 
-func listQuestions(lst QuestionList) (info string) {
+func listQuestions(store Store, lst QuestionList, lang Lang) (info string) {
 	if len(lst) == 0 {
-		info = "Нет вопросов"
+		info = tr(lang, "questions.none")
 		return
 	}
 	questionsInfo := []string{}
 	for _, q := range lst {
-		info := fmt.Sprintf("[%d] @%s cпросил в  %v:\n    %s", q.QuestionID, q.User, q.Date, q.Text)
+		info := tr(lang, "questions.item", q.QuestionID, authorMention(store, q.UserID, q.User), formatDate(lang, q.Date), q.Text)
 		questionsInfo = append(questionsInfo, info)
 	}
 	info = strings.Join(questionsInfo, "\n")
 	return
 }
 
-func listAnswers(q *Question, lst []*Answer) (info string) {
+// whole list of questions headed with their count
+func countedQuestions(store Store, lst QuestionList, lang Lang) (info string) {
+	info = listQuestions(store, lst, lang)
+	if len(lst) > 0 {
+		info = trn(lang, "questions.count", len(lst)) + ":\n" + info
+	}
+	return
+}
+
+func listAnswers(store Store, q *Question, lst []*Answer, lang Lang) (info string) {
 	if len(lst) == 0 {
-		info = "Нет ответов"
+		info = tr(lang, "answers.none")
 		return
 	}
-	questionStr := fmt.Sprintf("На ваш вопрос от %v:\n    :%s\n",
-		q.Date, q.Text)
+	questionStr := tr(lang, "answers.header",
+		trn(lang, "answers.count", len(lst)), formatDate(lang, q.Date), q.Text)
 
 	answersInfo := make([]string, len(lst))
 	for ind, a := range lst {
-		infStr := fmt.Sprintf("@%s ответил в %v:\n    %s", a.User, a.Date, a.Text)
-		answersInfo[ind] = infStr
+		answersInfo[ind] = answerInfo(store, a, lang)
 	}
 	info = questionStr + strings.Join(answersInfo, "\n")
 	return
 }
+
+// answers to different questions, each one is marked with id of the question
+func listUserAnswers(store Store, lst []*Answer, lang Lang) (info string) {
+	if len(lst) == 0 {
+		info = tr(lang, "answers.none")
+		return
+	}
+	answersInfo := make([]string, len(lst))
+	for ind, a := range lst {
+		answersInfo[ind] = fmt.Sprintf("[%d] %s", a.QuestionID, answerInfo(store, a, lang))
+	}
+	info = strings.Join(answersInfo, "\n")
+	return
+}
+
+func answerInfo(store Store, a *Answer, lang Lang) string {
+	return tr(lang, "answers.item", authorMention(store, a.UserID, a.User), formatDate(lang, a.Date), a.Text)
+}
+
+// hint with command for the next page, empty if the page isn't full
+func nextPageHint(command string, args string, page int, count int, lang Lang) (hint string) {
+	if count < ListPageSize {
+		return
+	}
+	if args != "" {
+		args += " "
+	}
+	hint = tr(lang, "page.next", command, args, page+1)
+	return
+}
+
+func stateName(state QuestionState) string {
+	switch state {
+	case ClosedQuestions:
+		return "closed"
+	case AllQuestions:
+		return "all"
+	default:
+		return "open"
+	}
+}
+
+func listNotes(store Store, lst []*Note, page int, lang Lang) (info string) {
+	if len(lst) == 0 {
+		if page > 1 {
+			info = tr(lang, "notes.no_more")
+		} else {
+			info = tr(lang, "notes.none")
+		}
+		return
+	}
+	notesInfo := make([]string, len(lst))
+	for ind, n := range lst {
+		notesInfo[ind] = tr(lang, "notes.item", n.NoteID, authorMention(store, n.UserID, n.User), formatDate(lang, n.Date), n.Text)
+	}
+	info = strings.Join(notesInfo, "\n")
+	info += nextPageHint("list_important", "", page, len(lst), lang)
+	return
+}
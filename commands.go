@@ -0,0 +1,273 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// adapters for handlers, which don't need everything
+func slashWithStore(f func(m *tgbotapi.Message, store Store, lang Lang) (string, error)) SlashHandler {
+	return func(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (string, error) {
+		return f(m, store, lang)
+	}
+}
+
+func slashWithLogger(f func(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (string, error)) SlashHandler {
+	return func(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (string, error) {
+		return f(m, store, lang, logger)
+	}
+}
+
+func inlineCloseReply(accessType string) InlineHandler {
+	return func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+		logger *Logger) error {
+		return sendCloseReply(bot, store, query, accessType, lang, logger)
+	}
+}
+
+func inlineOpenReply(accessType string) InlineHandler {
+	return func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+		logger *Logger) error {
+		return sendOpenReply(bot, store, query, accessType, lang, logger)
+	}
+}
+
+var (
+	questionIDArg = CommandArg{Name: "arg.question_id"}
+	groupArg      = CommandArg{Name: "arg.group", Optional: true}
+	textArg       = CommandArg{Name: "arg.text"}
+	pageArg       = CommandArg{Name: "arg.page", Optional: true}
+	stateArg      = CommandArg{Name: "arg.state", Optional: true}
+	userArg       = CommandArg{Name: "arg.user"}
+	langArg       = CommandArg{Name: "arg.lang", Optional: true}
+)
+
+func init() {
+	commands := []*Command{{
+		Name: "start",
+		Slash: func(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (string, error) {
+			return startCommandExec(m, store, lang), nil
+		},
+	}, {
+		Name:  "help",
+		Args:  []CommandArg{{Name: "arg.command", Optional: true}},
+		Slash: helpCommandExec,
+	}, {
+		Name:   "question",
+		Args:   []CommandArg{groupArg, textArg},
+		Action: ActionPost,
+		Slash:  slashWithLogger(questionCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendAddQuestionToGroupReply(bot, store, query, lang, logger)
+		},
+	}, {
+		Name:   "question_to",
+		Args:   []CommandArg{userArg, textArg},
+		Action: ActionPost,
+		Slash:  slashWithLogger(questionToCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendAddQuestionToUserReply(bot, query, lang, logger)
+		},
+	}, {
+		Name:   "answer",
+		Args:   []CommandArg{questionIDArg, textArg},
+		Action: ActionPost,
+		Slash: func(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (string, error) {
+			return answerCommandExec(m, store, bot, lang, logger)
+		},
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendAddAnswerReply(bot, query, lang, logger)
+		},
+	}, {
+		Name:  "close",
+		Args:  []CommandArg{questionIDArg},
+		Slash: slashWithLogger(closeCommandExec),
+	}, {
+		Name:  "open",
+		Args:  []CommandArg{questionIDArg},
+		Slash: slashWithLogger(openCommandExec),
+	}, {
+		Name:  "delete_question",
+		Args:  []CommandArg{questionIDArg},
+		Slash: slashWithLogger(deleteQuestionCommandExec),
+	}, {
+		Name:  "delete_answer",
+		Args:  []CommandArg{{Name: "arg.answer_id"}},
+		Slash: slashWithLogger(deleteAnswerCommandExec),
+	}, {
+		Name:  "list_questions",
+		Args:  []CommandArg{groupArg},
+		Slash: slashWithLogger(listQuestionsCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) (err error) {
+			groupName, _ := splitGroupTag(args)
+			group, err := chooseInlineGroup(bot, store, query, "list_questions", groupName, "", lang, logger)
+			if err != nil {
+				return
+			}
+			return sendQuestionListReply(bot, store, query.ID, group.ChatID, query.Offset, lang, logger)
+		},
+	}, {
+		Name:  "list_questions_to_me",
+		Slash: slashWithLogger(listToMeQuestionsCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendQuestionListReply(bot, store, query.ID, int64(query.From.ID), query.Offset, lang, logger)
+		},
+	}, {
+		Name:  "list_answers",
+		Args:  []CommandArg{questionIDArg},
+		Slash: slashWithStore(listAnswersCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			questionID, err := parseListAnswersArgs(args)
+			if err != nil {
+				return sendWrongFormatReply(bot, query.ID, lang)
+			}
+			return sendAnswersListReply(bot, store, query.ID, questionID, query.Offset, lang, logger)
+		},
+	}, {
+		Name: "list_answers_to_me",
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendListAnswersToUserReply(bot, store, query.ID, query.From.ID, query.Offset, lang, logger)
+		},
+	}, {
+		Name:  "list_my_questions",
+		Args:  []CommandArg{stateArg, pageArg},
+		Slash: slashWithLogger(listMyQuestionsCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendUserQuestionListReply(bot, store, query.ID, query.From.ID, query.Offset, lang, logger)
+		},
+	}, {
+		Name:  "list_my_answers",
+		Args:  []CommandArg{stateArg, pageArg},
+		Slash: slashWithLogger(listMyAnswersCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendUserAnswersListReply(bot, store, query.ID, query.From.ID, query.Offset, lang, logger)
+		},
+	}, {
+		Name:   "important",
+		Args:   []CommandArg{{Name: "arg.important", Optional: true}},
+		Action: ActionPost,
+		Slash:  slashWithLogger(importantCommandExec),
+	}, {
+		Name:  "list_important",
+		Args:  []CommandArg{pageArg},
+		Chats: PrivateChat,
+		Slash: slashWithLogger(listImportantCommandExec),
+		Inline: func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string, store Store, lang Lang,
+			logger *Logger) error {
+			return sendNotesListReply(bot, store, query.ID, query.Offset, lang, logger)
+		},
+	}, {
+		Name:  "delete_important",
+		Args:  []CommandArg{{Name: "arg.note_id"}},
+		Slash: slashWithLogger(deleteImportantCommandExec),
+	}, {
+		Name:   "close_my",
+		Inline: inlineCloseReply("my"),
+	}, {
+		Name:   "close_to",
+		Inline: inlineCloseReply("to"),
+	}, {
+		Name:   "a_close",
+		Args:   []CommandArg{groupArg},
+		Action: ActionCloseQuestion,
+		Inline: inlineCloseReply("admin"),
+	}, {
+		Name:   "open_my",
+		Inline: inlineOpenReply("my"),
+	}, {
+		Name:   "open_to",
+		Inline: inlineOpenReply("to"),
+	}, {
+		Name:   "a_open",
+		Args:   []CommandArg{groupArg},
+		Action: ActionCloseQuestion,
+		Inline: inlineOpenReply("admin"),
+	}, {
+		Name:   "register_group",
+		Args:   []CommandArg{{Name: "arg.name"}, {Name: "arg.notification_chat", Optional: true}},
+		Chats:  GroupChat,
+		Action: ActionManageGroup,
+		Slash:  slashWithLogger(registerGroupCommandExec),
+	}, {
+		Name: "list_groups",
+		Slash: func(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (string, error) {
+			return listGroupsCommandExec(store, lang, logger)
+		},
+	}, {
+		Name:   "group_admin",
+		Args:   []CommandArg{{Name: "arg.admin_action"}, userArg},
+		Chats:  GroupChat,
+		Action: ActionGroupAdmins,
+		Slash:  slashWithLogger(groupAdminCommandExec),
+	}, {
+		Name:  "language",
+		Args:  []CommandArg{langArg},
+		Slash: slashWithLogger(languageCommandExec),
+	}, {
+		Name:  "group_language",
+		Args:  []CommandArg{langArg},
+		Chats: GroupChat,
+		Slash: groupLanguageCommandExec,
+	}, {
+		Name:   "reload_config",
+		Action: ActionReloadConfig,
+		Slash:  reloadConfigCommandExec,
+	}, {
+		Name:   "outbox",
+		Action: ActionViewStats,
+		Slash:  slashWithStore(outboxCommandExec),
+	}, {
+		Name:   "workers",
+		Action: ActionViewStats,
+		Slash:  slashWithStore(workersCommandExec),
+	}, {
+		Name:   "grant",
+		Args:   []CommandArg{userArg, {Name: "arg.role"}},
+		Action: ActionManageRoles,
+		Slash:  grantCommandExec,
+	}, {
+		Name:   "revoke",
+		Args:   []CommandArg{userArg},
+		Action: ActionManageRoles,
+		Slash:  revokeCommandExec,
+	}, {
+		Name:   "roles",
+		Action: ActionManageRoles,
+		Slash:  slashWithLogger(listRolesCommandExec),
+	}, {
+		Name:   "ban",
+		Args:   []CommandArg{userArg, {Name: "arg.reason", Optional: true}},
+		Chats:  PrivateChat,
+		Action: ActionBanUsers,
+		Slash:  slashWithLogger(banCommandExec),
+	}, {
+		Name:   "mute",
+		Args:   []CommandArg{userArg, {Name: "arg.duration"}, {Name: "arg.reason", Optional: true}},
+		Chats:  PrivateChat,
+		Action: ActionMuteUsers,
+		Slash:  slashWithLogger(muteCommandExec),
+	}, {
+		Name:   "unban",
+		Args:   []CommandArg{userArg},
+		Chats:  PrivateChat,
+		Action: ActionBanUsers,
+		Slash:  slashWithLogger(unbanCommandExec),
+	}, {
+		Name:   "bans",
+		Args:   []CommandArg{{Name: "arg.user", Optional: true}, pageArg},
+		Chats:  PrivateChat,
+		Action: ActionMuteUsers,
+		Slash:  slashWithLogger(listSanctionsCommandExec),
+	}}
+	for _, c := range commands {
+		commandRegistry.register(c)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// config is built in layers: defaults, then the json or yaml file, then
+// environment variables, then command line flags. Each layer overrides the previous one
+const configEnvPrefix = "FBBBOT_"
+
+var configPath = flag.String("config", "",
+	"path of the json or yaml config file, "+appConfigPath+" by default ("+configEnvPrefix+"CONFIG)")
+
+var appConfigValue atomic.Value
+
+// the config is never changed in place, a reload replaces it as a whole
+func currentConfig() *AppConfig {
+	config, _ := appConfigValue.Load().(*AppConfig)
+	return config
+}
+
+func setAppConfig(config *AppConfig) {
+	appConfigValue.Store(config)
+}
+
+// configSetting is a setting which may also come from environment and flags.
+// Name is the key of the config file, Set parses the value of the other layers
+type configSetting struct {
+	Name  string
+	Env   string
+	Flag  string
+	Usage string
+	Set   func(config *AppConfig, value string) error
+}
+
+var configSettings = []*configSetting{
+	{Name: "TelegramBotToken", Env: "TOKEN", Flag: "token", Usage: "telegram bot token",
+		Set: func(c *AppConfig, v string) error { c.TelegramBotToken = v; return nil }},
+	{Name: "DBDriver", Env: "DB_DRIVER", Flag: "db-driver", Usage: "sqlite3, postgres or memory",
+		Set: func(c *AppConfig, v string) error { c.DBDriver = v; return nil }},
+	{Name: "DBSource", Env: "DB_SOURCE", Flag: "db-source", Usage: "sqlite file or postgres connection string",
+		Set: func(c *AppConfig, v string) error { c.DBSource = v; return nil }},
+	{Name: "Admins", Env: "ADMINS", Flag: "admins", Usage: "comma separated telegram ids of admins",
+		Set: func(c *AppConfig, v string) (err error) {
+			c.Admins, err = parseConfigIDs(v)
+			c.AdminNames = nil
+			return
+		}},
+	{Name: "Groups", Env: "GROUPS", Flag: "groups",
+		Usage: "comma separated groups as name:chat id, e.g. bio2024:-1001234567890",
+		Set:   func(c *AppConfig, v string) (err error) { c.Groups, err = parseConfigGroups(v); return }},
+	{Name: "AdminLogChatID", Env: "ADMIN_LOG_CHAT", Flag: "admin-log-chat", Usage: "chat id for reports to admins",
+		Set: func(c *AppConfig, v string) (err error) {
+			c.AdminLogChatID, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				err = fmt.Errorf("%q is not a chat id", v)
+			}
+			return
+		}},
+	{Name: "DefaultGroup", Env: "DEFAULT_GROUP", Flag: "default-group", Usage: "group of commands without one",
+		Set: func(c *AppConfig, v string) error { c.DefaultGroup = v; return nil }},
+	intSetting("ErrorsTimeToDelete", "ERRORS_TIME_TO_DELETE", "errors-time-to-delete",
+		"seconds before failed commands and their replies are deleted",
+		func(c *AppConfig) *int { return &c.ErrorsTimeToDelete }),
+	intSetting("CommandsTimeToDelete", "COMMANDS_TIME_TO_DELETE", "commands-time-to-delete",
+		"seconds before commands and their replies are deleted",
+		func(c *AppConfig) *int { return &c.CommandsTimeToDelete }),
+	intSetting("InlineAnswersTimeToDelete", "INLINE_ANSWERS_TIME_TO_DELETE", "inline-answers-time-to-delete",
+		"seconds before messages sent from inline mode are deleted",
+		func(c *AppConfig) *int { return &c.InlineAnswersTimeToDelete }),
+	intSetting("NotificationsTimeToDelete", "NOTIFICATIONS_TIME_TO_DELETE", "notifications-time-to-delete",
+		"seconds before notifications are deleted",
+		func(c *AppConfig) *int { return &c.NotificationsTimeToDelete }),
+	{Name: "PendingStore", Env: "PENDING_STORE", Flag: "pending-store", Usage: "store or memory",
+		Set: func(c *AppConfig, v string) error { c.PendingStore = v; return nil }},
+	intSetting("PendingTTL", "PENDING_TTL", "pending-ttl",
+		"seconds unconfirmed inline messages are kept",
+		func(c *AppConfig) *int { return &c.PendingTTL }),
+	intSetting("PendingLimit", "PENDING_LIMIT", "pending-limit",
+		"most unconfirmed inline messages kept, 0 for no limit",
+		func(c *AppConfig) *int { return &c.PendingLimit }),
+	intSetting("PendingCleanInterval", "PENDING_CLEAN_INTERVAL", "pending-clean-interval",
+		"seconds between removals of expired unconfirmed messages",
+		func(c *AppConfig) *int { return &c.PendingCleanInterval }),
+	intSetting("ShutdownTimeout", "SHUTDOWN_TIMEOUT", "shutdown-timeout",
+		"seconds to wait for active handlers on exit",
+		func(c *AppConfig) *int { return &c.ShutdownTimeout }),
+	{Name: "LogLevel", Env: "LOG_LEVEL", Flag: "log-level", Usage: "debug, info, warn or error",
+		Set: func(c *AppConfig, v string) error { c.LogLevel = v; return nil }},
+	{Name: "LogFormat", Env: "LOG_FORMAT", Flag: "log-format", Usage: "logfmt or json",
+		Set: func(c *AppConfig, v string) error { c.LogFormat = v; return nil }},
+	intSetting("Workers", "WORKERS", "workers",
+		"updates handled at once",
+		func(c *AppConfig) *int { return &c.Workers }),
+	intSetting("WorkerQueueSize", "WORKER_QUEUE_SIZE", "worker-queue-size",
+		"updates waiting for each worker before receiving stops",
+		func(c *AppConfig) *int { return &c.WorkerQueueSize }),
+	intSetting("AdminSyncInterval", "ADMIN_SYNC_INTERVAL", "admin-sync-interval",
+		"seconds between reads of groups' telegram administrators, 0 to turn them off",
+		func(c *AppConfig) *int { return &c.AdminSyncInterval }),
+	intSetting("CallbackTTL", "CALLBACK_TTL", "callback-ttl",
+		"seconds buttons stay valid",
+		func(c *AppConfig) *int { return &c.CallbackTTL }),
+	budgetSetting("RateLimits.UserWrites", "RATE_USER_WRITES", "rate-user-writes",
+		"questions, answers and notes of a user as per minute/burst, e.g. 10/5, 0 for no limit",
+		func(c *AppConfig) *RateBudget { return &c.RateLimits.UserWrites }),
+	budgetSetting("RateLimits.UserReads", "RATE_USER_READS", "rate-user-reads",
+		"other requests of a user as per minute/burst",
+		func(c *AppConfig) *RateBudget { return &c.RateLimits.UserReads }),
+	budgetSetting("RateLimits.ChatWrites", "RATE_CHAT_WRITES", "rate-chat-writes",
+		"questions, answers and notes in a group chat as per minute/burst",
+		func(c *AppConfig) *RateBudget { return &c.RateLimits.ChatWrites }),
+	budgetSetting("RateLimits.ChatReads", "RATE_CHAT_READS", "rate-chat-reads",
+		"other requests in a group chat as per minute/burst",
+		func(c *AppConfig) *RateBudget { return &c.RateLimits.ChatReads }),
+}
+
+func intSetting(name string, env string, flagName string, usage string,
+	field func(c *AppConfig) *int) *configSetting {
+	return &configSetting{Name: name, Env: env, Flag: flagName, Usage: usage,
+		Set: func(c *AppConfig, v string) (err error) {
+			*field(c), err = strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				err = fmt.Errorf("%q is not an integer", v)
+			}
+			return
+		}}
+}
+
+// "10/5" is 10 per minute with bursts of 5, "10" has bursts of the same size, "0" is no limit
+func budgetSetting(name string, env string, flagName string, usage string,
+	field func(c *AppConfig) *RateBudget) *configSetting {
+	return &configSetting{Name: name, Env: env, Flag: flagName, Usage: usage,
+		Set: func(c *AppConfig, v string) (err error) {
+			parts := strings.SplitN(strings.TrimSpace(v), "/", 2)
+			budget := field(c)
+			budget.PerMinute, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+			budget.Burst = budget.PerMinute
+			if err == nil && len(parts) == 2 {
+				budget.Burst, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			}
+			if err != nil {
+				err = fmt.Errorf("%q is not per minute/burst", v)
+			}
+			return
+		}}
+}
+
+// values of the flags of configSettings, empty for flags not given
+var configFlags = make(map[*configSetting]*string)
+
+func init() {
+	for _, s := range configSettings {
+		configFlags[s] = flag.String(s.Flag, "", s.Usage+" ("+configEnvPrefix+s.Env+")")
+	}
+}
+
+func defaultAppConfig() *AppConfig {
+	return &AppConfig{
+		DBDriver:             SQLiteDriver,
+		DBSource:             "botbase.sql",
+		ShutdownTimeout:      10,
+		Workers:              8,
+		LogLevel:             "info",
+		LogFormat:            LogFormatLogfmt,
+		WorkerQueueSize:      100,
+		PendingStore:         PendingInStore,
+		PendingTTL:           inlineTempQuestionStoreTime,
+		PendingLimit:         1000,
+		PendingCleanInterval: cleanQuestionPoolInterval,
+		CallbackTTL:          86400,
+		AdminSyncInterval:    3600,
+
+		// replies are cleaned up soon, notifications are kept for a day to be read
+		ErrorsTimeToDelete:        30,
+		CommandsTimeToDelete:      120,
+		InlineAnswersTimeToDelete: 120,
+		NotificationsTimeToDelete: 86400,
+		RateLimits: RateLimitSettings{
+			UserWrites: RateBudget{PerMinute: 6, Burst: 3},
+			UserReads:  RateBudget{PerMinute: 30, Burst: 10},
+			ChatWrites: RateBudget{PerMinute: 20, Burst: 10},
+			ChatReads:  RateBudget{PerMinute: 60, Burst: 20},
+		},
+	}
+}
+
+// ConfigError is a wrong value of one setting, Source tells where it was set
+type ConfigError struct {
+	Setting string
+	Source  string
+	Err     error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Setting, e.Source, e.Err)
+}
+
+// ConfigErrors are all problems of the config, so they can be fixed at once
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for ind, err := range e {
+		lines[ind] = "  " + err.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+// reads the config with all layers applied, flags must be parsed before.
+// Token is not required for runs which don't talk to telegram
+func loadAppConfig(requireToken bool) (config *AppConfig, err error) {
+	config = defaultAppConfig()
+	// where each setting was set last, settings of the file are found by the file
+	sources := make(map[string]string)
+
+	path, explicit := *configPath, *configPath != ""
+	if !explicit {
+		path, explicit = os.LookupEnv(configEnvPrefix + "CONFIG")
+	}
+	if !explicit {
+		path = appConfigPath
+	}
+	keys, err := readConfigFile(path, config)
+	if os.IsNotExist(err) && !explicit {
+		// everything may come from environment and flags
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		sources[strings.ToLower(key)] = path
+	}
+
+	var errs ConfigErrors
+	apply := func(s *configSetting, value string, source string) {
+		sources[strings.ToLower(s.Name)] = source
+		setErr := s.Set(config, value)
+		if setErr != nil {
+			errs = append(errs, &ConfigError{s.Name, source, setErr})
+		}
+	}
+	for _, s := range configSettings {
+		value, ok := os.LookupEnv(configEnvPrefix + s.Env)
+		if ok {
+			apply(s, value, "environment "+configEnvPrefix+s.Env)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		for _, s := range configSettings {
+			if s.Flag == f.Name {
+				apply(s, *configFlags[s], "flag -"+s.Flag)
+			}
+		}
+	})
+	if len(errs) > 0 {
+		err = errs
+		return
+	}
+
+	err = validateAppConfig(config, sources, requireToken)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// decodes json or yaml by the extension of the file into config,
+// returns keys found in the file
+func readConfigFile(path string, config *AppConfig) (keys []string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+		if err != nil {
+			err = fmt.Errorf("%s: %v", path, err)
+			return
+		}
+		// settings have the same names in both formats, so yaml goes through json
+		data, err = json.Marshal(values)
+		if err != nil {
+			err = fmt.Errorf("%s: %v", path, err)
+			return
+		}
+	default:
+		err = json.Unmarshal(data, &values)
+		if err != nil {
+			err = jsonConfigError(path, data, err)
+			return
+		}
+	}
+	data, err = migrateConfigAdmins(path, values, data, config)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		err = jsonConfigError(path, data, err)
+		return
+	}
+
+	known := make(map[string]bool)
+	configType := reflect.TypeOf(*config)
+	for i := 0; i < configType.NumField(); i++ {
+		if configType.Field(i).Tag.Get("json") == "-" {
+			continue
+		}
+		known[strings.ToLower(configType.Field(i).Name)] = true
+	}
+	var errs ConfigErrors
+	for key := range values {
+		if !known[strings.ToLower(key)] {
+			errs = append(errs, &ConfigError{key, path, errors.New("unknown setting")})
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(errs) > 0 {
+		err = errs
+		return
+	}
+	return
+}
+
+// points json errors at the line or the setting
+func jsonConfigError(path string, data []byte, err error) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		line := 1 + strings.Count(string(data[:e.Offset]), "\n")
+		return fmt.Errorf("%s:%d: %v", path, line, e)
+	case *json.UnmarshalTypeError:
+		return &ConfigError{e.Field, path, fmt.Errorf("must be %s, not %s", e.Type, e.Value)}
+	}
+	return fmt.Errorf("%s: %v", path, err)
+}
+
+// Admins were usernames before, ids written as strings are accepted,
+// usernames are moved to config.AdminNames to be replaced with ids from the store
+func migrateConfigAdmins(path string, values map[string]interface{},
+	data []byte, config *AppConfig) (migrated []byte, err error) {
+	migrated = data
+	for key, value := range values {
+		list, ok := value.([]interface{})
+		if !strings.EqualFold(key, "Admins") || !ok {
+			continue
+		}
+		config.AdminNames = nil
+		changed := false
+		ids := []interface{}{}
+		for _, item := range list {
+			field, ok := item.(string)
+			if !ok {
+				ids = append(ids, item)
+				continue
+			}
+			changed = true
+			name := strings.TrimPrefix(strings.TrimSpace(field), "@")
+			if userNameRegexp.MatchString(name) {
+				config.AdminNames = append(config.AdminNames, name)
+				continue
+			}
+			var id int
+			id, err = parseConfigID(field)
+			if err != nil {
+				err = &ConfigError{key, path, err}
+				return
+			}
+			ids = append(ids, id)
+		}
+		if changed {
+			values[key] = ids
+			migrated, err = json.Marshal(values)
+			if err != nil {
+				err = fmt.Errorf("%s: %v", path, err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// "1,2,3"
+func parseConfigIDs(value string) (ids []int, err error) {
+	for _, field := range strings.Split(value, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		var id int
+		id, err = parseConfigID(field)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+func parseConfigID(field string) (id int, err error) {
+	field = strings.TrimSpace(field)
+	id, err = strconv.Atoi(field)
+	if err == nil {
+		return
+	}
+	if userNameRegexp.MatchString(strings.TrimPrefix(field, "@")) {
+		err = fmt.Errorf("%q is a username, admins are telegram ids since usernames can change, "+
+			"replace it with the id of the user", field)
+		return
+	}
+	err = fmt.Errorf("%q is not a telegram id", field)
+	return
+}
+
+// "bio2024:-1001234567890,chem2024:-1009876543210"
+func parseConfigGroups(value string) (groups []*Group, err error) {
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("%q is not name:chat id", field)
+			return
+		}
+		var chatID int64
+		chatID, err = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			err = fmt.Errorf("%q has wrong chat id", field)
+			return
+		}
+		groups = append(groups, &Group{Name: strings.TrimSpace(parts[0]), ChatID: chatID})
+	}
+	return
+}
+
+func validateAppConfig(config *AppConfig, sources map[string]string, requireToken bool) (err error) {
+	var errs ConfigErrors
+	check := func(ok bool, setting string, format string, args ...interface{}) {
+		if ok {
+			return
+		}
+		source, found := sources[strings.ToLower(setting)]
+		if !found {
+			// parts of a setting come from the file with the whole setting
+			source, found = sources[strings.ToLower(strings.SplitN(setting, ".", 2)[0])]
+		}
+		if !found {
+			source = "default"
+		}
+		errs = append(errs, &ConfigError{setting, source, fmt.Errorf(format, args...)})
+	}
+
+	check(!requireToken || config.TelegramBotToken != "", "TelegramBotToken", "is required")
+	check(config.DBDriver == SQLiteDriver || config.DBDriver == PostgresDriver || config.DBDriver == MemoryDriver,
+		"DBDriver", "%q is not one of %s, %s, %s", config.DBDriver, SQLiteDriver, PostgresDriver, MemoryDriver)
+	check(config.DBDriver == MemoryDriver || config.DBSource != "", "DBSource", "is required for %s", config.DBDriver)
+	for _, id := range config.Admins {
+		check(id > 0, "Admins", "%d is not a user id", id)
+	}
+
+	names := make(map[string]bool)
+	chats := make(map[int64]bool)
+	for _, g := range config.Groups {
+		check(g.Name != "", "Groups", "group with chat id %d has no name", g.ChatID)
+		check(g.ChatID < 0, "Groups", "chat id %d of group %q is not a group chat id", g.ChatID, g.Name)
+		check(!names[strings.ToLower(g.Name)], "Groups", "name %q is used twice", g.Name)
+		check(!chats[g.ChatID], "Groups", "chat id %d is used twice", g.ChatID)
+		names[strings.ToLower(g.Name)] = true
+		chats[g.ChatID] = true
+	}
+	// without configured groups the default one may be registered with /register_group
+	check(config.DefaultGroup == "" || len(config.Groups) == 0 || names[strings.ToLower(config.DefaultGroup)],
+		"DefaultGroup", "%q is not one of Groups", config.DefaultGroup)
+
+	check(config.ErrorsTimeToDelete >= 0, "ErrorsTimeToDelete", "must not be negative")
+	check(config.CommandsTimeToDelete >= 0, "CommandsTimeToDelete", "must not be negative")
+	check(config.InlineAnswersTimeToDelete >= 0, "InlineAnswersTimeToDelete", "must not be negative")
+	check(config.NotificationsTimeToDelete >= 0, "NotificationsTimeToDelete", "must not be negative")
+	check(config.PendingStore == "" || config.PendingStore == PendingInStore || config.PendingStore == PendingMemory,
+		"PendingStore", "%q is not one of %s, %s", config.PendingStore, PendingInStore, PendingMemory)
+	check(config.PendingTTL > 0, "PendingTTL", "must be positive")
+	check(config.PendingLimit >= 0, "PendingLimit", "must not be negative")
+	check(config.PendingCleanInterval > 0, "PendingCleanInterval", "must be positive")
+	check(config.ShutdownTimeout >= 0, "ShutdownTimeout", "must not be negative")
+	check(config.Workers > 0, "Workers", "must be positive")
+	_, levelErr := parseLogLevel(config.LogLevel)
+	check(levelErr == nil, "LogLevel", "%q is not one of debug, info, warn, error", config.LogLevel)
+	check(config.LogFormat == LogFormatLogfmt || config.LogFormat == LogFormatJSON,
+		"LogFormat", "%q is not one of %s, %s", config.LogFormat, LogFormatLogfmt, LogFormatJSON)
+	check(config.WorkerQueueSize >= 0, "WorkerQueueSize", "must not be negative")
+	check(config.CallbackTTL > 0, "CallbackTTL", "must be positive")
+	check(config.AdminSyncInterval >= 0, "AdminSyncInterval", "must not be negative")
+	checkBudget := func(budget RateBudget, setting string) {
+		check(budget.PerMinute >= 0, setting, "PerMinute must not be negative")
+		check(budget.PerMinute == 0 || budget.Burst > 0, setting, "Burst must be positive")
+	}
+	checkBudget(config.RateLimits.UserWrites, "RateLimits.UserWrites")
+	checkBudget(config.RateLimits.UserReads, "RateLimits.UserReads")
+	checkBudget(config.RateLimits.ChatWrites, "RateLimits.ChatWrites")
+	checkBudget(config.RateLimits.ChatReads, "RateLimits.ChatReads")
+	if config.Webhook != nil && config.Webhook.SecretToken == "" {
+		check(false, "Webhook.SecretToken", "is required, telegram sends it with every update")
+	} else if config.Webhook != nil {
+		webhookErr := validateWebhookSettings(config.Webhook)
+		check(webhookErr == nil, "Webhook", "%v", webhookErr)
+	}
+
+	if len(errs) > 0 {
+		err = errs
+		return
+	}
+	return
+}
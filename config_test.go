@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, name string, text string) (path string) {
+	dir, err := ioutil.TempDir("", "fbbbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, []byte(text), 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestReadConfigFileAdmins(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		admins string
+		names  string
+		err    string
+	}{
+		{"ids", `{"Admins": [1, 2]}`, "[1 2]", "[]", ""},
+		{"ids as strings", `{"Admins": ["1", " 2"]}`, "[1 2]", "[]", ""},
+		{"old usernames", `{"Admins": [1, "@alice_b", "bob_smith"]}`, "[1]", "[alice_b bob_smith]", ""},
+		{"not an id", `{"Admins": ["1a"]}`, "", "", "is not a telegram id"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestConfig(t, "config.json", test.text)
+			defer os.RemoveAll(filepath.Dir(path))
+			config := new(AppConfig)
+			_, err := readConfigFile(path, config)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(config.Admins) != test.admins {
+					t.Errorf("admins are %v, want %s", config.Admins, test.admins)
+				}
+				if fmt.Sprint(config.AdminNames) != test.names {
+					t.Errorf("admin names are %v, want %s", config.AdminNames, test.names)
+				}
+				return
+			}
+			configErr, ok := err.(*ConfigError)
+			if !ok || configErr.Setting != "Admins" || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error is %v, want a ConfigError of Admins with %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestResolveAdminNames(t *testing.T) {
+	store := NewMemoryStore()
+	store.saveUser(&User{ID: 5, Name: "Alice_B"})
+	config := &AppConfig{Admins: []int{1}, AdminNames: []string{"alice_b", "bob_smith"}}
+	resolveAdminNames(store, config, logger)
+	if fmt.Sprint(config.Admins) != "[1 5]" || fmt.Sprint(config.AdminNames) != "[bob_smith]" {
+		t.Errorf("admins are %v and %v, want [1 5] and [bob_smith]", config.Admins, config.AdminNames)
+	}
+	resolveAdminNames(store, config, logger)
+	if fmt.Sprint(config.Admins) != "[1 5]" {
+		t.Errorf("admins are %v after the second run, want [1 5]", config.Admins)
+	}
+}
+
+func TestMention(t *testing.T) {
+	store := NewMemoryStore()
+	store.saveUser(&User{ID: 1, Name: "alice_b", FullName: "Alice Brown"})
+	store.saveUser(&User{ID: 2, FullName: "Alexander"})
+	tests := []struct {
+		userID     int
+		name, want string
+	}{
+		{1, "alice_b", "@alice_b"},
+		{2, "Alexander", "Alexander"},
+		{UnknownUserID, "Алиса", "Алиса"},
+		{UnknownUserID, "bob_smith", "bob_smith"},
+	}
+	for _, test := range tests {
+		if got := authorMention(store, test.userID, test.name); got != test.want {
+			t.Errorf("authorMention(%d, %q) = %q, want %q", test.userID, test.name, got, test.want)
+		}
+	}
+	user := &User{ID: 1, FullName: "alice"}
+	if got := user.Mention(); got != "alice" {
+		t.Errorf("mention of a user without username is %q, want %q", got, "alice")
+	}
+}
+
+func TestValidateAppConfigWebhookToken(t *testing.T) {
+	config := defaultAppConfig()
+	config.Webhook = &WebhookSettings{ListenAddr: ":8443", URL: "https://example.org/bot"}
+	err := validateAppConfig(config, map[string]string{}, false)
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("error is %v, want one ConfigError", err)
+	}
+	if configErr, ok := errs[0].(*ConfigError); !ok || configErr.Setting != "Webhook.SecretToken" {
+		t.Fatalf("error is %v, want a ConfigError of Webhook.SecretToken", err)
+	}
+	config.Webhook.SecretToken = "token"
+	if err = validateAppConfig(config, map[string]string{}, false); err != nil {
+		t.Fatal(err)
+	}
+}
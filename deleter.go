@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"strings"
+	"time"
+)
+
+const deletionCheckInterval = 5 * time.Second
+const deletionBatchSize = 50
+const maxDeletionAttempts = 5
+const deletionRetryDelay = 30 * time.Second
+
+// DeletionScheduler deletes bot messages when they are due. Pending deletions
+// live in the store, so they survive restarts, and are run by a single worker
+type DeletionScheduler struct {
+	bot    *tgbotapi.BotAPI
+	store  Store
+	logger *Logger
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+var deletionScheduler *DeletionScheduler
+
+func NewDeletionScheduler(bot *tgbotapi.BotAPI, store Store, logger *Logger) (d *DeletionScheduler) {
+	d = &DeletionScheduler{
+		bot:    bot,
+		store:  store,
+		logger: logger.With("component", "deletions"),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	return
+}
+
+func (d *DeletionScheduler) init() {
+	go d.worker()
+}
+
+// schedules deletion of the message in waitTime seconds, failures go to logger
+func (d *DeletionScheduler) schedule(config tgbotapi.DeleteMessageConfig, waitTime int, logger *Logger) {
+	deletion := &ScheduledDeletion{
+		ChatID:    config.ChatID,
+		MessageID: config.MessageID,
+		Due:       time.Now().Add(time.Duration(waitTime) * time.Second),
+	}
+	_, err := d.store.addDeletion(deletion)
+	if err != nil {
+		logger.Error("Error scheduling deletion", "message_chat_id", config.ChatID,
+			"message_id", config.MessageID, "err", err)
+		return
+	}
+	if waitTime <= 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stops the worker, deletions which are not done yet stay in the store
+func (d *DeletionScheduler) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *DeletionScheduler) worker() {
+	defer close(d.done)
+	ticker := time.NewTicker(deletionCheckInterval)
+	defer ticker.Stop()
+	// deletions which became overdue while the bot was down go first
+	d.runDue()
+	for {
+		select {
+		case <-ticker.C:
+			d.runDue()
+		case <-d.wake:
+			d.runDue()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *DeletionScheduler) runDue() {
+	for {
+		deletions, err := d.store.findDueDeletions(time.Now(), deletionBatchSize)
+		if err != nil {
+			d.logger.Error("Error getting scheduled deletions", "err", err)
+			return
+		}
+		for _, deletion := range deletions {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+			d.run(deletion)
+		}
+		if len(deletions) < deletionBatchSize {
+			return
+		}
+	}
+}
+
+func (d *DeletionScheduler) run(deletion *ScheduledDeletion) {
+	logger := d.logger.With("message_chat_id", deletion.ChatID, "message_id", deletion.MessageID)
+	logger.Debug("Deleting message")
+	err := outbox.delete(d.bot, tgbotapi.DeleteMessageConfig{
+		ChatID:    deletion.ChatID,
+		MessageID: deletion.MessageID,
+	})
+	if err != nil && isTransientError(err) && deletion.Attempts+1 < maxDeletionAttempts {
+		delay := retryDelay(err, deletion.Attempts, deletionRetryDelay)
+		logger.Warn("Error deleting message, retrying", "retry_in", delay, "attempt", deletion.Attempts+1,
+			"err", err)
+		err = d.store.rescheduleDeletion(deletion.ID, time.Now().Add(delay), deletion.Attempts+1)
+		if err != nil {
+			logger.Error("Error rescheduling deletion", "err", err)
+		}
+		return
+	}
+	if err != nil {
+		logger.Warn("Giving up deleting message", "err", err)
+	}
+	err = d.store.deleteDeletion(deletion.ID)
+	if err != nil {
+		logger.Error("Error removing scheduled deletion", "err", err)
+	}
+}
+
+// network failures, flood limits and telegram server errors are worth retrying,
+// the rest (message is already deleted, bot was kicked, ...) won't get better
+func isTransientError(err error) bool {
+	apiErr, ok := err.(tgbotapi.Error)
+	if !ok {
+		return true
+	}
+	if apiErr.RetryAfter > 0 {
+		return true
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "too many requests") ||
+		strings.Contains(message, "internal server error") ||
+		strings.Contains(message, "bad gateway")
+}
+
+// telegram's retry_after if there is one, otherwise base delay doubled on every attempt
+func retryDelay(err error, attempts int, base time.Duration) time.Duration {
+	if apiErr, ok := err.(tgbotapi.Error); ok && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	return base << uint(attempts)
+}
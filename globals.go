@@ -2,35 +2,42 @@ package main
 
 import "errors"
 
-var appConfig *AppConfig
-
 var QuestionDoesntExist = errors.New("Question with such ID doesn't exist")
 var AnswerDoesntExist = errors.New("Answer with such ID doesn't exist")
 var WrongCommandFormat = errors.New("Wrong command format")
 var NotEnoughPermissions = errors.New("User has not enough permission for that action")
 var NoteDoesntExist = errors.New("Note with such ID doesn't exist")
+var WrongChatType = errors.New("Command can't be used in this chat")
 var UknownCommand = errors.New("Unknown command")
 var WrongChatID = errors.New("Wrong chat id")
 var WrongCallbackDataFormat = errors.New("Wrong format of callback data")
+var ForgedCallbackData = errors.New("Callback data signature doesn't match")
+var ExpiredCallbackData = errors.New("Callback data is out of date")
+var CallbackDataTooLong = errors.New("Callback data is longer than telegram accepts")
+var ForeignCallbackData = errors.New("Callback button is bound to another user")
 var WrongValue = errors.New("Wrong value")
-
-var InlineCommands = []string{"list_questions", "list_answers", "list_questions_to_me", "list_answers_to_me",
-	"question", "answer", "delete_answer", "delete_question"}
+var UserDoesntExist = errors.New("User with such ID doesn't exist")
+var UnknownUserChat = errors.New("User hasn't started personal chat with bot")
+var GroupDoesntExist = errors.New("Group with such chat id or name doesn't exist")
+var PendingDoesntExist = errors.New("Temporary message with such tag doesn't exist")
+var GroupNotChosen = errors.New("Group is not chosen and there is no default one")
 
 var MaxSendInlineObjects = 10
+var ListPageSize = 10
 
 const appConfigPath string = "config.json"
 const AllGroupName string = "all"
 const InlineChatID = -1
 const BotMessageSign = "----------------------------------------"
 const MaxShownMessageLength = 64
-const EmptyMessage = "Пустое сообщение"
-const NotExistsMessage = "Данной команды не существует"
-const dateFormat = "Jan 2, 2006 в 3:04pm"
 const inlineTempQuestionStoreTime = 3600
 const cleanQuestionPoolInterval = 1800
-const AllGroupChatID = -1001122437322
+const AllGroupChatID = -1001122437322 // the only group before groups became configurable
+const UnknownUserID = 0
 const CallbackDataDelimiter = "|"
+const MaxCallbackDataLength = 64
+const callbackSignatureSize = 6 // bytes of HMAC kept in callback data
 const CallbackCloseCommand = "close"
+const CallbackOpenCommand = "open"
 const CallbackCancelCommand = "ignore"
 const CallbackAddCommand = "add"
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"strconv"
+	"strings"
+)
+
+const GroupTagPrefix = "#"
+
+// splits "#name rest" into group name and rest, name is empty if there is no tag
+func splitGroupTag(args string) (name string, rest string) {
+	args = strings.TrimSpace(args)
+	if !strings.HasPrefix(args, GroupTagPrefix) {
+		rest = args
+		return
+	}
+	parts := strings.SplitN(args, " ", 2)
+	name = strings.TrimPrefix(parts[0], GroupTagPrefix)
+	if len(parts) == 2 {
+		rest = strings.TrimSpace(parts[1])
+	}
+	return
+}
+
+// group for a command: named one, the group chat it was sent to, the default
+// one from config or the only registered group. chat is nil for inline queries
+func chooseGroup(store Store, chat *tgbotapi.Chat, name string) (g *Group, err error) {
+	if name != "" {
+		g, err = store.findGroupByName(name)
+		return
+	}
+	if chat != nil && !isUserChat(chat) {
+		g, err = store.getGroup(chat.ID)
+		return
+	}
+	if currentConfig().DefaultGroup != "" {
+		g, err = store.findGroupByName(currentConfig().DefaultGroup)
+		return
+	}
+	groups, err := store.findGroups()
+	if err != nil {
+		return
+	}
+	if len(groups) != 1 {
+		err = GroupNotChosen
+		return
+	}
+	g = groups[0]
+	return
+}
+
+// reply for errors of chooseGroup
+func chooseGroupErrorReply(store Store, command string, err error, lang Lang, logger *Logger) (reply string) {
+	switch err {
+	case GroupDoesntExist:
+		reply = tr(lang, "group.not_found_list")
+	case GroupNotChosen:
+		reply = tr(lang, "group.choose", command, groupNames(store, lang, logger))
+	default:
+		logger.Error("Error choosing group", "err", err)
+		reply = tr(lang, "error.db")
+	}
+	return
+}
+
+func groupNames(store Store, lang Lang, logger *Logger) (info string) {
+	groups, err := store.findGroups()
+	if err != nil {
+		logger.Error("Error listing groups", "err", err)
+		return
+	}
+	return listGroups(groups, lang)
+}
+
+func listGroups(groups []*Group, lang Lang) (info string) {
+	if len(groups) == 0 {
+		info = tr(lang, "groups.none")
+		return
+	}
+	groupsInfo := make([]string, len(groups))
+	for ind, g := range groups {
+		groupsInfo[ind] = GroupTagPrefix + g.Name
+	}
+	info = tr(lang, "groups.list", strings.Join(groupsInfo, ", "))
+	return
+}
+
+// chat for notifications about questions to the receiver
+func receiverNotificationChat(store Store, rec *Receiver) (chatID int64, err error) {
+	if !rec.IsGroup() {
+		chatID, err = store.getUserChatID(int(rec.ID))
+		return
+	}
+	g, err := store.getGroup(rec.ID)
+	if err == GroupDoesntExist {
+		// questions of unregistered groups are announced in the chat itself
+		chatID, err = rec.ID, nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	chatID = g.NotificationChat()
+	return
+}
+
+// saves groups from config; without them keeps the single group the bot had before
+func registerConfigGroups(store Store, config *AppConfig) (err error) {
+	for _, g := range config.Groups {
+		if g.Name == "" || g.ChatID >= 0 {
+			err = fmt.Errorf("group %q with chat id %d: name and negative group chat id are required",
+				g.Name, g.ChatID)
+			return
+		}
+		// config gives only the name, admins and the language are changed by commands and kept
+		stored, getErr := store.getGroup(g.ChatID)
+		switch getErr {
+		case nil:
+			stored.Name = g.Name
+		case GroupDoesntExist:
+			stored = &Group{ChatID: g.ChatID, Name: g.Name}
+		default:
+			err = getErr
+			return
+		}
+		err = store.saveGroup(stored)
+		if err != nil {
+			return
+		}
+	}
+	if len(config.Groups) > 0 {
+		return
+	}
+	groups, err := store.findGroups()
+	if err != nil || len(groups) > 0 {
+		return
+	}
+	err = store.saveGroup(&Group{ChatID: AllGroupChatID, Name: AllGroupName})
+	if err != nil {
+		return
+	}
+	return
+}
+
+func registerGroupCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	name, notificationChatID, err := parseSlashRegisterGroup(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	other, err := store.findGroupByName(name)
+	if err == nil && other.ChatID != m.Chat.ID {
+		reply = tr(lang, "group.name_taken")
+		return
+	}
+	g, err := store.getGroup(m.Chat.ID)
+	if err == GroupDoesntExist {
+		g = &Group{ChatID: m.Chat.ID}
+	} else if err != nil {
+		reply = tr(lang, "error.db")
+		return
+	}
+	g.Name = name
+	g.NotificationChatID = notificationChatID
+	err = store.saveGroup(g)
+	if err != nil {
+		logger.Error("Error saving group", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	logger.Info("Group registered", "group", g.Name, "notification_chat_id", g.NotificationChatID)
+	reply = tr(lang, "group.registered", GroupTagPrefix+g.Name)
+	return
+}
+
+func listGroupsCommandExec(store Store, lang Lang, logger *Logger) (reply string, err error) {
+	groups, err := store.findGroups()
+	if err != nil {
+		logger.Error("Error listing groups", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	reply = listGroups(groups, lang)
+	return
+}
+
+// "/group_admin add @user" and "/group_admin remove @user" in the group chat
+func groupAdminCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	add, userName, err := parseSlashGroupAdmin(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	g, err := store.getGroup(m.Chat.ID)
+	if err != nil {
+		if err == GroupDoesntExist {
+			reply = tr(lang, "group.not_registered")
+		} else {
+			reply = tr(lang, "error.db")
+		}
+		return
+	}
+	user, err := store.findUserByName(userName)
+	if err != nil {
+		if err == UserDoesntExist {
+			reply = tr(lang, "user.unknown")
+		} else {
+			reply = tr(lang, "error.db")
+		}
+		return
+	}
+
+	admins := []int{}
+	for _, id := range g.Admins {
+		if id != user.ID {
+			admins = append(admins, id)
+		}
+	}
+	if add {
+		admins = append(admins, user.ID)
+	}
+	g.Admins = admins
+	err = store.saveGroup(g)
+	if err != nil {
+		logger.Error("Error saving group", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	logger.Info("Group admins changed", "group", g.Name, "target_user_id", user.ID, "admin", add)
+	if add {
+		reply = tr(lang, "group.admin_added", user.Mention())
+	} else {
+		reply = tr(lang, "group.admin_removed", user.Mention())
+	}
+	return
+}
+
+// inline reply with one article per group, its button puts the query
+// back into the input field with the group tag added
+func sendChooseGroupReply(bot *tgbotapi.BotAPI, store Store,
+	query *tgbotapi.InlineQuery, command string, args string, lang Lang, logger *Logger) (err error) {
+	groups, err := store.findGroups()
+	if err != nil {
+		logger.Error("Error listing groups", "err", err)
+		return
+	}
+	if len(groups) == 0 {
+		err = sendSimpleStringReply(bot, query.ID, tr(lang, "groups.none"))
+		return
+	}
+
+	var replies []interface{}
+	for id, g := range groups {
+		groupQuery := strings.TrimSpace(fmt.Sprintf("%s %s%s %s",
+			command, GroupTagPrefix, g.Name, args))
+		reply := tgbotapi.NewInlineQueryResultArticle(strconv.Itoa(id),
+			tr(lang, "group.inline_title", g.Name), markAsBotText(tr(lang, "group.inline_chosen", g.Name)))
+		reply.Description = groupQuery
+		button := tgbotapi.InlineKeyboardButton{
+			Text:                         tr(lang, "group.inline_button", g.Name),
+			SwitchInlineQueryCurrentChat: &groupQuery,
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup([]tgbotapi.InlineKeyboardButton{button})
+		reply.ReplyMarkup = &keyboard
+		replies = append(replies, reply)
+	}
+
+	inlineConfig := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		IsPersonal:    true,
+		CacheTime:     0,
+		Results:       replies,
+		NextOffset:    "",
+	}
+	err = answerInlineQuery(bot, inlineConfig)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// group of an inline command, replies itself when the group can't be chosen
+func chooseInlineGroup(bot *tgbotapi.BotAPI, store Store, query *tgbotapi.InlineQuery,
+	command string, groupName string, args string, lang Lang, logger *Logger) (g *Group, err error) {
+	g, err = chooseGroup(store, nil, groupName)
+	switch err {
+	case nil:
+	case GroupNotChosen:
+		sendErr := sendChooseGroupReply(bot, store, query, command, args, lang, logger)
+		if sendErr != nil {
+			logger.Error("Error sending choose group reply", "err", sendErr)
+		}
+	case GroupDoesntExist:
+		sendErr := sendSimpleStringReply(bot, query.ID, tr(lang, "group.not_found"))
+		if sendErr != nil {
+			logger.Error("Error sending no group reply", "err", sendErr)
+		}
+	}
+	return
+}
+
+// "/group_language ru|en|auto" in the group chat, auto lets users' telegram decide
+func groupLanguageCommandExec(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	g, err := store.getGroup(m.Chat.ID)
+	if err != nil {
+		if err == GroupDoesntExist {
+			reply = tr(lang, "group.not_registered")
+		} else {
+			reply = tr(lang, "error.db")
+		}
+		return
+	}
+	arg := strings.TrimSpace(m.CommandArguments())
+	if arg == "" {
+		reply = tr(lang, "group_language.current", langName(g.Lang, lang))
+		return
+	}
+	if !authorize(store, m.From.ID, ActionManageGroup, g.ChatID, logger) {
+		err = NotEnoughPermissions
+		reply = tr(lang, "error.permissions")
+		return
+	}
+	newLang, err := parseLangArg(arg)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	g.Lang = newLang
+	err = store.saveGroup(g)
+	if err != nil {
+		logger.Error("Error saving group", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	// the reply is in the new language unless the admin has chosen own one
+	lang = userLang(store, m.From, m.Chat)
+	reply = tr(lang, "group_language.set", langName(g.Lang, lang))
+	go syncBotCommands(bot, store, logger)
+	return
+}
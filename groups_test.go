@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRegisterConfigGroupsKeepsAdmins(t *testing.T) {
+	for _, factory := range storeFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			store := factory.open(t)
+			defer store.Close()
+			config := &AppConfig{Groups: []*Group{{ChatID: -100, Name: "bio"}}}
+			if err := registerConfigGroups(store, config); err != nil {
+				t.Fatal(err)
+			}
+			// "/group_admin" adds an admin at runtime
+			g, err := store.getGroup(-100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.Admins = append(g.Admins, 42)
+			if err = store.saveGroup(g); err != nil {
+				t.Fatal(err)
+			}
+
+			// restart or reload with a renamed group
+			config.Groups[0].Name = "biology"
+			if err = registerConfigGroups(store, config); err != nil {
+				t.Fatal(err)
+			}
+			g, err = store.getGroup(-100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Name != "biology" {
+				t.Errorf("group name is %q, want %q", g.Name, "biology")
+			}
+			if fmt.Sprint(g.Admins) != "[42]" {
+				t.Errorf("group admins are %v after registerConfigGroups, want [42]", g.Admins)
+			}
+		})
+	}
+}
+
+func TestRegisterConfigGroupsKeepsLang(t *testing.T) {
+	for _, factory := range storeFactories {
+		t.Run(factory.name, func(t *testing.T) {
+			store := factory.open(t)
+			defer store.Close()
+			config := &AppConfig{Groups: []*Group{{ChatID: -100, Name: "bio"}}}
+			if err := registerConfigGroups(store, config); err != nil {
+				t.Fatal(err)
+			}
+			// "/group_language en" in the group chat
+			g, err := store.getGroup(-100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.Lang = LangEn
+			if err = store.saveGroup(g); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = registerConfigGroups(store, config); err != nil {
+				t.Fatal(err)
+			}
+			g, err = store.getGroup(-100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g.Lang != LangEn {
+				t.Errorf("group lang is %q after registerConfigGroups, want %q", g.Lang, LangEn)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"net/url"
+	"strings"
+)
+
+// /help lists commands the user may run, /help <command> describes one of them
+func helpCommandExec(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	name := strings.TrimPrefix(strings.TrimSpace(m.CommandArguments()), "/")
+	if name != "" {
+		c, ok := commandRegistry.lookup(name)
+		if !ok {
+			reply = tr(lang, "help.unknown", name)
+			return
+		}
+		reply = commandHelp(bot, c, lang)
+		return
+	}
+
+	role, err := userRole(store, m.From.ID, commandChat(m.Chat))
+	if err != nil {
+		reply = tr(lang, "error.db")
+		return
+	}
+	lines := []string{}
+	for _, c := range commandRegistry.list() {
+		if !c.allowedFor(role) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", commandUsage(bot, c, lang), c.help(lang)))
+	}
+	lines = append(lines, "", tr(lang, "help.more"))
+	reply = strings.Join(lines, "\n")
+	return
+}
+
+// slash usage or, for inline only commands, the inline one
+func commandUsage(bot *tgbotapi.BotAPI, c *Command, lang Lang) string {
+	if c.Slash == nil {
+		return inlineUsage(bot, c, lang)
+	}
+	return c.usage(lang)
+}
+
+func inlineUsage(bot *tgbotapi.BotAPI, c *Command, lang Lang) string {
+	return fmt.Sprintf("%s %s", inlineMention(bot), strings.TrimPrefix(c.usage(lang), "/"))
+}
+
+// "@<bot username>", before getMe answers the username is unknown
+func inlineMention(bot *tgbotapi.BotAPI) string {
+	if bot.Self.UserName == "" {
+		return "@bot"
+	}
+	return "@" + bot.Self.UserName
+}
+
+// "/name" or, for inline only commands, "@bot name"
+func commandTitle(bot *tgbotapi.BotAPI, c *Command) string {
+	if c.Slash == nil {
+		return inlineMention(bot) + " " + c.Name
+	}
+	return "/" + c.Name
+}
+
+func commandHelp(bot *tgbotapi.BotAPI, c *Command, lang Lang) string {
+	lines := []string{fmt.Sprintf("%s - %s", commandTitle(bot, c), c.help(lang))}
+	if c.Slash != nil {
+		lines = append(lines, tr(lang, "help.usage", c.usage(lang)))
+	}
+	if c.Inline != nil {
+		lines = append(lines, tr(lang, "help.inline", inlineUsage(bot, c, lang)))
+	}
+	if len(c.Aliases) > 0 && c.Slash == nil {
+		lines = append(lines, tr(lang, "help.aliases", strings.Join(c.Aliases, ", ")))
+	} else if len(c.Aliases) > 0 {
+		lines = append(lines, tr(lang, "help.aliases", "/"+strings.Join(c.Aliases, ", /")))
+	}
+	if c.Slash != nil {
+		lines = append(lines, tr(lang, "help.where", chatTypeName(c.Chats, lang)))
+	}
+	lines = append(lines, tr(lang, "help.who", roleName(policy[c.action()], lang)))
+	examples := c.examples(lang)
+	if len(examples) > 0 {
+		lines = append(lines, tr(lang, "help.examples"))
+		for _, example := range examples {
+			lines = append(lines, "    "+strings.Replace(example, "@bot", inlineMention(bot), 1))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func chatTypeName(chats ChatType, lang Lang) string {
+	switch chats {
+	case PrivateChat:
+		return tr(lang, "chats.private")
+	case GroupChat:
+		return tr(lang, "chats.group")
+	default:
+		return tr(lang, "chats.any")
+	}
+}
+
+// who has the role or a higher one
+func roleName(role Role, lang Lang) string {
+	return tr(lang, "role."+role.String())
+}
+
+// BotCommand and BotCommandScope of the bot api, the library doesn't know them
+type botCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+type botCommandScope struct {
+	Type   string `json:"type"`
+	ChatID int64  `json:"chat_id,omitempty"`
+	UserID int    `json:"user_id,omitempty"`
+}
+
+// slash commands allowed in the chats for the role
+func menuCommands(chats ChatType, role Role, lang Lang) (commands []botCommand) {
+	for _, c := range commandRegistry.list() {
+		if c.Slash == nil || !c.allowedFor(role) {
+			continue
+		}
+		allowed := c.Chats
+		if allowed == 0 {
+			allowed = AnyChat
+		}
+		if allowed&chats == 0 {
+			continue
+		}
+		commands = append(commands, botCommand{Command: c.Name, Description: c.help(lang)})
+	}
+	return
+}
+
+// without languageCode the list is shown to users of languages that have no own list
+func setMyCommands(bot *tgbotapi.BotAPI, scope botCommandScope, languageCode string,
+	commands []botCommand) (err error) {
+	commandsJSON, err := json.Marshal(commands)
+	if err != nil {
+		return
+	}
+	scopeJSON, err := json.Marshal(scope)
+	if err != nil {
+		return
+	}
+	v := url.Values{}
+	v.Add("commands", string(commandsJSON))
+	v.Add("scope", string(scopeJSON))
+	if languageCode != "" {
+		v.Add("language_code", languageCode)
+	}
+	err = outbox.call(func() (err error) {
+		_, err = bot.MakeRequest("setMyCommands", v)
+		return
+	})
+	return
+}
+
+// the list without language code is for users of foreign languages
+func menuLanguageCode(lang Lang) string {
+	if lang == ForeignLang {
+		return ""
+	}
+	return string(lang)
+}
+
+// makes telegram's command menu match the registry: one list for private chats,
+// one for groups and lists with more commands for owners and users with granted roles,
+// each in every language. Groups with their own language get the lists in it
+// whatever users' telegram language is
+func syncBotCommands(bot *tgbotapi.BotAPI, store Store, logger *Logger) {
+	set := func(scope botCommandScope, languageCode string, commands []botCommand) {
+		err := setMyCommands(bot, scope, languageCode, commands)
+		if err != nil {
+			logger.Error("Error setting commands", "scope", scope.Type, "scope_chat_id", scope.ChatID,
+				"scope_user_id", scope.UserID, "language_code", languageCode, "err", err)
+		}
+	}
+	roles, err := store.findRoles()
+	if err != nil {
+		logger.Error("Error listing roles", "err", err)
+	}
+	for _, owner := range currentConfig().Admins {
+		roles = append(roles, &UserRole{UserID: owner, Role: RoleOwner})
+	}
+	for _, lang := range Languages {
+		languageCode := menuLanguageCode(lang)
+		set(botCommandScope{Type: "all_private_chats"}, languageCode, menuCommands(PrivateChat, RoleMember, lang))
+		set(botCommandScope{Type: "all_group_chats"}, languageCode, menuCommands(GroupChat, RoleMember, lang))
+		for _, r := range roles {
+			if r.ChatID == 0 && r.Role > RoleMember {
+				// private chat with a user has the id of the user
+				set(botCommandScope{Type: "chat", ChatID: int64(r.UserID)}, languageCode,
+					menuCommands(PrivateChat, r.Role, lang))
+			}
+		}
+	}
+
+	groups, err := store.findGroups()
+	if err != nil {
+		logger.Error("Error listing groups", "err", err)
+	}
+	for _, g := range groups {
+		if g.Lang != "" {
+			set(botCommandScope{Type: "chat", ChatID: g.ChatID}, "", menuCommands(GroupChat, RoleMember, g.Lang))
+		}
+		members := groupRoles(store, g, roles, logger)
+		for _, lang := range Languages {
+			languageCode := menuLanguageCode(lang)
+			if g.Lang != "" {
+				lang = g.Lang
+			}
+			for userID, role := range members {
+				set(botCommandScope{Type: "chat_member", ChatID: g.ChatID, UserID: userID}, languageCode,
+					menuCommands(GroupChat, role, lang))
+			}
+		}
+	}
+	logger.Info("Bot commands are updated")
+}
+
+// roles above member in the group of users with roles there or in all chats
+func groupRoles(store Store, g *Group, roles []*UserRole, logger *Logger) (groupRoles map[int]Role) {
+	groupRoles = make(map[int]Role)
+	users := append(append([]int(nil), g.Admins...), g.ChatAdmins...)
+	for _, r := range roles {
+		if r.ChatID == 0 || r.ChatID == g.ChatID {
+			users = append(users, r.UserID)
+		}
+	}
+	for _, userID := range users {
+		role, err := userRole(store, userID, g.ChatID)
+		if err != nil {
+			logger.Error("Error getting role", "member_id", userID, "group_chat_id", g.ChatID, "err", err)
+			continue
+		}
+		if role > RoleMember {
+			groupRoles[userID] = role
+		}
+	}
+	return
+}
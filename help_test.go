@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"strings"
+	"testing"
+)
+
+func TestCommandHelpInlineOnly(t *testing.T) {
+	bot := &tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "fbb"}}
+	for _, c := range commandRegistry.list() {
+		help := commandHelp(bot, c, LangEn)
+		if c.Slash == nil && (strings.Contains(help, "/"+c.Name) || !strings.HasPrefix(help, "@fbb "+c.Name)) {
+			t.Errorf("help of inline only %s shows a slash command:\n%s", c.Name, help)
+		}
+		if c.Slash != nil && !strings.HasPrefix(help, "/"+c.Name) {
+			t.Errorf("help of %s doesn't start with the slash command:\n%s", c.Name, help)
+		}
+	}
+}
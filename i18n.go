@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"strings"
+	"time"
+)
+
+// Lang is a language of bot replies
+type Lang string
+
+const (
+	LangRu Lang = "ru"
+	LangEn Lang = "en"
+)
+
+// used when nothing is known about the user or the group
+const DefaultLang = LangRu
+
+// for users whose telegram language isn't in the catalog
+const ForeignLang = LangEn
+
+var Languages = []Lang{LangRu, LangEn}
+
+func parseLang(s string) (lang Lang, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, l := range Languages {
+		if string(l) == s {
+			return l, true
+		}
+	}
+	return
+}
+
+// language for telegram's language_code, like "en" or "pt-br"
+func langFromCode(code string) Lang {
+	if code == "" {
+		return DefaultLang
+	}
+	lang, ok := parseLang(strings.SplitN(code, "-", 2)[0])
+	if !ok {
+		return ForeignLang
+	}
+	return lang
+}
+
+// language of replies to the user: the one the user has chosen,
+// default of the group chat or the one of the user's telegram
+func userLang(store Store, from *tgbotapi.User, chat *tgbotapi.Chat) Lang {
+	user, err := store.getUser(from.ID)
+	if err == nil && user.Lang != "" {
+		return user.Lang
+	}
+	if err != nil && err != UserDoesntExist {
+		logger.Error("Error getting user", "user_id", from.ID, "err", err)
+	}
+	if chat != nil && !isUserChat(chat) {
+		g, err := store.getGroup(chat.ID)
+		if err == nil && g.Lang != "" {
+			return g.Lang
+		}
+	}
+	return langFromCode(from.LanguageCode)
+}
+
+// language of notifications sent to a chat, ids of personal chats are ids of their users
+func chatLang(store Store, chatID int64) Lang {
+	if chatID > 0 {
+		user, err := store.getUser(int(chatID))
+		if err != nil {
+			return DefaultLang
+		}
+		if user.Lang != "" {
+			return user.Lang
+		}
+		return langFromCode(user.LanguageCode)
+	}
+	g, err := store.getGroup(chatID)
+	if err != nil || g.Lang == "" {
+		return DefaultLang
+	}
+	return g.Lang
+}
+
+// "auto" is the empty language, which isn't chosen by anyone
+func parseLangArg(arg string) (lang Lang, err error) {
+	if strings.ToLower(arg) == "auto" {
+		return
+	}
+	lang, ok := parseLang(arg)
+	if !ok {
+		err = WrongCommandFormat
+		return
+	}
+	return
+}
+
+// name of language l in language lang
+func langName(l Lang, lang Lang) string {
+	if l == "" {
+		return tr(lang, "lang.auto")
+	}
+	return tr(lang, "lang."+string(l))
+}
+
+// "/language ru|en|auto" sets the language of replies to the user
+func languageCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	arg := strings.TrimSpace(m.CommandArguments())
+	if arg == "" {
+		user, getErr := store.getUser(m.From.ID)
+		var chosen Lang
+		if getErr == nil {
+			chosen = user.Lang
+		}
+		reply = tr(lang, "language.current", langName(chosen, lang))
+		return
+	}
+	newLang, err := parseLangArg(arg)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	err = store.setUserLang(m.From.ID, newLang)
+	if err != nil {
+		logger.Error("Error setting language", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	if newLang == "" {
+		reply = tr(userLang(store, m.From, m.Chat), "language.auto")
+		return
+	}
+	reply = tr(newLang, "language.set")
+	return
+}
+
+func lookupMessage(lang Lang, key string) (text string, ok bool) {
+	texts, ok := catalog[key]
+	if !ok {
+		return
+	}
+	text, ok = texts[lang]
+	if !ok {
+		text, ok = texts[DefaultLang]
+	}
+	return
+}
+
+// message of the catalog, formatted with args if there are any
+func tr(lang Lang, key string, args ...interface{}) string {
+	text, ok := lookupMessage(lang, key)
+	if !ok {
+		logger.Error("Message is missing in the catalog", "key", key)
+		return key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// plural message for count n, n is the first argument of the format
+func trn(lang Lang, key string, n int, args ...interface{}) string {
+	forms, ok := pluralCatalog[key][lang]
+	if !ok {
+		forms, ok = pluralCatalog[key][DefaultLang]
+	}
+	if !ok {
+		logger.Error("Plural message is missing in the catalog", "key", key)
+		return key
+	}
+	return fmt.Sprintf(forms[pluralForm(lang, n)], append([]interface{}{n}, args...)...)
+}
+
+// index of plural form: one, few, many for russian and one, other for english
+func pluralForm(lang Lang, n int) int {
+	if n < 0 {
+		n = -n
+	}
+	if lang != LangRu {
+		if n == 1 {
+			return 0
+		}
+		return 1
+	}
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return 0
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func formatDate(lang Lang, d time.Time) string {
+	return d.Local().Format(tr(lang, "date_format"))
+}
+
+var catalog = map[string]map[Lang]string{
+	"date_format": {LangRu: "02.01.2006 в 15:04", LangEn: "Jan 2, 2006 at 3:04pm"},
+
+	"error.db":          {LangRu: "Ошибка доступа к базе данных", LangEn: "Database access error"},
+	"error.app":         {LangRu: "Ошибка приложения", LangEn: "Application error"},
+	"error.format":      {LangRu: "Неверный формат команды", LangEn: "Wrong command format"},
+	"error.permissions": {LangRu: "Недостаточно прав", LangEn: "Not enough permissions"},
+	"error.question_id": {LangRu: "Неправильный id вопроса", LangEn: "Wrong question id"},
+
+	"command.unknown":      {LangRu: "Неверная команда, список команд: /help", LangEn: "Unknown command, list of commands: /help"},
+	"command.private_only": {LangRu: "Команда доступна только в личном чате с ботом", LangEn: "The command works only in the private chat with the bot"},
+	"command.group_only":   {LangRu: "Команду нужно отправить в чат группы", LangEn: "The command must be sent to the group chat"},
+	"command.usage":        {LangRu: "Неверный формат команды, используйте %s", LangEn: "Wrong command format, use %s"},
+
+	"start": {
+		LangRu: "Привет, я телеграм бот, созданный для управления чатами групп ФББ.\n" +
+			"Я собираю вопросы группы и ответы на них, храню важные заметки.\n" +
+			"Список команд: /help",
+		LangEn: "Hi, I am a telegram bot for the chats of FBB groups.\n" +
+			"I collect questions of the group and answers to them, keep important notes.\n" +
+			"List of commands: /help",
+	},
+
+	"question.accepted":     {LangRu: "Вопрос принят, его id: %d", LangEn: "Question is accepted, its id: %d"},
+	"question.added":        {LangRu: "Вопрос успешно добавлен", LangEn: "Question is added"},
+	"question.closed":       {LangRu: "Вопрос закрыт", LangEn: "Question is closed"},
+	"question.opened":       {LangRu: "Вопрос открыт", LangEn: "Question is open"},
+	"question.reopened":     {LangRu: "Вопрос снова открыт", LangEn: "Question is open again"},
+	"question.already_open": {LangRu: "Вопрос уже открыт", LangEn: "Question is already open"},
+	"question.not_found":    {LangRu: "Вопроса с таким id нет в базе данных", LangEn: "There is no question with such id"},
+	"question.not_found_id": {LangRu: "Вопроса с id %d не существует", LangEn: "Question %d doesn't exist"},
+	"answer.saved":          {LangRu: "Ответ сохранен, его id: %d", LangEn: "Answer is saved, its id: %d"},
+	"answer.not_found":      {LangRu: "Ответа с таким id нет в базе данных", LangEn: "There is no answer with such id"},
+	"note.saved":            {LangRu: "Заметка сохранена, ее id: %d", LangEn: "Note is saved, its id: %d"},
+	"note.deleted":          {LangRu: "Заметка удалена", LangEn: "Note is deleted"},
+	"note.not_found":        {LangRu: "Заметки с таким id нет в базе данных", LangEn: "There is no note with such id"},
+
+	"questions.none":  {LangRu: "Нет вопросов", LangEn: "No questions"},
+	"questions.item":  {LangRu: "[%d] %s спросил %s:\n    %s", LangEn: "[%d] %s asked %s:\n    %s"},
+	"answers.none":    {LangRu: "Нет ответов", LangEn: "No answers"},
+	"answers.header":  {LangRu: "%s на ваш вопрос от %s:\n    %s\n", LangEn: "%s to your question of %s:\n    %s\n"},
+	"answers.item":    {LangRu: "%s ответил %s:\n    %s", LangEn: "%s answered %s:\n    %s"},
+	"notes.none":      {LangRu: "Нет заметок", LangEn: "No notes"},
+	"notes.no_more":   {LangRu: "Больше заметок нет", LangEn: "No more notes"},
+	"notes.item":      {LangRu: "[%d] %s записал %s:\n    %s", LangEn: "[%d] %s noted %s:\n    %s"},
+	"page.next":       {LangRu: "\nСледующая страница: /%s %s%d", LangEn: "\nNext page: /%s %s%d"},
+	"notify.answer":   {LangRu: "На вопрос [%d], заданный %s:\n        \"%s\"\n появился ответ от %s:\n        \"%s\"", LangEn: "Question [%d] asked by %s:\n        \"%s\"\n got an answer from %s:\n        \"%s\""},
+	"notify.question": {LangRu: "%s задал вопрос [%d]:\n\"%s\"", LangEn: "%s asked question [%d]:\n\"%s\""},
+	"notify.closed":   {LangRu: "Ваш вопрос [%d] был закрыт: \n%s", LangEn: "Your question [%d] was closed: \n%s"},
+	"notify.reopened": {LangRu: "Ваш вопрос [%d] был снова открыт: \n%s", LangEn: "Your question [%d] was opened again: \n%s"},
+
+	"callback.forged":       {LangRu: "Кнопка недействительна", LangEn: "The button is invalid"},
+	"callback.expired":      {LangRu: "Кнопка устарела, повторите команду", LangEn: "The button is out of date, repeat the command"},
+	"callback.foreign":      {LangRu: "Эта кнопка предназначена другому пользователю", LangEn: "This button is meant for another user"},
+	"callback.cancelled":    {LangRu: "Команда успешно отменена", LangEn: "The command is cancelled"},
+	"callback.pending_gone": {LangRu: "К сожалению, ваш вопрос был удален из временной базы", LangEn: "Sorry, your question was removed from the temporary storage"},
+
+	"inline.enter":        {LangRu: "Введите команду", LangEn: "Enter a command"},
+	"inline.empty":        {LangRu: "Пустое сообщение", LangEn: "Empty message"},
+	"inline.unknown":      {LangRu: "Данной команды не существует", LangEn: "There is no such command"},
+	"inline.question":     {LangRu: "\nИнформация о вопросе [%d]\nЗадавший: %s\nДата: %s:\nТекст вопроса:\n\"%s\"", LangEn: "\nQuestion [%d]\nAsked by: %s\nDate: %s:\nQuestion text:\n\"%s\""},
+	"inline.answer":       {LangRu: "Информация о ответе %d\nВопрос : %s\nОтветивший: %s\nДата: %s:\nТекст ответа:\n'%s'", LangEn: "Answer %d\nQuestion: %s\nAnswered by: %s\nDate: %s:\nAnswer text:\n'%s'"},
+	"inline.note":         {LangRu: "\nЗаметка [%d]\nАвтор: %s\nДата: %s:\n\"%s\"", LangEn: "\nNote [%d]\nAuthor: %s\nDate: %s:\n\"%s\""},
+	"inline.from":         {LangRu: "От %s, %s", LangEn: "From %s, %s"},
+	"inline.note_title":   {LangRu: "[%d] От %s, %s", LangEn: "[%d] From %s, %s"},
+	"inline.close_button": {LangRu: "Закрыть вопрос", LangEn: "Close question"},
+	"inline.open_button":  {LangRu: "Открыть вопрос", LangEn: "Open question"},
+	"inline.confirm_text": {LangRu: "Нажмите на кнопку, чтобы подтвердить действие", LangEn: "Press the button to confirm the action"},
+	"inline.send":         {LangRu: "Отправить", LangEn: "Send"},
+	"inline.confirm":      {LangRu: "Подтвердить", LangEn: "Confirm"},
+
+	"group.not_found":      {LangRu: "Такой группы нет", LangEn: "There is no such group"},
+	"group.not_found_list": {LangRu: "Такой группы нет, список групп: /list_groups", LangEn: "There is no such group, list of groups: /list_groups"},
+	"group.choose":         {LangRu: "Укажите группу: /%s #название ...\n%s", LangEn: "Choose a group: /%s #name ...\n%s"},
+	"group.name_taken":     {LangRu: "Группа с таким названием уже есть", LangEn: "There is already a group with such name"},
+	"group.registered":     {LangRu: "Чат зарегистрирован как группа %s", LangEn: "The chat is registered as group %s"},
+	"group.not_registered": {LangRu: "Чат не зарегистрирован как группа", LangEn: "The chat isn't registered as a group"},
+	"group.admin_added":    {LangRu: "%s теперь администратор группы", LangEn: "%s is an admin of the group now"},
+	"group.admin_removed":  {LangRu: "%s больше не администратор группы", LangEn: "%s isn't an admin of the group anymore"},
+	"group.inline_title":   {LangRu: "Группа %s", LangEn: "Group %s"},
+	"group.inline_chosen":  {LangRu: "Выберите группу: %s", LangEn: "Choose group: %s"},
+	"group.inline_button":  {LangRu: "Выбрать %s", LangEn: "Choose %s"},
+	"groups.none":          {LangRu: "Нет зарегистрированных групп", LangEn: "No registered groups"},
+	"groups.list":          {LangRu: "Группы: %s", LangEn: "Groups: %s"},
+	"user.unknown":         {LangRu: "Пользователь еще не писал боту", LangEn: "The user hasn't written to the bot yet"},
+
+	"language.current":       {LangRu: "Язык: %s. Сменить: /language ru|en|auto", LangEn: "Language: %s. Change: /language ru|en|auto"},
+	"language.set":           {LangRu: "Теперь я отвечаю вам по-русски", LangEn: "I answer you in English now"},
+	"language.auto":          {LangRu: "Язык выбирается по настройкам Telegram", LangEn: "The language follows your Telegram settings"},
+	"group_language.current": {LangRu: "Язык группы: %s. Сменить: /group_language ru|en|auto", LangEn: "Group language: %s. Change: /group_language ru|en|auto"},
+	"group_language.set":     {LangRu: "Язык группы: %s", LangEn: "Group language: %s"},
+
+	"config.reloading": {LangRu: "Перечитываю настройки…", LangEn: "Reloading config…"},
+	"config.reloaded":  {LangRu: "Настройки обновлены:", LangEn: "Config reloaded:"},
+	"config.unchanged": {LangRu: "Настройки перечитаны, изменений нет", LangEn: "Config reloaded, nothing changed"},
+	"config.failed":    {LangRu: "Настройки не обновлены: %v", LangEn: "Config is not reloaded: %v"},
+	"config.restart":   {LangRu: "Вступят в силу после перезапуска: %s", LangEn: "Apply after restart: %s"},
+	"lang.ru":          {LangRu: "русский", LangEn: "Russian"},
+	"lang.en":          {LangRu: "английский", LangEn: "English"},
+	"lang.auto":        {LangRu: "по настройкам Telegram", LangEn: "from Telegram settings"},
+
+	"help.unknown":   {LangRu: "Команды %s нет, список команд: /help", LangEn: "There is no command %s, list of commands: /help"},
+	"help.more":      {LangRu: "Подробнее о команде: /help <команда>", LangEn: "More about a command: /help <command>"},
+	"help.usage":     {LangRu: "Использование: %s", LangEn: "Usage: %s"},
+	"help.inline":    {LangRu: "В инлайн режиме: %s", LangEn: "Inline: %s"},
+	"help.aliases":   {LangRu: "Синонимы: %s", LangEn: "Aliases: %s"},
+	"help.where":     {LangRu: "Где: %s", LangEn: "Where: %s"},
+	"help.who":       {LangRu: "Кто: %s", LangEn: "Who: %s"},
+	"help.examples":  {LangRu: "Примеры:", LangEn: "Examples:"},
+	"chats.private":  {LangRu: "только личный чат с ботом", LangEn: "only the private chat with the bot"},
+	"chats.group":    {LangRu: "только чат группы", LangEn: "only the group chat"},
+	"chats.any":      {LangRu: "любой чат", LangEn: "any chat"},
+	"role.owner":     {LangRu: "владельцы бота", LangEn: "owners of the bot"},
+	"role.admin":     {LangRu: "администраторы", LangEn: "admins"},
+	"role.moderator": {LangRu: "модераторы", LangEn: "moderators"},
+	"role.member":    {LangRu: "все", LangEn: "everyone"},
+
+	"roles.format":       {LangRu: "Формат: /grant @пользователь admin|moderator|member|banned", LangEn: "Format: /grant @user admin|moderator|member|banned"},
+	"roles.owner_config": {LangRu: "Владельцы бота задаются в настройках", LangEn: "Owners of the bot are set in the config"},
+	"roles.set":          {LangRu: "Роль %s: %s", LangEn: "Role of %s: %s"},
+	"roles.none":         {LangRu: "Ролей здесь никому не выдано", LangEn: "No roles are granted here"},
+
+	"sanction.ban":              {LangRu: "бан", LangEn: "ban"},
+	"sanction.mute":             {LangRu: "мут", LangEn: "mute"},
+	"sanction.ban_notice":       {LangRu: "Вы заблокированы в боте. Причина: %s", LangEn: "You are banned from the bot. Reason: %s"},
+	"sanction.ban_until_notice": {LangRu: "Вы заблокированы в боте до %s. Причина: %s", LangEn: "You are banned from the bot until %s. Reason: %s"},
+	"sanction.mute_notice":      {LangRu: "Вы не можете писать вопросы, ответы и заметки до %s. Причина: %s", LangEn: "You can't post questions, answers and notes until %s. Reason: %s"},
+	"sanction.no_reason":        {LangRu: "не указана", LangEn: "not given"},
+	"sanction.banned":           {LangRu: "%s заблокирован", LangEn: "%s is banned"},
+	"sanction.muted":            {LangRu: "%s не может писать до %s", LangEn: "%s is muted until %s"},
+	"sanction.lifted":           {LangRu: "Ограничения %s сняты", LangEn: "Bans and mutes of %s are lifted"},
+	"sanction.none_active":      {LangRu: "У %s нет действующих ограничений", LangEn: "%s has no active bans or mutes"},
+	"sanctions.none":            {LangRu: "Ограничений нет", LangEn: "No bans or mutes"},
+	"sanctions.line":            {LangRu: "%d. %s %s %s от %s: %s", LangEn: "%d. %s of %s on %s by %s: %s"},
+	"sanctions.until":           {LangRu: ", до %s", LangEn: ", until %s"},
+	"sanctions.lifted":          {LangRu: ", снят %s %s", LangEn: ", lifted by %s on %s"},
+
+	"outbox.stats": {
+		LangRu: "В очереди на отправку: %d в %d чатах\nОтправлено: %d, повторов: %d, не отправлено: %d",
+		LangEn: "Waiting to be sent: %d to %d chats\nSent: %d, retries: %d, given up: %d",
+	},
+	"workers.stats": {
+		LangRu: "Обработчиков: %d, заняты: %d, ждут обработки: %d\nОбработано: %d, ожидание в среднем %v, наибольшее %v",
+		LangEn: "Workers: %d, busy: %d, updates waiting: %d\nHandled: %d, average wait %v, longest %v",
+	},
+	"ratelimit.slow_down": {LangRu: "Слишком много запросов, попробуйте снова через %d с", LangEn: "Too many requests, please try again in %d s"},
+
+	"arg.command":           {LangRu: "команда", LangEn: "command"},
+	"arg.question_id":       {LangRu: "id вопроса", LangEn: "question id"},
+	"arg.answer_id":         {LangRu: "id ответа", LangEn: "answer id"},
+	"arg.note_id":           {LangRu: "id заметки", LangEn: "note id"},
+	"arg.group":             {LangRu: "#группа", LangEn: "#group"},
+	"arg.text":              {LangRu: "текст", LangEn: "text"},
+	"arg.page":              {LangRu: "страница", LangEn: "page"},
+	"arg.state":             {LangRu: "open|closed|all", LangEn: "open|closed|all"},
+	"arg.user":              {LangRu: "пользователь", LangEn: "user"},
+	"arg.important":         {LangRu: "текст или ответ на сообщение", LangEn: "text or reply to a message"},
+	"arg.name":              {LangRu: "название", LangEn: "name"},
+	"arg.notification_chat": {LangRu: "чат для уведомлений", LangEn: "notifications chat"},
+	"arg.admin_action":      {LangRu: "add|remove", LangEn: "add|remove"},
+	"arg.lang":              {LangRu: "ru|en|auto", LangEn: "ru|en|auto"},
+	"arg.role":              {LangRu: "admin|moderator|member|banned", LangEn: "admin|moderator|member|banned"},
+	"arg.reason":            {LangRu: "причина", LangEn: "reason"},
+	"arg.duration":          {LangRu: "срок: 30m, 12h, 7d", LangEn: "duration: 30m, 12h, 7d"},
+
+	// descriptions of commands are "cmd.<name>", their examples are "examples.<name>"
+	// one per line, "@bot" is replaced with the bot's username
+	"cmd.start":                {LangRu: "приветствие", LangEn: "greeting"},
+	"cmd.help":                 {LangRu: "список команд или описание команды", LangEn: "list of commands or description of one"},
+	"cmd.question":             {LangRu: "задать вопрос группе", LangEn: "ask the group a question"},
+	"cmd.question_to":          {LangRu: "задать вопрос пользователю", LangEn: "ask a user a question"},
+	"cmd.answer":               {LangRu: "ответить на вопрос", LangEn: "answer a question"},
+	"cmd.close":                {LangRu: "закрыть вопрос", LangEn: "close a question"},
+	"cmd.open":                 {LangRu: "снова открыть вопрос", LangEn: "open a question again"},
+	"cmd.delete_question":      {LangRu: "удалить вопрос", LangEn: "delete a question"},
+	"cmd.delete_answer":        {LangRu: "удалить ответ", LangEn: "delete an answer"},
+	"cmd.list_questions":       {LangRu: "вопросы группы", LangEn: "questions of the group"},
+	"cmd.list_questions_to_me": {LangRu: "вопросы, заданные вам", LangEn: "questions asked to you"},
+	"cmd.list_answers":         {LangRu: "ответы на вопрос", LangEn: "answers to a question"},
+	"cmd.list_answers_to_me":   {LangRu: "ответы на ваши вопросы", LangEn: "answers to your questions"},
+	"cmd.list_my_questions":    {LangRu: "ваши вопросы", LangEn: "your questions"},
+	"cmd.list_my_answers":      {LangRu: "ваши ответы", LangEn: "your answers"},
+	"cmd.important":            {LangRu: "сохранить важную заметку", LangEn: "save an important note"},
+	"cmd.list_important":       {LangRu: "важные заметки", LangEn: "important notes"},
+	"cmd.delete_important":     {LangRu: "удалить заметку", LangEn: "delete a note"},
+	"cmd.close_my":             {LangRu: "закрыть свой вопрос", LangEn: "close your question"},
+	"cmd.close_to":             {LangRu: "закрыть вопрос, заданный вам", LangEn: "close a question asked to you"},
+	"cmd.a_close":              {LangRu: "закрыть вопрос группы (администраторы группы)", LangEn: "close a question of the group (group admins)"},
+	"cmd.open_my":              {LangRu: "снова открыть свой вопрос", LangEn: "open your question again"},
+	"cmd.open_to":              {LangRu: "снова открыть вопрос, заданный вам", LangEn: "open a question asked to you again"},
+	"cmd.a_open":               {LangRu: "снова открыть вопрос группы (администраторы группы)", LangEn: "open a question of the group again (group admins)"},
+	"cmd.register_group":       {LangRu: "зарегистрировать чат как группу", LangEn: "register the chat as a group"},
+	"cmd.list_groups":          {LangRu: "список групп", LangEn: "list of groups"},
+	"cmd.group_admin":          {LangRu: "назначить или снять администратора группы", LangEn: "add or remove an admin of the group"},
+	"cmd.language":             {LangRu: "язык ответов бота", LangEn: "language of the bot's replies"},
+	"cmd.group_language":       {LangRu: "язык группы по умолчанию (администраторы группы)", LangEn: "default language of the group (group admins)"},
+	"cmd.reload_config":        {LangRu: "перечитать настройки (владельцы бота)", LangEn: "reload config (owners of the bot)"},
+	"cmd.outbox":               {LangRu: "очередь отправки сообщений (владельцы бота)", LangEn: "queue of outgoing messages (owners of the bot)"},
+	"cmd.workers":              {LangRu: "загрузка обработчиков обновлений (владельцы бота)", LangEn: "load of update workers (owners of the bot)"},
+	"cmd.grant":                {LangRu: "выдать роль здесь или, в личном чате, во всех чатах", LangEn: "grant a role here or, in the private chat, in all chats"},
+	"cmd.revoke":               {LangRu: "забрать выданную роль", LangEn: "take back a granted role"},
+	"cmd.roles":                {LangRu: "выданные роли", LangEn: "granted roles"},
+	"cmd.ban":                  {LangRu: "заблокировать пользователя в боте", LangEn: "ban a user from the bot"},
+	"cmd.mute":                 {LangRu: "запретить пользователю писать на время", LangEn: "stop a user from posting for a while"},
+	"cmd.unban":                {LangRu: "снять бан и мут", LangEn: "lift bans and mutes"},
+	"cmd.bans":                 {LangRu: "история банов и мутов", LangEn: "history of bans and mutes"},
+
+	"examples.help": {LangRu: "/help\n/help answer", LangEn: "/help\n/help answer"},
+	"examples.question": {
+		LangRu: "/question Когда дедлайн по практикуму?\n" +
+			"/question #bio2024 Где взять лекции?\n" +
+			"@bot question #bio2024 Где взять лекции?",
+		LangEn: "/question When is the lab deadline?\n" +
+			"/question #bio2024 Where are the lectures?\n" +
+			"@bot question #bio2024 Where are the lectures?",
+	},
+	"examples.question_to": {
+		LangRu: "/question_to @ivanov Скинешь конспект?\n@bot question_to ivanov Скинешь конспект?",
+		LangEn: "/question_to @ivanov Could you share the notes?\n@bot question_to ivanov Could you share the notes?",
+	},
+	"examples.answer": {
+		LangRu: "/answer 12 В пятницу до 23:59\n@bot answer 12 В пятницу до 23:59",
+		LangEn: "/answer 12 On Friday before 23:59\n@bot answer 12 On Friday before 23:59",
+	},
+	"examples.close":           {LangRu: "/close 12", LangEn: "/close 12"},
+	"examples.open":            {LangRu: "/open 12", LangEn: "/open 12"},
+	"examples.delete_question": {LangRu: "/delete_question 12", LangEn: "/delete_question 12"},
+	"examples.delete_answer":   {LangRu: "/delete_answer 7", LangEn: "/delete_answer 7"},
+	"examples.list_questions": {
+		LangRu: "/list_questions\n/list_questions #bio2024\n@bot list_questions #bio2024",
+		LangEn: "/list_questions\n/list_questions #bio2024\n@bot list_questions #bio2024",
+	},
+	"examples.list_answers":      {LangRu: "/list_answers 12\n@bot list_answers 12", LangEn: "/list_answers 12\n@bot list_answers 12"},
+	"examples.list_my_questions": {LangRu: "/list_my_questions\n/list_my_questions closed 2", LangEn: "/list_my_questions\n/list_my_questions closed 2"},
+	"examples.list_my_answers":   {LangRu: "/list_my_answers all", LangEn: "/list_my_answers all"},
+	"examples.important": {
+		LangRu: "/important Экзамен перенесли на 15 июня\nответ на сообщение: /important",
+		LangEn: "/important The exam is moved to June 15\nreply to a message: /important",
+	},
+	"examples.list_important":   {LangRu: "/list_important 2\n@bot list_important", LangEn: "/list_important 2\n@bot list_important"},
+	"examples.delete_important": {LangRu: "/delete_important 3", LangEn: "/delete_important 3"},
+	"examples.a_close":          {LangRu: "@bot a_close #bio2024", LangEn: "@bot a_close #bio2024"},
+	"examples.a_open":           {LangRu: "@bot a_open #bio2024", LangEn: "@bot a_open #bio2024"},
+	"examples.register_group": {
+		LangRu: "/register_group bio2024\n/register_group bio2024 -1001234567890",
+		LangEn: "/register_group bio2024\n/register_group bio2024 -1001234567890",
+	},
+	"examples.group_admin": {
+		LangRu: "/group_admin add @ivanov\n/group_admin remove @ivanov",
+		LangEn: "/group_admin add @ivanov\n/group_admin remove @ivanov",
+	},
+	"examples.language":       {LangRu: "/language\n/language en\n/language auto", LangEn: "/language\n/language ru\n/language auto"},
+	"examples.group_language": {LangRu: "/group_language en", LangEn: "/group_language ru"},
+	"examples.grant":          {LangRu: "/grant @ivanov moderator\n/grant @spammer banned", LangEn: "/grant @ivanov moderator\n/grant @spammer banned"},
+	"examples.revoke":         {LangRu: "/revoke @ivanov", LangEn: "/revoke @ivanov"},
+	"examples.ban":            {LangRu: "/ban @spammer реклама", LangEn: "/ban @spammer ads"},
+	"examples.mute":           {LangRu: "/mute @ivanov 2h флуд\n/mute @ivanov 7d", LangEn: "/mute @ivanov 2h flood\n/mute @ivanov 7d"},
+	"examples.unban":          {LangRu: "/unban @spammer", LangEn: "/unban @spammer"},
+	"examples.bans":           {LangRu: "/bans\n/bans @ivanov 2", LangEn: "/bans\n/bans @ivanov 2"},
+}
+
+// forms are one, few, many for russian and one, other for english
+var pluralCatalog = map[string]map[Lang][]string{
+	"questions.count": {
+		LangRu: {"%d вопрос", "%d вопроса", "%d вопросов"},
+		LangEn: {"%d question", "%d questions"},
+	},
+	"answers.count": {
+		LangRu: {"%d ответ", "%d ответа", "%d ответов"},
+		LangEn: {"%d answer", "%d answers"},
+	},
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -18,9 +17,9 @@ func parseQuery(query string) (command string, commandArgs string) {
 	return
 }
 
-func sendEnterReply(bot *tgbotapi.BotAPI, update *tgbotapi.Update) (err error) {
-	reply := tgbotapi.NewInlineQueryResultArticle("1", "Введите команду",
-		markAsBotText(EmptyMessage))
+func sendEnterReply(bot *tgbotapi.BotAPI, update *tgbotapi.Update, lang Lang) (err error) {
+	reply := tgbotapi.NewInlineQueryResultArticle("1", tr(lang, "inline.enter"),
+		markAsBotText(tr(lang, "inline.empty")))
 	inlineConfig := tgbotapi.InlineConfig{
 		InlineQueryID: update.InlineQuery.ID,
 		IsPersonal:    true,
@@ -28,16 +27,16 @@ func sendEnterReply(bot *tgbotapi.BotAPI, update *tgbotapi.Update) (err error) {
 		Results:       []interface{}{reply},
 		NextOffset:    "",
 	}
-	_, err = bot.AnswerInlineQuery(inlineConfig)
+	err = answerInlineQuery(bot, inlineConfig)
 	if err != nil {
 		return
 	}
 	return
 }
 
-func sendNotExistReply(bot *tgbotapi.BotAPI, update *tgbotapi.Update) (err error) {
-	reply := tgbotapi.NewInlineQueryResultArticle("1", NotExistsMessage,
-		markAsBotText(NotExistsMessage))
+func sendNotExistReply(bot *tgbotapi.BotAPI, update *tgbotapi.Update, lang Lang) (err error) {
+	reply := tgbotapi.NewInlineQueryResultArticle("1", tr(lang, "inline.unknown"),
+		markAsBotText(tr(lang, "inline.unknown")))
 	inlineConfig := tgbotapi.InlineConfig{
 		InlineQueryID: update.InlineQuery.ID,
 		IsPersonal:    true,
@@ -45,7 +44,7 @@ func sendNotExistReply(bot *tgbotapi.BotAPI, update *tgbotapi.Update) (err error
 		Results:       []interface{}{reply},
 		NextOffset:    "",
 	}
-	_, err = bot.AnswerInlineQuery(inlineConfig)
+	err = answerInlineQuery(bot, inlineConfig)
 	if err != nil {
 		return
 	}
@@ -57,28 +56,19 @@ func markAsBotText(in string) (out string) {
 	return
 }
 
-type QuestionToReplyConverter func(q *Question, id int) (reply tgbotapi.InlineQueryResultArticle)
+type QuestionToReplyConverter func(store Store, q *Question, id int, lang Lang) (reply tgbotapi.InlineQueryResultArticle, err error)
 
-func simpleQuestionToReply(q *Question, id int) (reply tgbotapi.InlineQueryResultArticle) {
-	dateText := formatDate(q.Date)
-	replyText := fmt.Sprintf(`
-Информация о вопросе [%d]
-Задавший: @%s
-Дата: %s:
-Текст вопроса:
-"%s"`, q.QuestionID, q.User, dateText, q.Text)
+func simpleQuestionToReply(store Store, q *Question, id int, lang Lang) (reply tgbotapi.InlineQueryResultArticle, err error) {
+	dateText := formatDate(lang, q.Date)
+	replyText := tr(lang, "inline.question", q.QuestionID, authorMention(store, q.UserID, q.User), dateText, q.Text)
 	replyText = markAsBotText(replyText)
 
-	replyTitle := fmt.Sprintf("От @%s в %s", q.User, dateText)
+	replyTitle := tr(lang, "inline.from", authorMention(store, q.UserID, q.User), dateText)
 
 	reply = tgbotapi.NewInlineQueryResultArticle(strconv.Itoa(id),
 		replyTitle, replyText) //"Question"+strconv.Itoa(q.QuestionID))
 
-	if len(q.Text) > MaxShownMessageLength {
-		reply.Description = fmt.Sprintf("%s...", q.Text[:MaxShownMessageLength])
-	} else {
-		reply.Description = q.Text
-	}
+	reply.Description = shortText(q.Text, MaxShownMessageLength)
 	return
 }
 
@@ -104,7 +94,7 @@ func sendEndReply(bot *tgbotapi.BotAPI, queryId string) (err error) {
 		Results:       []interface{}{},
 		NextOffset:    "",
 	}
-	_, err = bot.AnswerInlineQuery(inlineConfig)
+	err = answerInlineQuery(bot, inlineConfig)
 
 	if err != nil {
 		return
@@ -112,20 +102,24 @@ func sendEndReply(bot *tgbotapi.BotAPI, queryId string) (err error) {
 	return
 }
 
-func sendNoQuestionsReply(bot *tgbotapi.BotAPI, queryId string) (err error) {
-	err = sendSimpleStringReply(bot, queryId, "Нет вопросов")
+func sendNoQuestionsReply(bot *tgbotapi.BotAPI, queryId string, lang Lang) (err error) {
+	err = sendSimpleStringReply(bot, queryId, tr(lang, "questions.none"))
 	if err != nil {
-		log.Printf("Error while sending no questions reply %v", err)
 		return
 	}
 	return
 }
 
-func sendChunkQuestionsReply(bot *tgbotapi.BotAPI, queryId string,
-	questions []*Question, offset int, converter QuestionToReplyConverter) (err error) {
+func sendChunkQuestionsReply(bot *tgbotapi.BotAPI, store Store, queryId string,
+	questions []*Question, offset int, converter QuestionToReplyConverter, lang Lang) (err error) {
 	var replies []interface{}
 	for id, q := range questions {
-		replies = append(replies, converter(q, id))
+		var reply tgbotapi.InlineQueryResultArticle
+		reply, err = converter(store, q, id, lang)
+		if err != nil {
+			return
+		}
+		replies = append(replies, reply)
 	}
 
 	inlineConfig := tgbotapi.InlineConfig{
@@ -136,7 +130,7 @@ func sendChunkQuestionsReply(bot *tgbotapi.BotAPI, queryId string,
 		NextOffset:    strconv.Itoa(offset + len(replies)),
 	}
 
-	_, err = bot.AnswerInlineQuery(inlineConfig)
+	err = answerInlineQuery(bot, inlineConfig)
 	if err != nil {
 		return
 	}
@@ -144,27 +138,27 @@ func sendChunkQuestionsReply(bot *tgbotapi.BotAPI, queryId string,
 
 }
 
-func sendQuestionList(bot *tgbotapi.BotAPI,
+func sendQuestionList(bot *tgbotapi.BotAPI, store Store,
 	queryID string, offset int, questions []*Question,
-	converter QuestionToReplyConverter) (err error) {
+	converter QuestionToReplyConverter, lang Lang, logger *Logger) (err error) {
 	if len(questions) == 0 {
 		if offset == 0 {
-			err = sendNoQuestionsReply(bot, queryID)
+			err = sendNoQuestionsReply(bot, queryID, lang)
 			if err != nil {
-				log.Printf("Error while sending no questions reply: %v", err)
+				logger.Error("Error sending no questions reply", "err", err)
 				return
 			}
 			return
 		} else {
 			err = sendEndReply(bot, queryID)
 			if err != nil {
-				log.Printf("Error while sending end reply: %v", err)
+				logger.Error("Error sending end reply", "err", err)
 			}
 			return
 		}
 	}
 
-	err = sendChunkQuestionsReply(bot, queryID, questions, offset, converter)
+	err = sendChunkQuestionsReply(bot, store, queryID, questions, offset, converter, lang)
 	if err != nil {
 		return
 	}
@@ -172,54 +166,45 @@ func sendQuestionList(bot *tgbotapi.BotAPI,
 }
 
 func sendQuestionListReply(bot *tgbotapi.BotAPI,
-	store *SQLStore, queryID string, receiver string, offset_str string) (err error) {
+	store Store, queryID string, receiverID int64, offset_str string, lang Lang, logger *Logger) (err error) {
 	offset, err := convertQueryOffset(offset_str)
 	if err != nil {
-		log.Printf("Error while converting offset: %v", err)
+		logger.Info("Wrong query offset", "offset", offset_str, "err", err)
 		return
 	}
 
-	questions, err := store.findQuestionsTo(receiver, MaxSendInlineObjects, offset)
+	questions, err := store.findQuestionsTo(receiverID, MaxSendInlineObjects, offset)
 	if err != nil {
-		log.Printf("Error accessing sql store: %v", err)
+		logger.Error("Error accessing database", "err", err)
 		return
 	}
-	err = sendQuestionList(bot, queryID, offset, questions, simpleQuestionToReply)
+	err = sendQuestionList(bot, store, queryID, offset, questions, simpleQuestionToReply, lang, logger)
 	if err != nil {
-		log.Printf("Error sending questions: %v", err)
+		logger.Error("Error sending questions", "err", err)
 		return
 	}
 	return
 
 }
 
-func answerToReply(store *SQLStore, a *Answer, id int) (reply tgbotapi.InlineQueryResultArticle) {
+func answerToReply(store Store, a *Answer, id int, lang Lang,
+	logger *Logger) (reply tgbotapi.InlineQueryResultArticle) {
 	q, err := store.getQuestion(a.QuestionID)
 	if err != nil {
-		log.Printf("Error accessing SQL Database %v", err)
+		logger.Error("Error getting question of answer", "answer_id", a.AnswerID, "err", err)
 		return
 	}
 
-	log.Println(a.Date)
-	dateText := formatDate(a.Date)
-	replyText := fmt.Sprintf(`Информация о ответе %d
-Вопрос : %s
-Ответивший: @%s
-Дата: %s:
-Текст ответа:
-'%s'`, a.AnswerID, q.Text, a.User, dateText, a.Text)
+	dateText := formatDate(lang, a.Date)
+	replyText := tr(lang, "inline.answer", a.AnswerID, q.Text, authorMention(store, a.UserID, a.User), dateText, a.Text)
 
 	replyText = markAsBotText(replyText)
 
-	replyTitle := fmt.Sprintf("От @%s в %s", a.User, dateText)
+	replyTitle := tr(lang, "inline.from", authorMention(store, a.UserID, a.User), dateText)
 
 	reply = tgbotapi.NewInlineQueryResultArticle(strconv.Itoa(id),
 		replyTitle, replyText)
-	if len(a.Text) > MaxShownMessageLength {
-		reply.Description = fmt.Sprintf("%s...", a.Text[:MaxShownMessageLength])
-	} else {
-		reply.Description = a.Text
-	}
+	reply.Description = shortText(a.Text, MaxShownMessageLength)
 	return
 }
 
@@ -238,7 +223,7 @@ func sendSimpleStringReply(bot *tgbotapi.BotAPI, queryId string,
 		Results:       []interface{}{reply},
 		NextOffset:    "",
 	}
-	_, err = bot.AnswerInlineQuery(inlineConfig)
+	err = answerInlineQuery(bot, inlineConfig)
 
 	if err != nil {
 		return
@@ -246,16 +231,16 @@ func sendSimpleStringReply(bot *tgbotapi.BotAPI, queryId string,
 	return
 }
 
-func sendNoAnswersReply(bot *tgbotapi.BotAPI, queryID string) (err error) {
-	err = sendSimpleStringReply(bot, queryID, "Нет ответов")
+func sendNoAnswersReply(bot *tgbotapi.BotAPI, queryID string, lang Lang) (err error) {
+	err = sendSimpleStringReply(bot, queryID, tr(lang, "answers.none"))
 	if err != nil {
 		return
 	}
 	return
 }
 
-func sendWrongFormatReply(bot *tgbotapi.BotAPI, queryID string) (err error) {
-	err = sendSimpleStringReply(bot, queryID, "Неправильный формат команды")
+func sendWrongFormatReply(bot *tgbotapi.BotAPI, queryID string, lang Lang) (err error) {
+	err = sendSimpleStringReply(bot, queryID, tr(lang, "error.format"))
 	if err != nil {
 		return
 	}
@@ -274,20 +259,20 @@ func convertQueryOffset(offset_str string) (offset int, err error) {
 	return
 }
 
-func sendListAnswers(bot *tgbotapi.BotAPI, store *SQLStore,
-	queryID string, offset int, answers []*Answer) (err error) {
+func sendListAnswers(bot *tgbotapi.BotAPI, store Store,
+	queryID string, offset int, answers []*Answer, lang Lang, logger *Logger) (err error) {
 	if len(answers) == 0 {
 		if offset == 0 {
-			err = sendNoAnswersReply(bot, queryID)
+			err = sendNoAnswersReply(bot, queryID, lang)
 			if err != nil {
-				log.Printf("Error while sending no answers reply: %v", err)
+				logger.Error("Error sending no answers reply", "err", err)
 				return
 			}
 			return
 		} else {
 			err = sendEndReply(bot, queryID)
 			if err != nil {
-				log.Printf("Error while sending end reply: %v", err)
+				logger.Error("Error sending end reply", "err", err)
 				return
 			}
 			return
@@ -295,19 +280,19 @@ func sendListAnswers(bot *tgbotapi.BotAPI, store *SQLStore,
 	}
 
 
-	err = sendChunkAnswersReply(bot, store, queryID, answers, offset)
+	err = sendChunkAnswersReply(bot, store, queryID, answers, offset, lang, logger)
 	if err != nil {
-		log.Printf("Error while sending chunk of answers: %v", err)
+		logger.Error("Error sending answers", "err", err)
 		return
 	}
 	return
 }
 
-func sendChunkAnswersReply(bot *tgbotapi.BotAPI, store *SQLStore, queryID string,
-	questions []*Answer, offset int) (err error) {
+func sendChunkAnswersReply(bot *tgbotapi.BotAPI, store Store, queryID string,
+	questions []*Answer, offset int, lang Lang, logger *Logger) (err error) {
 	var replies []interface{}
 	for id, a := range questions {
-		replies = append(replies, answerToReply(store, a, id))
+		replies = append(replies, answerToReply(store, a, id, lang, logger))
 	}
 
 
@@ -326,7 +311,7 @@ func sendChunkAnswersReply(bot *tgbotapi.BotAPI, store *SQLStore, queryID string
 		NextOffset:    nextOffset,
 	}
 
-	_, err = bot.AnswerInlineQuery(inlineConfig)
+	err = answerInlineQuery(bot, inlineConfig)
 	if err != nil {
 		return
 	}
@@ -334,250 +319,296 @@ func sendChunkAnswersReply(bot *tgbotapi.BotAPI, store *SQLStore, queryID string
 }
 
 func sendAnswersListReply(bot *tgbotapi.BotAPI,
-	store *SQLStore, queryID string, questionID int, offset_str string) (err error) {
+	store Store, queryID string, questionID int, offset_str string, lang Lang, logger *Logger) (err error) {
 	offset, err := convertQueryOffset(offset_str)
 	if err != nil {
-		log.Printf("Error while converting offset: %v", err)
+		logger.Info("Wrong query offset", "offset", offset_str, "err", err)
 		return
 	}
 
 	answers, err := store.findAnswersFor(questionID, MaxSendInlineObjects, offset)
 	if err != nil {
-		log.Printf("Error accesing sql store: %v", err)
+		logger.Error("Error accessing database", "err", err)
 		return
 	}
 
-	err = sendListAnswers(bot, store, queryID, offset, answers)
+	err = sendListAnswers(bot, store, queryID, offset, answers, lang, logger)
 	if err != nil {
-		log.Printf("Error while sending questions: %v", err)
+		logger.Error("Error sending answers", "err", err)
 		return
 	}
 	return
 }
 
-func sendListAnswersToUserReply(bot *tgbotapi.BotAPI, store *SQLStore,
-	queryID string, user string, offset_str string) (err error) {
+func sendListAnswersToUserReply(bot *tgbotapi.BotAPI, store Store,
+	queryID string, userID int, offset_str string, lang Lang, logger *Logger) (err error) {
 	offset, err := convertQueryOffset(offset_str)
 	if err != nil {
-		log.Printf("Error while converting offset: %v", err)
+		logger.Info("Wrong query offset", "offset", offset_str, "err", err)
+		return
+	}
+	answers, err := store.getAnswersFor(userID, MaxSendInlineObjects, offset)
+
+	if err != nil {
+		logger.Error("Error accessing database", "err", err)
 		return
 	}
-	answers, err := store.getAnswersFor(user, MaxSendInlineObjects, offset)
 
+	err = sendListAnswers(bot, store, queryID, offset, answers, lang, logger)
+	if err != nil {
+		logger.Error("Error sending answers", "err", err)
+	}
+	return
+}
+
+func sendUserAnswersListReply(bot *tgbotapi.BotAPI, store Store,
+	queryID string, userID int, offset_str string, lang Lang, logger *Logger) (err error) {
+	offset, err := convertQueryOffset(offset_str)
+	if err != nil {
+		logger.Info("Wrong query offset", "offset", offset_str, "err", err)
+		return
+	}
+	answers, err := store.findAnswersFrom(userID, OpenQuestions, MaxSendInlineObjects, offset)
 	if err != nil {
-		log.Printf("Error accessing database: %v", err)
+		logger.Error("Error accessing database", "err", err)
 		return
 	}
 
-	err = sendListAnswers(bot, store, queryID, offset, answers)
+	err = sendListAnswers(bot, store, queryID, offset, answers, lang, logger)
 	if err != nil {
-		log.Printf("Error while sending questions: %v", err)
+		logger.Error("Error sending answers", "err", err)
 	}
 	return
 }
 
 func sendUserQuestionListReply(bot *tgbotapi.BotAPI,
-	store *SQLStore, queryID string, user string, offset_str string) (err error) {
+	store Store, queryID string, userID int, offset_str string, lang Lang, logger *Logger) (err error) {
 	offset, err := convertQueryOffset(offset_str)
 	if err != nil {
-		log.Printf("Error while converting offset: %v", err)
+		logger.Info("Wrong query offset", "offset", offset_str, "err", err)
 		return
 	}
 
-	questions, err := store.findQuestionsFrom(user, MaxSendInlineObjects, offset)
+	questions, err := store.findQuestionsFrom(userID, MaxSendInlineObjects, offset)
 	if err != nil {
-		log.Printf("Error accessing sql store: %v", err)
+		logger.Error("Error accessing database", "err", err)
 		return
 	}
-	err = sendQuestionList(bot, queryID, offset, questions, simpleQuestionToReply)
+	err = sendQuestionList(bot, store, queryID, offset, questions, simpleQuestionToReply, lang, logger)
 	if err != nil {
-		log.Printf("Error sending questions: %v", err)
+		logger.Error("Error sending questions", "err", err)
 		return
 	}
 	return
 }
 
-func processInlineQuery(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store *SQLStore) (err error) {
-	query := update.InlineQuery.Query
-	log.Printf("[%s] inline %s\n", update.InlineQuery.From.UserName, query)
+func noteToReply(store Store, n *Note, id int, lang Lang) (reply tgbotapi.InlineQueryResultArticle) {
+	dateText := formatDate(lang, n.Date)
+	replyText := tr(lang, "inline.note", n.NoteID, authorMention(store, n.UserID, n.User), dateText, n.Text)
+	replyText = markAsBotText(replyText)
 
-	if query == "" {
-		err = sendEnterReply(bot, update)
-		if err != nil {
-			log.Printf("Error while sending enter reply: %v", err)
-			return
-		}
+	replyTitle := tr(lang, "inline.note_title", n.NoteID, authorMention(store, n.UserID, n.User), dateText)
+
+	reply = tgbotapi.NewInlineQueryResultArticle(strconv.Itoa(id),
+		replyTitle, replyText)
+
+	reply.Description = shortText(n.Text, MaxShownMessageLength)
+	return
+}
+
+func sendNotesListReply(bot *tgbotapi.BotAPI, store Store,
+	queryID string, offset_str string, lang Lang, logger *Logger) (err error) {
+	offset, err := convertQueryOffset(offset_str)
+	if err != nil {
+		logger.Info("Wrong query offset", "offset", offset_str, "err", err)
 		return
 	}
-	command, commandArgs := parseQuery(query)
 
-	switch command {
-	case "list_questions":
-		err = sendQuestionListReply(bot, store, update.InlineQuery.ID, AllGroupName,
-			update.InlineQuery.Offset)
-		if err != nil {
-			log.Printf("Error while sending questions list reply: %v", err)
-			return
-		}
+	notes, err := store.findNotes(MaxSendInlineObjects, offset)
+	if err != nil {
+		logger.Error("Error accessing database", "err", err)
 		return
+	}
 
-	case "list_questions_to_me":
-		err = sendQuestionListReply(bot, store, update.InlineQuery.ID,
-			update.InlineQuery.From.UserName, update.InlineQuery.Offset)
-		if err != nil {
-			log.Printf("Error while sending questions list reply: %v", err)
-			return
+	if len(notes) == 0 {
+		if offset == 0 {
+			err = sendSimpleStringReply(bot, queryID, tr(lang, "notes.none"))
+		} else {
+			err = sendEndReply(bot, queryID)
 		}
 		return
-	case "list_answers":
-		var questionID int
-		questionID, err = parseListAnswersArgs(commandArgs)
-		if err != nil {
-			err = sendWrongFormatReply(bot, update.InlineQuery.ID)
-			if err != nil {
-				log.Printf("Error while sending bad command format reply")
-				return
-			}
-			return
-		}
-		err = sendAnswersListReply(bot, store, update.InlineQuery.ID,
-			questionID, update.InlineQuery.Offset)
-		if err != nil {
-			log.Printf("Error while sending answers list reply: %v", err)
-			return
-		}
+	}
+
+	var replies []interface{}
+	for id, n := range notes {
+		replies = append(replies, noteToReply(store, n, id, lang))
+	}
+
+	var nextOffset string
+	if len(replies) == MaxSendInlineObjects {
+		nextOffset = strconv.Itoa(offset + len(replies))
+	}
+
+	inlineConfig := tgbotapi.InlineConfig{
+		InlineQueryID: queryID,
+		IsPersonal:    true,
+		CacheTime:     0,
+		Results:       replies,
+		NextOffset:    nextOffset,
+	}
+	err = answerInlineQuery(bot, inlineConfig)
+	if err != nil {
 		return
+	}
+	return
+}
 
-	case "list_answers_to_me":
-		err = sendListAnswersToUserReply(bot, store, update.InlineQuery.ID,
-			update.InlineQuery.From.UserName, update.InlineQuery.Offset)
+func sendCloseReply(bot *tgbotapi.BotAPI, store Store,
+	query *tgbotapi.InlineQuery, accessType string, lang Lang, logger *Logger) (err error) {
+	var group *Group
+	if accessType == "admin" {
+		group, err = chooseAdminInlineGroup(bot, store, query, lang, logger)
 		if err != nil {
-			log.Printf("Error while sending answers list reply %v", err)
 			return
 		}
+	}
+
+	offset, err := convertQueryOffset(query.Offset)
+	if err != nil {
+		logger.Info("Wrong query offset", "offset", query.Offset, "err", err)
 		return
-	case "list_my_questions":
-		err = sendUserQuestionListReply(bot,
-			store, update.InlineQuery.ID, update.InlineQuery.From.UserName, update.InlineQuery.Offset)
-		if err != nil {
-			log.Printf("Error sending list_my_questions reply")
-		}
-		return
-	case "question":
-		err = sendAddQuestionToAllReply(bot, update.InlineQuery)
-		if err != nil {
-			log.Printf("Error sending question reply: %v", err)
-		}
-		return
-	case "question_to":
-		err = sendAddQuestionToUserReply(bot, update.InlineQuery)
-		if err != nil {
-			log.Printf("Error sending question_to reply: %v", err)
-		}
-		return
-	case "answer":
-		err = sendAddAnswerReply(bot, update.InlineQuery)
-		if err != nil {
-			log.Printf("Error sending answer reply: %v", err)
-		}
-		return
-	case "close_my":
-		err = sendCloseReply(bot, store, update.InlineQuery, "my")
-		if err != nil {
-			log.Printf("Error sending close_my reply: %v", err)
-		}
+	}
+
+	var questions []*Question
+	switch accessType {
+	case "my":
+		questions, err = store.findQuestionsFrom(query.From.ID, MaxSendInlineObjects, offset)
+	case "to":
+		questions, err = store.findQuestionsTo(int64(query.From.ID), MaxSendInlineObjects, offset)
+	case "admin":
+		questions, err = store.findQuestionsTo(group.ChatID, MaxSendInlineObjects, offset)
+	default:
+		err = WrongValue
+		logger.Error("Wrong access type", "access_type", accessType)
 		return
-	case "close_to":
-		err = sendCloseReply(bot, store, update.InlineQuery, "to")
-		if err != nil {
-			log.Printf("Error sending close_to reply: %v", err)
-		}
+	}
+
+	if err != nil {
+		logger.Error("Error accessing database", "err", err)
 		return
-	case "a_close":
+	}
 
-		err = sendCloseReply(bot, store, update.InlineQuery, "admin")
+	converter := func(store Store, q *Question, id int, lang Lang) (reply tgbotapi.InlineQueryResultArticle, err error) {
+		reply, err = simpleQuestionToReply(store, q, id, lang)
 		if err != nil {
-			log.Printf("Error sending a_close reply: %v", err)
+			return
 		}
-		return
-	case "open_my":
-		fallthrough
-	case "open_to":
-		fallthrough
-	case "a_open":
-		fallthrough
-	default:
-		err = sendNotExistReply(bot, update)
+		yesTag, err := makeCallbackData(CallbackCloseCommand, strconv.Itoa(q.QuestionID), 0)
 		if err != nil {
-			log.Printf("Error while sending not exists reply")
 			return
 		}
+		appendReply(&reply, yesTag, tr(lang, "inline.close_button"))
+		return
+	}
+
+	err = sendQuestionList(bot, store, query.ID, offset, questions, converter, lang, logger)
+	if err != nil {
+		logger.Error("Error sending question list", "err", err)
 		return
 	}
 	return
 }
 
-func sendCloseReply(bot *tgbotapi.BotAPI, store *SQLStore,
-	query *tgbotapi.InlineQuery, accessType string) (err error) {
-	if !inGroup(appConfig.Admins, query.From.UserName) {
-		sendSimpleStringReply(bot, query.ID, "Недостаточные права")
-		err = NotEnoughPermissions
-		return
+func sendOpenReply(bot *tgbotapi.BotAPI, store Store,
+	query *tgbotapi.InlineQuery, accessType string, lang Lang, logger *Logger) (err error) {
+	var group *Group
+	if accessType == "admin" {
+		group, err = chooseAdminInlineGroup(bot, store, query, lang, logger)
+		if err != nil {
+			return
+		}
 	}
 
 	offset, err := convertQueryOffset(query.Offset)
 	if err != nil {
-		log.Printf("Error converting query offset")
+		logger.Info("Wrong query offset", "offset", query.Offset, "err", err)
 		return
 	}
 
 	var questions []*Question
 	switch accessType {
 	case "my":
-		questions, err = store.findQuestionsFrom(query.From.UserName, MaxSendInlineObjects, offset)
+		questions, err = store.findQuestionsFromByState(query.From.ID, ClosedQuestions,
+			MaxSendInlineObjects, offset)
 	case "to":
-		questions, err = store.findQuestionsTo(query.From.UserName, MaxSendInlineObjects, offset)
+		questions, err = store.findQuestionsToByState(int64(query.From.ID), ClosedQuestions,
+			MaxSendInlineObjects, offset)
 	case "admin":
-		questions, err = store.findQuestionsTo(AllGroupName, MaxSendInlineObjects, offset)
+		questions, err = store.findQuestionsToByState(group.ChatID, ClosedQuestions,
+			MaxSendInlineObjects, offset)
 	default:
 		err = WrongValue
-		log.Printf("Wrong value for accessType: %v", accessType)
+		logger.Error("Wrong access type", "access_type", accessType)
 		return
 	}
 
 	if err != nil {
-		log.Printf("Error accesing database: %v", err)
+		logger.Error("Error accessing database", "err", err)
 		return
 	}
 
-	converter := func(q *Question, id int) (reply tgbotapi.InlineQueryResultArticle) {
-		reply = simpleQuestionToReply(q, id)
-		yesTag := makeCallbackData(CallbackCloseCommand, strconv.Itoa(q.QuestionID))
-		appendReply(&reply, yesTag, "Закрыть вопрос")
+	converter := func(store Store, q *Question, id int, lang Lang) (reply tgbotapi.InlineQueryResultArticle, err error) {
+		reply, err = simpleQuestionToReply(store, q, id, lang)
+		if err != nil {
+			return
+		}
+		yesTag, err := makeCallbackData(CallbackOpenCommand, strconv.Itoa(q.QuestionID), 0)
+		if err != nil {
+			return
+		}
+		appendReply(&reply, yesTag, tr(lang, "inline.open_button"))
 		return
 	}
 
-	err = sendQuestionList(bot, query.ID, offset, questions, converter)
+	err = sendQuestionList(bot, store, query.ID, offset, questions, converter, lang, logger)
 	if err != nil {
-		log.Println("Error sending question list")
+		logger.Error("Error sending question list", "err", err)
 		return
 	}
 	return
 }
 
-func sendAddAnswerReply(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery) (err error) {
+// group for a_close and a_open, which only its moderators may use
+func chooseAdminInlineGroup(bot *tgbotapi.BotAPI, store Store,
+	query *tgbotapi.InlineQuery, lang Lang, logger *Logger) (group *Group, err error) {
+	command, args := parseQuery(query.Query)
+	groupName, _ := splitGroupTag(args)
+	group, err = chooseInlineGroup(bot, store, query, command, groupName, "", lang, logger)
+	if err != nil {
+		return
+	}
+	if !authorize(store, query.From.ID, ActionCloseQuestion, group.ChatID, logger) {
+		sendSimpleStringReply(bot, query.ID, tr(lang, "error.permissions"))
+		err = NotEnoughPermissions
+		return
+	}
+	return
+}
+
+func sendAddAnswerReply(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, lang Lang,
+	logger *Logger) (err error) {
 	answer, err := parseAnswerQuery(query)
 	if err != nil {
-		err = sendWrongFormatReply(bot, query.ID)
+		err = sendWrongFormatReply(bot, query.ID, lang)
 		if err != nil {
-			log.Printf("Error while sending wrong format query: %v", err)
+			logger.Error("Error sending wrong format reply", "err", err)
 		}
 		return
 	}
 
-	err = sendAddMessageReply(bot, query.ID, answer)
+	err = sendAddMessageReply(bot, query, answer, lang, logger)
 	if err != nil {
-		log.Printf("Error sending answer inline query :%v", err)
+		logger.Error("Error sending confirmation reply", "err", err)
 		return
 	}
 	return
@@ -596,7 +627,8 @@ func parseAnswerQuery(query *tgbotapi.InlineQuery) (answer *Answer, err error) {
 	}
 	answer = &Answer{
 		AnswerID:   -1,
-		User:       query.From.UserName,
+		UserID:     query.From.ID,
+		User:       userDisplayName(query.From),
 		Text:       args_lst[1],
 		Date:       time.Now(),
 		QuestionID: questionID,
@@ -605,68 +637,84 @@ func parseAnswerQuery(query *tgbotapi.InlineQuery) (answer *Answer, err error) {
 
 }
 
-func sendAddQuestionToUserReply(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery) (err error) {
+func sendAddQuestionToUserReply(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, lang Lang,
+	logger *Logger) (err error) {
 	question, err := parseQuestionToQuery(query)
 	if err != nil {
-		err = sendWrongFormatReply(bot, query.ID)
+		err = sendWrongFormatReply(bot, query.ID, lang)
 		if err != nil {
-			log.Printf("Error while sending wrong format query: %v", err)
+			logger.Error("Error sending wrong format reply", "err", err)
 		}
 		return
 	}
 
-	err = sendAddMessageReply(bot, query.ID, question)
+	err = sendAddMessageReply(bot, query, question, lang, logger)
 	if err != nil {
-		log.Printf("Error sending answer inline query :%v", err)
+		logger.Error("Error sending confirmation reply", "err", err)
 		return
 	}
 	return
 }
 
-func sendAddQuestionToAllReply(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery) (err error) {
-	question, err := parseQuestionQuery(query)
+func sendAddQuestionToGroupReply(bot *tgbotapi.BotAPI, store Store, query *tgbotapi.InlineQuery,
+	lang Lang, logger *Logger) (err error) {
+	question, groupName, err := parseQuestionQuery(query)
 	if err != nil {
-		err = sendWrongFormatReply(bot, query.ID)
+		err = sendWrongFormatReply(bot, query.ID, lang)
 		if err != nil {
-			log.Printf("Error while sending wrong format query: %v", err)
+			logger.Error("Error sending wrong format reply", "err", err)
 		}
 		return
 	}
+	group, err := chooseInlineGroup(bot, store, query, "question", groupName, question.Text, lang, logger)
+	if err != nil {
+		return
+	}
+	question.Rec = NewGroupReceiver(group)
 
-	err = sendAddMessageReply(bot, query.ID, question)
+	err = sendAddMessageReply(bot, query, question, lang, logger)
 	if err != nil {
-		log.Printf("Error sending answer inline query :%v", err)
+		logger.Error("Error sending confirmation reply", "err", err)
 		return
 	}
 
 	return
 }
 
-func sendAddMessageReply(bot *tgbotapi.BotAPI, queryID string, message Message) (err error) {
-	tag := messagePull.addMessage(message)
-	log.Println(tag)
-	data := makeCallbackData(CallbackAddCommand, tag)
+// confirmation button can be pressed only by the author of the query
+func sendAddMessageReply(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, message Message,
+	lang Lang, logger *Logger) (err error) {
+	tag, err := messagePull.addMessage(message)
+	if err != nil {
+		logger.Error("Error saving temporary message", "err", err)
+		return
+	}
+	data, err := makeCallbackData(CallbackAddCommand, tag, query.From.ID)
+	if err != nil {
+		logger.Error("Error making confirmation button", "err", err)
+		return
+	}
 
-	messageText := fmt.Sprintf(markAsBotText("Нажмите на кнопку, чтобы подтвердить действие"))
+	messageText := markAsBotText(tr(lang, "inline.confirm_text"))
 
 	reply := tgbotapi.NewInlineQueryResultArticle("1",
-		"Отправить", messageText)
+		tr(lang, "inline.send"), messageText)
 
 	replyMarkup := tgbotapi.NewInlineKeyboardMarkup([]tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("Подтвердить",
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "inline.confirm"),
 			data)})
 
 	reply.ReplyMarkup = &replyMarkup
 
 	inlineConfig := tgbotapi.InlineConfig{
-		InlineQueryID: queryID,
+		InlineQueryID: query.ID,
 		IsPersonal:    true,
 		CacheTime:     0,
 		Results:       []interface{}{reply},
 		NextOffset:    "",
 	}
 
-	_, err = bot.AnswerInlineQuery(inlineConfig)
+	err = answerInlineQuery(bot, inlineConfig)
 	if err != nil {
 
 		return
@@ -674,17 +722,19 @@ func sendAddMessageReply(bot *tgbotapi.BotAPI, queryID string, message Message)
 	return
 }
 
-func parseQuestionQuery(query *tgbotapi.InlineQuery) (question *Question, err error) {
-	_, questionText := parseQuery(query.Query)
+// "question [#group] text", receiver is set once the group is chosen
+func parseQuestionQuery(query *tgbotapi.InlineQuery) (question *Question, groupName string, err error) {
+	_, args := parseQuery(query.Query)
+	groupName, questionText := splitGroupTag(args)
 	if strings.TrimSpace(questionText) == "" {
 		err = WrongCommandFormat
 		return
 	}
 	question = &Question{
-		User:       query.From.UserName,
+		UserID:     query.From.ID,
+		User:       userDisplayName(query.From),
 		Text:       questionText,
 		Date:       time.Now().UTC(),
-		Rec:        &Receiver{AllGroupName},
 		Answers:    []*Answer{},
 		IsClosed:   false,
 		ChatID:     -1,
@@ -708,10 +758,11 @@ func parseQuestionToQuery(query *tgbotapi.InlineQuery) (question *Question, err
 	}
 
 	question = &Question{
-		User:       query.From.UserName,
+		UserID:     query.From.ID,
+		User:       userDisplayName(query.From),
 		Text:       questionText,
 		Date:       time.Now().UTC(),
-		Rec:        &Receiver{questionRecName},
+		Rec:        NewReceiver(UnknownUserID, questionRecName),
 		Answers:    []*Answer{},
 		IsClosed:   false,
 		ChatID:     InlineChatID,
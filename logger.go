@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// LogLevel is how important a log line is, lines below AppConfig.LogLevel are dropped
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l LogLevel) String() string {
+	name, ok := logLevelNames[l]
+	if !ok {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return name
+}
+
+func parseLogLevel(s string) (level LogLevel, err error) {
+	for l, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			level = l
+			return
+		}
+	}
+	err = WrongValue
+	return
+}
+
+const (
+	LogFormatLogfmt = "logfmt"
+	LogFormatJSON   = "json"
+)
+
+// RedactedText is text written by users, lines show only its length unless the level is debug
+type RedactedText string
+
+// Logger writes lines of a level, a message and key value pairs. Loggers made with With
+// add their pairs to every line, so lines of one update can be found by update_id
+type Logger struct {
+	fields []interface{}
+}
+
+var logger = &Logger{}
+
+var (
+	logOutput     io.Writer = os.Stderr
+	logOutputLock sync.Mutex
+)
+
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+	return &Logger{fields: fields}
+}
+
+func (l *Logger) Debug(msg string, keyValues ...interface{}) { l.write(LevelDebug, msg, keyValues) }
+func (l *Logger) Info(msg string, keyValues ...interface{})  { l.write(LevelInfo, msg, keyValues) }
+func (l *Logger) Warn(msg string, keyValues ...interface{})  { l.write(LevelWarn, msg, keyValues) }
+func (l *Logger) Error(msg string, keyValues ...interface{}) { l.write(LevelError, msg, keyValues) }
+
+// Fatal writes an error line and exits
+func (l *Logger) Fatal(msg string, keyValues ...interface{}) {
+	l.write(LevelError, msg, keyValues)
+	os.Exit(1)
+}
+
+// level and format of the current config, before it is loaded everything but debug goes as logfmt
+func logSettings() (level LogLevel, format string) {
+	level, format = LevelInfo, LogFormatLogfmt
+	config := currentConfig()
+	if config == nil {
+		return
+	}
+	parsed, err := parseLogLevel(config.LogLevel)
+	if err == nil {
+		level = parsed
+	}
+	if config.LogFormat != "" {
+		format = config.LogFormat
+	}
+	return
+}
+
+func (l *Logger) write(level LogLevel, msg string, keyValues []interface{}) {
+	minLevel, format := logSettings()
+	if level < minLevel {
+		return
+	}
+	pairs := []interface{}{"time", time.Now().Format(time.RFC3339), "level", level.String(), "msg", msg}
+	pairs = append(pairs, l.fields...)
+	pairs = append(pairs, keyValues...)
+	if len(pairs)%2 != 0 {
+		pairs = append(pairs, "(missing)")
+	}
+	for ind := 1; ind < len(pairs); ind += 2 {
+		pairs[ind] = logValue(pairs[ind], minLevel)
+	}
+	var line string
+	if format == LogFormatJSON {
+		line = formatJSONLine(pairs)
+	} else {
+		line = formatLogfmtLine(pairs)
+	}
+	logOutputLock.Lock()
+	defer logOutputLock.Unlock()
+	io.WriteString(logOutput, line+"\n")
+}
+
+func logValue(value interface{}, minLevel LogLevel) interface{} {
+	switch v := value.(type) {
+	case RedactedText:
+		if minLevel > LevelDebug {
+			return fmt.Sprintf("<%d chars>", utf8.RuneCountInString(string(v)))
+		}
+		return string(v)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+func formatLogfmtLine(pairs []interface{}) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for ind := 0; ind < len(pairs); ind += 2 {
+		value := fmt.Sprintf("%v", pairs[ind+1])
+		if value == "" || strings.ContainsAny(value, " \"=\n\t") {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, fmt.Sprintf("%v=%s", pairs[ind], value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// keys keep their order, so lines read the same in both formats
+func formatJSONLine(pairs []interface{}) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for ind := 0; ind < len(pairs); ind += 2 {
+		key, _ := json.Marshal(fmt.Sprintf("%v", pairs[ind]))
+		value, err := json.Marshal(pairs[ind+1])
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprintf("%v", pairs[ind+1]))
+		}
+		parts = append(parts, string(key)+":"+string(value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// lines of the standard log package come only from libraries, the bot
+// itself logs through Logger. They are warnings, libraries log their failures
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (n int, err error) {
+	logger.write(LevelWarn, strings.TrimRight(string(p), "\n"), []interface{}{"source", "log"})
+	return len(p), nil
+}
+
+func setupLogging() {
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{})
+}
@@ -1,75 +1,287 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
-	"io/ioutil"
-	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 )
 
-func readAppConfig() (config *AppConfig, err error) {
-	config_json, err := ioutil.ReadFile(appConfigPath)
-	if err != nil {
+var messagePull *MessagePull
+
+var migrateStatus = flag.Bool("migrate-status", false,
+	"print database schema version and pending migrations, then exit")
+var migrateDryRun = flag.Bool("migrate-dry-run", false,
+	"apply pending migrations and roll them back, then exit")
+
+// handles -migrate-status and -migrate-dry-run, reports whether the bot should exit
+func runMigrationMode(config *AppConfig) (exit bool) {
+	if !*migrateStatus && !*migrateDryRun {
 		return
 	}
-
-	config = new(AppConfig)
-	err = json.Unmarshal(config_json, config)
-	if err != nil {
+	exit = true
+	if config.DBDriver == MemoryDriver {
+		logger.Info("Memory store has no schema to migrate")
 		return
 	}
+	store, err := OpenSQLStore(config.DBDriver, config.DBSource)
+	if err != nil {
+		logger.Fatal("Error opening database", "err", err)
+	}
+	defer store.Close()
+	if *migrateStatus {
+		status, err := store.migrationStatus()
+		if err != nil {
+			logger.Fatal("Error reading migration status", "err", err)
+		}
+		printMigrationStatus(status)
+	}
+	if *migrateDryRun {
+		err = store.migrate(true)
+		if err != nil {
+			logger.Fatal("Error in migration dry run", "err", err)
+		}
+	}
 	return
 }
 
-var messagePull *MessagePull
-
-func init() {
-	var err error
-	log.Println("Loading app config")
-	appConfig, err = readAppConfig()
+func main() {
+	flag.Parse()
+	setupLogging()
+	logger.Info("Loading app config")
+	config, err := loadAppConfig(!*migrateStatus && !*migrateDryRun)
+	if err != nil {
+		logger.Fatal("Error loading config", "err", err)
+	}
+	setAppConfig(config)
+	if runMigrationMode(config) {
+		return
+	}
+	store, err := NewStore(config)
+	if err != nil {
+		logger.Fatal("Error opening store", "err", err)
+	}
+	resolveAdminNames(store, config, logger)
+	err = registerConfigGroups(store, config)
+	if err != nil {
+		store.Close()
+		logger.Fatal("Error registering groups", "err", err)
+	}
+	pendingStore, err := NewPendingStore(config, store)
 	if err != nil {
-		log.Printf("Error occured at init : %v", err)
-		log.Fatal("Cant run app due to fatal errors during init")
+		store.Close()
+		logger.Fatal("Unknown PendingStore", "pending_store", config.PendingStore, "err", err)
 	}
-	messagePull = NewMessagePull(cleanQuestionPoolInterval, inlineTempQuestionStoreTime)
+	messagePull = NewMessagePull(pendingStore, config.PendingCleanInterval,
+		config.PendingTTL, config.PendingLimit)
 	messagePull.init()
-}
+	bot, err := tgbotapi.NewBotAPI(config.TelegramBotToken)
+	if err != nil {
+		store.Close()
+		logger.Fatal("Error connecting to telegram", "err", err)
+	}
 
-func main() {
-	sqlstore, err := NewSQLStore("botbase.sql")
+	logger.Info("Authorized", "account", bot.Self.UserName)
+
+	outbox = NewOutbox()
+	outbox.init()
+	deletionScheduler = NewDeletionScheduler(bot, store, logger)
+	deletionScheduler.init()
+	chatAdminsSync = NewChatAdminsSync(bot, store, config.AdminSyncInterval, logger)
+	chatAdminsSync.init()
+	updatePool = NewUpdatePool(bot, store, config.Workers, config.WorkerQueueSize)
+	updatePool.init()
+	// menus are set with a request per scope, updates don't wait for them
+	go syncBotCommands(bot, store, logger)
+
+	var updates UpdatesChannel
+	var stopFetching func()
+	if config.Webhook != nil {
+		var server *http.Server
+		updates, server, err = startWebhook(bot, config.Webhook, logger)
+		stopFetching = func() { stopWebhook(server, currentConfig().ShutdownTimeout) }
+	} else {
+		updates, stopFetching, err = startPolling(bot)
+	}
 	if err != nil {
-		log.Fatal(err)
+		store.Close()
+		logger.Fatal("Error starting to receive updates", "err", err)
 	}
-	defer sqlstore.db.Close()
-	bot, err := tgbotapi.NewBotAPI(appConfig.TelegramBotToken)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+
+	// nil until a signal comes, so it blocks till then
+	var stopped chan struct{}
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				// the source closed the channel, nil keeps select from spinning on it
+				updates = nil
+				continue
+			}
+			updatePool.submit(update)
+		case <-reloads:
+			logger.Info("Received SIGHUP, reloading config")
+			go reloadConfig(bot, store, 0, logger)
+		case sig := <-signals:
+			logger.Info("Shutting down", "signal", sig)
+			signal.Stop(signals)
+			stopped = make(chan struct{})
+			go func() {
+				stopFetching()
+				close(stopped)
+			}()
+		case <-stopped:
+			// updates accepted while the source stops are still handled
+			drainUpdates(updates)
+			shutdown(store, currentConfig().ShutdownTimeout)
+			return
+		}
+	}
+}
+
+// gives the workers the updates left in the channel, the source doesn't add new ones anymore
+func drainUpdates(updates UpdatesChannel) {
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			updatePool.submit(update)
+		default:
+			return
+		}
+	}
+}
+
+func startPolling(bot *tgbotapi.BotAPI) (updates UpdatesChannel, stop func(), err error) {
+	// getUpdates doesn't work while a webhook from an earlier run is set
+	_, err = bot.RemoveWebhook()
 	if err != nil {
-		log.Fatal(err)
+		return
 	}
+	updates, stop = pollUpdates(bot, 60)
+	return
+}
 
-	log.Printf("Authorized on account %s", bot.Self.UserName)
+// last saved state of users, so the store is written only when something changes
+var knownUsers = struct {
+	sync.Mutex
+	users map[int]User
+}{users: make(map[int]User)}
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// refreshes username of the update's author, chat is nil for updates without it
+func rememberUser(store Store, from *tgbotapi.User, chat *tgbotapi.Chat) (err error) {
+	if from == nil {
+		return
+	}
+	user := User{
+		ID:       from.ID,
+		Name:     strings.Replace(from.UserName, "@", "", -1),
+		FullName: strings.TrimSpace(from.FirstName + " " + from.LastName),
 
-	updates, err := bot.GetUpdatesChan(u)
+		LanguageCode: from.LanguageCode,
+	}
+	if chat != nil && isUserChat(chat) {
+		user.ChatID = chat.ID
+	}
 
-	for update := range updates {
-		log.Println("Receive update")
-		go processUpdate(bot, &update, sqlstore)
+	knownUsers.Lock()
+	defer knownUsers.Unlock()
+	known, ok := knownUsers.users[user.ID]
+	if ok && known.Name == user.Name && known.FullName == user.FullName &&
+		(user.ChatID == 0 || known.ChatID == user.ChatID) &&
+		(user.LanguageCode == "" || known.LanguageCode == user.LanguageCode) {
+		return
 	}
+	err = store.saveUser(&user)
+	if err != nil {
+		return
+	}
+	if user.ChatID == 0 {
+		user.ChatID = known.ChatID
+	}
+	if user.LanguageCode == "" {
+		user.LanguageCode = known.LanguageCode
+	}
+	knownUsers.users[user.ID] = user
+	return
+}
 
+// logger with the update's id, its user, chat and command on every line
+func updateLogger(update *Update) *Logger {
+	var from *tgbotapi.User
+	var chatID int64
+	var command string
+	switch {
+	case update.MyChatMember != nil:
+		from, chatID = &update.MyChatMember.From, update.MyChatMember.Chat.ID
+	case update.ChatMember != nil:
+		from, chatID = &update.ChatMember.From, update.ChatMember.Chat.ID
+	case update.CallbackQuery != nil:
+		from = update.CallbackQuery.From
+		if update.CallbackQuery.Message != nil {
+			chatID = update.CallbackQuery.Message.Chat.ID
+		}
+		command = strings.SplitN(update.CallbackQuery.Data, CallbackDataDelimiter, 2)[0]
+	case update.InlineQuery != nil:
+		from = update.InlineQuery.From
+		command, _ = parseQuery(update.InlineQuery.Query)
+	case update.Message != nil:
+		from, chatID = update.Message.From, update.Message.Chat.ID
+		if update.Message.IsCommand() {
+			command = update.Message.Command()
+		}
+	}
+	userID := 0
+	if from != nil {
+		userID = from.ID
+	}
+	return logger.With("update_id", update.UpdateID, "user_id", userID, "chat_id", chatID, "command", command)
 }
 
-func processUpdate(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store *SQLStore) (err error) {
+func processUpdate(bot *tgbotapi.BotAPI, update *Update, store Store, config *AppConfig) (err error) {
+	logger := updateLogger(update)
+	logger.Debug("Update received")
+	if update.MyChatMember != nil || update.ChatMember != nil {
+		processChatMemberUpdate(bot, update, store, logger)
+		return
+	}
+	var userErr error
+	switch {
+	case update.CallbackQuery != nil:
+		userErr = rememberUser(store, update.CallbackQuery.From, nil)
+	case update.InlineQuery != nil:
+		userErr = rememberUser(store, update.InlineQuery.From, nil)
+	case update.Message != nil:
+		userErr = rememberUser(store, update.Message.From, update.Message.Chat)
+	}
+	if userErr != nil {
+		logger.Error("Error saving user", "err", userErr)
+	}
+	if checkSanctions(bot, update, store, config, logger) {
+		return
+	}
+	if checkRateLimits(bot, update, store, config, logger) {
+		return
+	}
+
 	if update.CallbackQuery != nil {
-		log.Println("Receive callback")
 		var reply string
-		reply = proccessCallback(bot, update.CallbackQuery, store)
+		reply = proccessCallback(bot, update.CallbackQuery, store, logger)
 
 		err = sendCallbackNotification(bot, update.CallbackQuery.ID, reply)
 		if err != nil {
-			log.Printf("Error sending notification")
+			logger.Error("Error answering callback", "err", err)
 			return
 		}
 		return
@@ -78,53 +290,24 @@ func processUpdate(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store *SQLStor
 		return
 	}
 	if update.InlineQuery != nil {
-
-		log.Println(update.InlineQuery.ID)
-		err = processInlineQuery(bot, update, store)
-		if err != nil {
-			log.Println(err)
-		}
+		// errors are logged by the handler
+		err = processInlineQuery(bot, &update.Update, store, logger)
 	} else {
-
-		if isUserChat(update.Message.Chat) {
-			log.Println("Received message from user chat")
-			_, err = store.getUserChatID(update.Message.From.UserName)
-			log.Println("Find it's personal chatID in database")
-			if err != nil {
-				log.Println(err)
-				log.Println("Adding user chatID with fbbbot to database")
-				user := &User{
-					ID:     update.Message.From.ID,
-					Name:   strings.Replace(update.Message.From.UserName, "@", "", -1),
-					ChatID: update.Message.Chat.ID,
-				}
-				err = store.addUser(user)
-				if err != nil {
-					log.Printf("Error accesing database: %v", err)
-					return
-				}
-			}
-		} else {
-			log.Println(update.Message.Chat.ID)
-		}
-
 		if !update.Message.IsCommand() {
 			if strings.HasPrefix(update.Message.Text, "------") {
-				log.Println("Recognised as inline answer")
+				logger.Debug("Recognised as inline answer")
 				deleteConfig := tgbotapi.DeleteMessageConfig{
 					ChatID:    update.Message.Chat.ID,
 					MessageID: update.Message.MessageID,
 				}
-				go messageDeleter(bot, deleteConfig, appConfig.InlineAnswersTimeToDelete)
+				deletionScheduler.schedule(deleteConfig, config.InlineAnswersTimeToDelete, logger)
 			}
 		} else {
-			log.Println("Recognised as command")
-			err = processCommand(bot, update, store)
+			err = processCommand(bot, &update.Update, store, config, logger)
 			if err != nil {
-				log.Println(err)
+				logger.Info("Command failed", "err", err)
 			}
 		}
 	}
 	return
 }
-
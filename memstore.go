@@ -0,0 +1,840 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const MemoryDriver = "memory"
+
+// MemoryStore keeps everything in maps and loses it on exit. It answers every
+// query the same way SQLStore does, so it is used for tests and ephemeral runs
+type MemoryStore struct {
+	sync.Mutex
+	questions      map[int]*Question
+	answers        map[int]*Answer
+	users          map[int]*User
+	notes          map[int]*Note
+	groups         map[int64]*Group
+	deletions      map[int]*ScheduledDeletion
+	pending        map[string]*pendingRecord
+	roles          map[roleKey]Role
+	sanctions      map[int]*Sanction
+	lastQuestionID int
+	lastAnswerID   int
+	lastNoteID     int
+	lastDeletionID int
+	lastSanctionID int
+}
+
+func NewMemoryStore() (store *MemoryStore) {
+	store = &MemoryStore{
+		questions: make(map[int]*Question),
+		answers:   make(map[int]*Answer),
+		users:     make(map[int]*User),
+		notes:     make(map[int]*Note),
+		groups:    make(map[int64]*Group),
+		deletions: make(map[int]*ScheduledDeletion),
+		pending:   make(map[string]*pendingRecord),
+		roles:     make(map[roleKey]Role),
+		sanctions: make(map[int]*Sanction),
+	}
+	return
+}
+
+func (s *MemoryStore) Close() {}
+
+// sql stores keep unix seconds, so the same precision and location is kept here
+func memoryTime(t time.Time) time.Time {
+	return storedTime(t.Unix())
+}
+
+func matchesState(q *Question, state QuestionState) bool {
+	switch state {
+	case ClosedQuestions:
+		return q.IsClosed
+	case AllQuestions:
+		return true
+	default:
+		return !q.IsClosed
+	}
+}
+
+func copyQuestion(q *Question) *Question {
+	c := *q
+	c.Rec = NewReceiver(q.Rec.ID, q.Rec.User)
+	c.Answers = nil
+	return &c
+}
+
+func copyAnswer(a *Answer) *Answer {
+	c := *a
+	return &c
+}
+
+// newest first, rows with the same time go in reverse order of ids, as in SQLStore
+func sortQuestions(questions []*Question) {
+	sort.Slice(questions, func(i, j int) bool {
+		if questions[i].Date.Equal(questions[j].Date) {
+			return questions[i].QuestionID > questions[j].QuestionID
+		}
+		return questions[i].Date.After(questions[j].Date)
+	})
+}
+
+func sortAnswers(answers []*Answer) {
+	sort.Slice(answers, func(i, j int) bool {
+		if answers[i].Date.Equal(answers[j].Date) {
+			return answers[i].AnswerID > answers[j].AnswerID
+		}
+		return answers[i].Date.After(answers[j].Date)
+	})
+}
+
+func pageQuestions(questions []*Question, limit int, offset int) []*Question {
+	if offset >= len(questions) {
+		return nil
+	}
+	questions = questions[offset:]
+	if limit >= 0 && limit < len(questions) {
+		questions = questions[:limit]
+	}
+	return questions
+}
+
+func pageAnswers(answers []*Answer, limit int, offset int) []*Answer {
+	if offset >= len(answers) {
+		return nil
+	}
+	answers = answers[offset:]
+	if limit >= 0 && limit < len(answers) {
+		answers = answers[:limit]
+	}
+	return answers
+}
+
+// sorted copies of questions accepted by filter
+func (s *MemoryStore) selectQuestions(filter func(q *Question) bool) (questions []*Question) {
+	for _, q := range s.questions {
+		if filter(q) {
+			questions = append(questions, copyQuestion(q))
+		}
+	}
+	sortQuestions(questions)
+	return
+}
+
+func (s *MemoryStore) selectAnswers(filter func(a *Answer) bool) (answers []*Answer) {
+	for _, a := range s.answers {
+		if filter(a) {
+			answers = append(answers, copyAnswer(a))
+		}
+	}
+	sortAnswers(answers)
+	return
+}
+
+func (s *MemoryStore) addQuestion(q *Question) (questionID int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastQuestionID++
+	questionID = s.lastQuestionID
+	stored := copyQuestion(q)
+	stored.QuestionID = questionID
+	stored.Date = memoryTime(q.Date)
+	s.questions[questionID] = stored
+	return
+}
+
+func (s *MemoryStore) getQuestion(questionID int) (q *Question, err error) {
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.questions[questionID]
+	if !ok {
+		err = QuestionDoesntExist
+		return
+	}
+	q = copyQuestion(stored)
+	return
+}
+
+func (s *MemoryStore) deleteQuestion(questionID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.questions, questionID)
+	return
+}
+
+func (s *MemoryStore) setClosed(questionID int, isClosed bool) {
+	s.Lock()
+	defer s.Unlock()
+	if q, ok := s.questions[questionID]; ok {
+		q.IsClosed = isClosed
+	}
+}
+
+func (s *MemoryStore) closeQuestion(questionID int) (err error) {
+	s.setClosed(questionID, true)
+	return
+}
+
+func (s *MemoryStore) openQuestion(questionID int) (err error) {
+	s.setClosed(questionID, false)
+	return
+}
+
+func (s *MemoryStore) findQuestionsTo(receiverID int64,
+	limit int, offset int) (questions []*Question, err error) {
+	questions, err = s.findQuestionsToByState(receiverID, OpenQuestions, limit, offset)
+	return
+}
+
+func (s *MemoryStore) findQuestionsToByState(receiverID int64, state QuestionState,
+	limit int, offset int) (questions []*Question, err error) {
+	s.Lock()
+	defer s.Unlock()
+	questions = s.selectQuestions(func(q *Question) bool {
+		return q.Rec.ID == receiverID && matchesState(q, state)
+	})
+	questions = pageQuestions(questions, limit, offset)
+	return
+}
+
+func (s *MemoryStore) findAllQuestionsTo(receiverID int64) (questions []*Question, err error) {
+	questions, err = s.findQuestionsToByState(receiverID, OpenQuestions, -1, 0)
+	return
+}
+
+func (s *MemoryStore) findQuestionsFrom(userID int,
+	limit int, offset int) (questions []*Question, err error) {
+	questions, err = s.findQuestionsFromByState(userID, OpenQuestions, limit, offset)
+	return
+}
+
+func (s *MemoryStore) findQuestionsFromByState(userID int, state QuestionState,
+	limit int, offset int) (questions []*Question, err error) {
+	s.Lock()
+	defer s.Unlock()
+	questions = s.selectQuestions(func(q *Question) bool {
+		return q.UserID == userID && matchesState(q, state)
+	})
+	questions = pageQuestions(questions, limit, offset)
+	return
+}
+
+func (s *MemoryStore) addAnswer(a *Answer) (answerID int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastAnswerID++
+	answerID = s.lastAnswerID
+	stored := copyAnswer(a)
+	stored.AnswerID = answerID
+	stored.Date = memoryTime(a.Date)
+	s.answers[answerID] = stored
+	return
+}
+
+func (s *MemoryStore) getAnswer(answerID int) (a *Answer, err error) {
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.answers[answerID]
+	if !ok {
+		err = AnswerDoesntExist
+		return
+	}
+	a = copyAnswer(stored)
+	return
+}
+
+func (s *MemoryStore) deleteAnswer(answerID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.answers, answerID)
+	return
+}
+
+func (s *MemoryStore) findAnswersFor(questionID int,
+	limit int, offset int) (answers []*Answer, err error) {
+	s.Lock()
+	defer s.Unlock()
+	answers = s.selectAnswers(func(a *Answer) bool {
+		return a.QuestionID == questionID
+	})
+	answers = pageAnswers(answers, limit, offset)
+	return
+}
+
+func (s *MemoryStore) findAllAnswersFor(questionID int) (answers []*Answer, err error) {
+	answers, err = s.findAnswersFor(questionID, -1, 0)
+	return
+}
+
+// answers to questions asked by user
+func (s *MemoryStore) getAnswersFor(userID int, limit int, offset int) (answers []*Answer, err error) {
+	s.Lock()
+	defer s.Unlock()
+	answers = s.selectAnswers(func(a *Answer) bool {
+		q, ok := s.questions[a.QuestionID]
+		return ok && q.UserID == userID
+	})
+	answers = pageAnswers(answers, limit, offset)
+	return
+}
+
+func (s *MemoryStore) findAnswersFrom(userID int, state QuestionState,
+	limit int, offset int) (answers []*Answer, err error) {
+	s.Lock()
+	defer s.Unlock()
+	answers = s.selectAnswers(func(a *Answer) bool {
+		if a.UserID != userID {
+			return false
+		}
+		if state == AllQuestions {
+			return true
+		}
+		q, ok := s.questions[a.QuestionID]
+		return ok && matchesState(q, state)
+	})
+	answers = pageAnswers(answers, limit, offset)
+	return
+}
+
+func (s *MemoryStore) saveUser(user *User) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	stored := *user
+	if old, ok := s.users[user.ID]; ok {
+		if stored.ChatID == 0 {
+			stored.ChatID = old.ChatID
+		}
+		if stored.LanguageCode == "" {
+			stored.LanguageCode = old.LanguageCode
+		}
+		stored.Lang = old.Lang
+		if old.DisplayName() != user.DisplayName() {
+			s.renameUser(user.ID, user.DisplayName())
+		}
+	}
+	s.users[user.ID] = &stored
+	if user.Name == "" {
+		return
+	}
+	for id, other := range s.users {
+		if id != user.ID && strings.EqualFold(other.Name, user.Name) {
+			other.Name = ""
+		}
+	}
+	s.bindUnknownUser(user.ID, user.Name)
+	return
+}
+
+func (s *MemoryStore) renameUser(userID int, name string) {
+	for _, q := range s.questions {
+		if q.UserID == userID {
+			q.User = name
+		}
+		if q.Rec.ID == int64(userID) {
+			q.Rec.User = name
+		}
+	}
+	for _, a := range s.answers {
+		if a.UserID == userID {
+			a.User = name
+		}
+	}
+	for _, n := range s.notes {
+		if n.UserID == userID {
+			n.User = name
+		}
+	}
+}
+
+// rows written before the bot knew the id of their author are bound by username
+func (s *MemoryStore) bindUnknownUser(userID int, name string) {
+	for _, q := range s.questions {
+		if q.UserID == UnknownUserID && strings.EqualFold(q.User, name) {
+			q.UserID = userID
+		}
+		if q.Rec.ID == UnknownUserID && strings.EqualFold(q.Rec.User, name) {
+			q.Rec.ID = int64(userID)
+		}
+	}
+	for _, a := range s.answers {
+		if a.UserID == UnknownUserID && strings.EqualFold(a.User, name) {
+			a.UserID = userID
+		}
+	}
+	for _, n := range s.notes {
+		if n.UserID == UnknownUserID && strings.EqualFold(n.User, name) {
+			n.UserID = userID
+		}
+	}
+}
+
+func (s *MemoryStore) getUser(userID int) (user *User, err error) {
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.users[userID]
+	if !ok {
+		err = UserDoesntExist
+		return
+	}
+	c := *stored
+	user = &c
+	return
+}
+
+func (s *MemoryStore) findUserByName(name string) (user *User, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, stored := range s.users {
+		if stored.Name != "" && strings.EqualFold(stored.Name, name) {
+			c := *stored
+			user = &c
+			return
+		}
+	}
+	err = UserDoesntExist
+	return
+}
+
+func (s *MemoryStore) setUserLang(userID int, lang Lang) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		err = UserDoesntExist
+		return
+	}
+	user.Lang = lang
+	return
+}
+
+func (s *MemoryStore) getUserChatID(userID int) (chatID int64, err error) {
+	s.Lock()
+	defer s.Unlock()
+	user, ok := s.users[userID]
+	if !ok || user.ChatID == 0 {
+		err = UnknownUserChat
+		return
+	}
+	chatID = user.ChatID
+	return
+}
+
+func copyGroup(g *Group) *Group {
+	c := *g
+	c.Admins = append([]int(nil), g.Admins...)
+	c.ChatAdmins = append([]int(nil), g.ChatAdmins...)
+	return &c
+}
+
+func (s *MemoryStore) saveGroup(g *Group) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	stored := copyGroup(g)
+	if old, ok := s.groups[g.ChatID]; ok {
+		stored.ChatAdmins = old.ChatAdmins
+	} else {
+		stored.ChatAdmins = nil
+	}
+	s.groups[g.ChatID] = stored
+	for _, q := range s.questions {
+		if q.Rec.ID == g.ChatID {
+			q.Rec.User = g.Name
+		}
+	}
+	return
+}
+
+func (s *MemoryStore) getGroup(chatID int64) (g *Group, err error) {
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.groups[chatID]
+	if !ok {
+		err = GroupDoesntExist
+		return
+	}
+	g = copyGroup(stored)
+	return
+}
+
+func (s *MemoryStore) findGroupByName(name string) (g *Group, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, stored := range s.groups {
+		if strings.EqualFold(stored.Name, name) {
+			g = copyGroup(stored)
+			return
+		}
+	}
+	err = GroupDoesntExist
+	return
+}
+
+func (s *MemoryStore) findGroups() (groups []*Group, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, stored := range s.groups {
+		groups = append(groups, copyGroup(stored))
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return
+}
+
+func (s *MemoryStore) setGroupChatAdmins(chatID int64, admins []int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if g, ok := s.groups[chatID]; ok {
+		g.ChatAdmins = append([]int(nil), admins...)
+	}
+	return
+}
+
+func (s *MemoryStore) deleteGroup(chatID int64) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.groups, chatID)
+	return
+}
+
+// user and chat of a role
+type roleKey struct {
+	userID int
+	chatID int64
+}
+
+func (s *MemoryStore) getRole(userID int, chatID int64) (role Role, err error) {
+	s.Lock()
+	defer s.Unlock()
+	role, ok := s.roles[roleKey{userID, chatID}]
+	if !ok {
+		role = RoleMember
+	}
+	return
+}
+
+func (s *MemoryStore) setRole(userID int, chatID int64, role Role) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if role == RoleMember {
+		delete(s.roles, roleKey{userID, chatID})
+		return
+	}
+	s.roles[roleKey{userID, chatID}] = role
+	return
+}
+
+func (s *MemoryStore) findRoles() (roles []*UserRole, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for key, role := range s.roles {
+		roles = append(roles, &UserRole{UserID: key.userID, ChatID: key.chatID, Role: role})
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].ChatID != roles[j].ChatID {
+			return roles[i].ChatID < roles[j].ChatID
+		}
+		return roles[i].UserID < roles[j].UserID
+	})
+	return
+}
+
+func (s *MemoryStore) addSanction(sanction *Sanction) (sanctionID int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastSanctionID++
+	sanctionID = s.lastSanctionID
+	stored := *sanction
+	stored.ID = sanctionID
+	stored.Date = memoryTime(sanction.Date)
+	if !sanction.Until.IsZero() {
+		stored.Until = memoryTime(sanction.Until)
+	}
+	s.sanctions[sanctionID] = &stored
+	return
+}
+
+// copies of sanctions accepted by filter, newest first
+func (s *MemoryStore) selectSanctions(filter func(sanction *Sanction) bool) (sanctions []*Sanction) {
+	for _, stored := range s.sanctions {
+		if filter(stored) {
+			c := *stored
+			sanctions = append(sanctions, &c)
+		}
+	}
+	sort.Slice(sanctions, func(i, j int) bool {
+		return sanctions[i].ID > sanctions[j].ID
+	})
+	return
+}
+
+func (s *MemoryStore) findActiveSanctions(userID int, now time.Time) (sanctions []*Sanction, err error) {
+	s.Lock()
+	defer s.Unlock()
+	sanctions = s.selectSanctions(func(sanction *Sanction) bool {
+		return sanction.UserID == userID && sanction.ActiveAt(memoryTime(now))
+	})
+	sort.Slice(sanctions, func(i, j int) bool {
+		return sanctions[i].ID < sanctions[j].ID
+	})
+	return
+}
+
+func (s *MemoryStore) findSanctions(userID int, limit int, offset int) (sanctions []*Sanction, err error) {
+	s.Lock()
+	defer s.Unlock()
+	sanctions = s.selectSanctions(func(sanction *Sanction) bool {
+		return userID == 0 || sanction.UserID == userID
+	})
+	if offset >= len(sanctions) {
+		sanctions = nil
+		return
+	}
+	sanctions = sanctions[offset:]
+	if limit < len(sanctions) {
+		sanctions = sanctions[:limit]
+	}
+	return
+}
+
+func (s *MemoryStore) liftSanctions(userID int, liftedBy int, now time.Time) (lifted int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, stored := range s.sanctions {
+		if stored.UserID == userID && stored.ActiveAt(memoryTime(now)) {
+			stored.LiftedBy = liftedBy
+			stored.Lifted = memoryTime(now)
+			lifted++
+		}
+	}
+	return
+}
+
+func (s *MemoryStore) markSanctionNotified(sanctionID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if stored, ok := s.sanctions[sanctionID]; ok {
+		stored.Notified = true
+	}
+	return
+}
+
+func (s *MemoryStore) addNote(n *Note) (noteID int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastNoteID++
+	noteID = s.lastNoteID
+	stored := *n
+	stored.NoteID = noteID
+	stored.Date = memoryTime(n.Date)
+	s.notes[noteID] = &stored
+	return
+}
+
+func (s *MemoryStore) getNote(noteID int) (note *Note, err error) {
+	s.Lock()
+	defer s.Unlock()
+	stored, ok := s.notes[noteID]
+	if !ok {
+		err = NoteDoesntExist
+		return
+	}
+	c := *stored
+	note = &c
+	return
+}
+
+func (s *MemoryStore) findNotes(limit int, offset int) (notes []*Note, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, n := range s.notes {
+		c := *n
+		notes = append(notes, &c)
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].Date.Equal(notes[j].Date) {
+			return notes[i].NoteID > notes[j].NoteID
+		}
+		return notes[i].Date.After(notes[j].Date)
+	})
+	if offset >= len(notes) {
+		notes = nil
+		return
+	}
+	notes = notes[offset:]
+	if limit < len(notes) {
+		notes = notes[:limit]
+	}
+	return
+}
+
+func (s *MemoryStore) deleteNote(noteID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.notes, noteID)
+	return
+}
+
+func (s *MemoryStore) addDeletion(d *ScheduledDeletion) (deletionID int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastDeletionID++
+	deletionID = s.lastDeletionID
+	stored := *d
+	stored.ID = deletionID
+	stored.Due = memoryTime(d.Due)
+	s.deletions[deletionID] = &stored
+	return
+}
+
+func (s *MemoryStore) findDueDeletions(now time.Time, limit int) (deletions []*ScheduledDeletion, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, stored := range s.deletions {
+		if !stored.Due.After(now) {
+			d := *stored
+			deletions = append(deletions, &d)
+		}
+	}
+	sort.Slice(deletions, func(i, j int) bool {
+		if !deletions[i].Due.Equal(deletions[j].Due) {
+			return deletions[i].Due.Before(deletions[j].Due)
+		}
+		return deletions[i].ID < deletions[j].ID
+	})
+	if len(deletions) > limit {
+		deletions = deletions[:limit]
+	}
+	return
+}
+
+func (s *MemoryStore) rescheduleDeletion(deletionID int, due time.Time, attempts int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if d, ok := s.deletions[deletionID]; ok {
+		d.Due = memoryTime(due)
+		d.Attempts = attempts
+	}
+	return
+}
+
+func (s *MemoryStore) deleteDeletion(deletionID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.deletions, deletionID)
+	return
+}
+
+func (s *MemoryStore) countDeletions() (count int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	count = len(s.deletions)
+	return
+}
+
+// pending messages are kept encoded like in SQLStore, so callers get their own copies
+type pendingRecord struct {
+	kind string
+	data string
+	time int64
+}
+
+func (s *MemoryStore) savePending(m *TempMessage) (err error) {
+	kind, data, err := encodePending(m.Message)
+	if err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.pending[m.Tag] = &pendingRecord{kind: kind, data: data, time: m.Time}
+	return
+}
+
+func (s *MemoryStore) getPending(tag string) (m *TempMessage, err error) {
+	s.Lock()
+	defer s.Unlock()
+	record, ok := s.pending[tag]
+	if !ok {
+		err = PendingDoesntExist
+		return
+	}
+	m = &TempMessage{Tag: tag, Time: record.time}
+	m.Message, err = decodePending(record.kind, record.data)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *MemoryStore) takePending(tag string) (m *TempMessage, err error) {
+	s.Lock()
+	defer s.Unlock()
+	record, ok := s.pending[tag]
+	if !ok {
+		err = PendingDoesntExist
+		return
+	}
+	delete(s.pending, tag)
+	m = &TempMessage{Tag: tag, Time: record.time}
+	m.Message, err = decodePending(record.kind, record.data)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *MemoryStore) deletePending(tag string) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.pending, tag)
+	return
+}
+
+func (s *MemoryStore) deleteExpiredPending(before int64) (count int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	for tag, record := range s.pending {
+		if record.time < before {
+			delete(s.pending, tag)
+			count++
+		}
+	}
+	return
+}
+
+func (s *MemoryStore) evictPending(keep int) (count int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.pending) <= keep {
+		return
+	}
+	tags := make([]string, 0, len(s.pending))
+	for tag := range s.pending {
+		tags = append(tags, tag)
+	}
+	// the same order SQLStore keeps: the newest first, ties by tag
+	sort.Slice(tags, func(i, j int) bool {
+		ti, tj := s.pending[tags[i]].time, s.pending[tags[j]].time
+		if ti != tj {
+			return ti > tj
+		}
+		return tags[i] < tags[j]
+	})
+	for _, tag := range tags[keep:] {
+		delete(s.pending, tag)
+		count++
+	}
+	return
+}
+
+func (s *MemoryStore) countPending() (count int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	count = len(s.pending)
+	return
+}
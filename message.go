@@ -1,19 +1,18 @@
 package main
 
 import (
-	"log"
 	"time"
 )
 
-func NewMessagePull(cleanInterval int, storeTime int) (p *MessagePull) {
+func NewMessagePull(store PendingStore, cleanInterval int, storeTime int, maxSize int) (p *MessagePull) {
 	p = new(MessagePull)
-	p.messages = make(chan *TempMessage)
-	p.stop = make(chan struct{})
+	p.store = store
 	p.cleanInterval = cleanInterval
-	p.get = make(chan string)
-	p.outMessages = make(chan Message)
 	p.storeTime = storeTime
-	p.delete = make(chan string)
+	p.maxSize = maxSize
+	p.logger = logger.With("component", "pending")
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
 	return
 }
 
@@ -21,95 +20,84 @@ func (p *MessagePull) init() {
 	go p.storer()
 }
 
-func (p *MessagePull) addMessage(message Message) (tag string) {
+func (p *MessagePull) addMessage(message Message) (tag string, err error) {
 	tag = message.GetHash()
 	tempM := TempMessage{Message: message, Tag: tag,
 		Time: time.Now().Unix(),
 	}
-	p.messages <- &tempM
+	p.Lock()
+	defer p.Unlock()
+	err = p.store.savePending(&tempM)
+	if err != nil {
+		return
+	}
+	if p.maxSize > 0 {
+		var evicted int
+		evicted, err = p.store.evictPending(p.maxSize)
+		if err != nil {
+			return
+		}
+		if evicted > 0 {
+			p.logger.Warn("Evicted the oldest temp messages", "evicted", evicted, "limit", p.maxSize)
+		}
+	}
 	return
 }
 
-func (p *MessagePull) getMessage(tag string) (message Message, err error) {
-	p.get <- tag
-	message = <-p.outMessages
-	if message == nil {
-		err = QuestionDoesntExist
+// removes the message from pull and returns it, a message is taken only once
+func (p *MessagePull) takeMessage(tag string) (message Message, err error) {
+	tempM, err := p.store.takePending(tag)
+	if err != nil {
 		return
 	}
+	if time.Now().Unix()-tempM.Time > int64(p.storeTime) {
+		err = PendingDoesntExist
+		return
+	}
+	message = tempM.Message
 	return
 }
 
+// removes out-of-date messages every cleanInterval seconds
 func (p *MessagePull) storer() {
+	defer close(p.done)
 	ticker := time.NewTicker(time.Duration(p.cleanInterval) * time.Second)
-	questionStore := make(map[string]*TempMessage)
-	getIsClosed := false
-	messagesIsClosed := false
+	defer ticker.Stop()
+	p.clean()
 	for {
 		select {
-		case q, ok := <-p.messages:
-			if !ok {
-				messagesIsClosed = true
-				if messagesIsClosed && getIsClosed {
-					return
-				}
-				break
-			}
-			log.Printf("Add question to temporary storage")
-			questionStore[q.Tag] = q
 		case <-ticker.C:
-			log.Println("Cleaning out-of-date temp messages")
-			var deleteKeys []string
-			for key, q := range questionStore {
-				if time.Now().Unix()-q.Time > inlineTempQuestionStoreTime {
-					deleteKeys = append(deleteKeys, key)
-				}
-			}
-
-			for _, key := range deleteKeys {
-				log.Printf("Removing question with tag %s", key)
-				delete(questionStore, key)
-			}
-			log.Println("Done")
-		case tag, ok := <-p.get:
-			if !ok {
-				getIsClosed = true
-				if messagesIsClosed && getIsClosed {
-					return
-				}
-				break
-			}
-			if tempM, ok := questionStore[tag]; ok {
-				p.outMessages <- tempM.Message
-			} else {
-				p.outMessages <- nil
-			}
-		case tag, ok := <-p.delete:
-			{
-				if !ok {
-					// there is no reason to close this channel, but should smb modify code...
-					break
-				}
-				delete(questionStore, tag)
-			}
+			p.clean()
 		case <-p.stop:
 			return
 		}
 	}
 }
 
-//immediately deletes message from pull
-func (p *MessagePull) Delete(mHash string) {
-	p.delete <- mHash
+func (p *MessagePull) clean() {
+	count, err := p.store.deleteExpiredPending(time.Now().Unix() - int64(p.storeTime))
+	if err != nil {
+		p.logger.Error("Error cleaning temp messages", "err", err)
+		return
+	}
+	p.logger.Debug("Out-of-date temp messages are cleaned", "removed", count)
 }
 
-// gently close pull
-func (p *MessagePull) Close() {
-	close(p.messages)
-	close(p.get)
+// immediately deletes message from pull
+func (p *MessagePull) Delete(mHash string, logger *Logger) {
+	err := p.store.deletePending(mHash)
+	if err != nil {
+		logger.Error("Error deleting temp message", "err", err)
+	}
 }
 
-// die, motherfucker
-func (p *MessagePull) Stop() {
-	p.stop <- struct{}{}
+// stops cleaning, returns number of messages, which were never confirmed
+func (p *MessagePull) Shutdown() (pending int) {
+	close(p.stop)
+	<-p.done
+	pending, err := p.store.countPending()
+	if err != nil {
+		p.logger.Error("Error counting temp messages", "err", err)
+	}
+	return
 }
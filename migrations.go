@@ -0,0 +1,468 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Migration moves database schema from Version-1 to Version.
+// Migrations are applied in order of versions
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+// never change or reorder already released migrations, only append new ones.
+// Both lists must have the same versions with the same meaning
+var sqliteMigrations = []Migration{
+	{1, "create questions, answers, users and notes tables", createInitialSchema},
+	{2, "add indexes for questions and answers lookups", createLookupIndexes},
+	{3, "identify users by telegram id", func(tx *sql.Tx) error { return bindUsersByID(tx, false) }},
+	{4, "create study groups table", createGroupsTable},
+	{5, "create scheduled deletions table", func(tx *sql.Tx) error { return createDeletionsTable(tx, false) }},
+	{6, "create pending messages table", createPendingTable},
+	{7, "add languages of users and groups", addLanguageColumns},
+	{8, "create user roles table", createRolesTable},
+	{9, "add telegram administrators of groups", addChatAdminsColumn},
+	{10, "create sanctions table", func(tx *sql.Tx) error { return createSanctionsTable(tx, false) }},
+}
+
+var postgresMigrations = []Migration{
+	{1, "create questions, answers, users and notes tables", createPostgresInitialSchema},
+	{2, "add indexes for questions and answers lookups", createLookupIndexes},
+	{3, "identify users by telegram id", func(tx *sql.Tx) error { return bindUsersByID(tx, true) }},
+	{4, "create study groups table", createGroupsTable},
+	{5, "create scheduled deletions table", func(tx *sql.Tx) error { return createDeletionsTable(tx, true) }},
+	{6, "create pending messages table", createPendingTable},
+	{7, "add languages of users and groups", addLanguageColumns},
+	{8, "create user roles table", createRolesTable},
+	{9, "add telegram administrators of groups", addChatAdminsColumn},
+	{10, "create sanctions table", func(tx *sql.Tx) error { return createSanctionsTable(tx, true) }},
+}
+
+func (s *SQLStore) migrations() []Migration {
+	if s.driver == PostgresDriver {
+		return postgresMigrations
+	}
+	return sqliteMigrations
+}
+
+type MigrationStatus struct {
+	CurrentVersion int
+	Legacy         bool // database was created before migrations were introduced
+	Pending        []Migration
+}
+
+func createInitialSchema(tx *sql.Tx) (err error) {
+	// "if not exists" lets this migration adopt databases created before versioning
+	queries := []string{`
+	create table if not exists Questions(
+		id integer primary key,
+		user text,
+		content text,
+		time integer,
+		receiver text,
+		isClosed integer,
+		chatID integer
+	)`, `
+	create table if not exists Answers(
+		id integer primary key,
+		user text,
+		content text,
+		time integer,
+		questionID integer
+	)`, `
+	CREATE TABLE IF NOT EXISTS Users(
+	    id integer,
+	    name text primary key,
+	    chatID
+	)`, `
+	CREATE TABLE IF NOT EXISTS Notes (
+	    id integer primary key,
+	    user text,
+	    content text,
+	    time integer
+	)`}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func createPostgresInitialSchema(tx *sql.Tx) (err error) {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS Questions(
+		id serial primary key,
+		"user" text,
+		content text,
+		time bigint,
+		receiver text,
+		isClosed integer,
+		chatID bigint
+	)`, `
+	CREATE TABLE IF NOT EXISTS Answers(
+		id serial primary key,
+		"user" text,
+		content text,
+		time bigint,
+		questionID integer
+	)`, `
+	CREATE TABLE IF NOT EXISTS Users(
+	    id bigint,
+	    name text primary key,
+	    chatID bigint
+	)`, `
+	CREATE TABLE IF NOT EXISTS Notes (
+	    id serial primary key,
+	    "user" text,
+	    content text,
+	    time bigint
+	)`}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func createLookupIndexes(tx *sql.Tx) (err error) {
+	queries := []string{
+		`CREATE INDEX IF NOT EXISTS questions_receiver ON Questions (receiver, isClosed, time)`,
+		`CREATE INDEX IF NOT EXISTS questions_user ON Questions ("user", isClosed, time)`,
+		`CREATE INDEX IF NOT EXISTS answers_question ON Answers (questionID, time)`,
+		`CREATE INDEX IF NOT EXISTS answers_user ON Answers ("user", time)`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func createSchemaVersionTable(tx *sql.Tx) (err error) {
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version(
+	    version integer primary key,
+	    description text,
+	    time bigint
+	)`)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// adds telegram ids to questions, answers and notes and makes it the key of Users.
+// Rows are bound to ids through usernames known to the bot, the rest keep 0
+// until their author is met again (see SQLStore.saveUser)
+func bindUsersByID(tx *sql.Tx, postgres bool) (err error) {
+	idType := "integer"
+	copyUsers := `INSERT OR IGNORE INTO UsersByID (id, name, chatID)
+	    SELECT id, coalesce(name, ''), coalesce(chatID, 0) FROM Users WHERE id IS NOT NULL`
+	if postgres {
+		idType = "bigint"
+		copyUsers = `INSERT INTO UsersByID (id, name, chatID)
+	    SELECT id, coalesce(name, ''), coalesce(chatID, 0) FROM Users WHERE id IS NOT NULL
+	    ON CONFLICT (id) DO NOTHING`
+	}
+	userIDBy := func(column string) string {
+		return `coalesce((SELECT id FROM Users
+		    WHERE Users.name != '' AND Users.name = ` + column + `), 0)`
+	}
+	queries := []string{
+		`ALTER TABLE Questions ADD COLUMN userID ` + idType + ` NOT NULL DEFAULT 0`,
+		`ALTER TABLE Questions ADD COLUMN receiverID ` + idType + ` NOT NULL DEFAULT 0`,
+		`ALTER TABLE Answers ADD COLUMN userID ` + idType + ` NOT NULL DEFAULT 0`,
+		`ALTER TABLE Notes ADD COLUMN userID ` + idType + ` NOT NULL DEFAULT 0`,
+		`CREATE TABLE UsersByID(
+		    id ` + idType + ` primary key,
+		    name text NOT NULL DEFAULT '',
+		    fullName text NOT NULL DEFAULT '',
+		    chatID ` + idType + ` NOT NULL DEFAULT 0
+		)`,
+		copyUsers,
+		`DROP TABLE Users`,
+		`ALTER TABLE UsersByID RENAME TO Users`,
+		`CREATE INDEX IF NOT EXISTS users_name ON Users (name)`,
+		`UPDATE Questions SET userID = ` + userIDBy(`Questions."user"`),
+		fmt.Sprintf(`UPDATE Questions SET receiverID = %d WHERE receiver = '%s'`,
+			int64(AllGroupChatID), AllGroupName),
+		`UPDATE Questions SET receiverID = ` + userIDBy(`Questions.receiver`) +
+			` WHERE receiver != '` + AllGroupName + `'`,
+		`UPDATE Answers SET userID = ` + userIDBy(`Answers."user"`),
+		`UPDATE Notes SET userID = ` + userIDBy(`Notes."user"`),
+		`CREATE INDEX IF NOT EXISTS questions_receiver_id ON Questions (receiverID, isClosed, time)`,
+		`CREATE INDEX IF NOT EXISTS questions_user_id ON Questions (userID, isClosed, time)`,
+		`CREATE INDEX IF NOT EXISTS answers_user_id ON Answers (userID, time)`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func createGroupsTable(tx *sql.Tx) (err error) {
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS StudyGroups(
+	    chatID bigint primary key,
+	    name text NOT NULL,
+	    notificationChatID bigint NOT NULL DEFAULT 0,
+	    admins text NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func createDeletionsTable(tx *sql.Tx, postgres bool) (err error) {
+	idType := "integer"
+	if postgres {
+		idType = "serial"
+	}
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS ScheduledDeletions(
+	    id ` + idType + ` primary key,
+	    chatID bigint NOT NULL,
+	    messageID integer NOT NULL,
+	    due bigint NOT NULL,
+	    attempts integer NOT NULL DEFAULT 0
+	)`,
+		`CREATE INDEX IF NOT EXISTS scheduled_deletions_due ON ScheduledDeletions (due)`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func createPendingTable(tx *sql.Tx) (err error) {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS PendingMessages(
+	    tag text primary key,
+	    kind text NOT NULL,
+	    data text NOT NULL,
+	    time bigint NOT NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS pending_messages_time ON PendingMessages (time)`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func addLanguageColumns(tx *sql.Tx) (err error) {
+	queries := []string{
+		`ALTER TABLE Users ADD COLUMN languageCode text NOT NULL DEFAULT ''`,
+		`ALTER TABLE Users ADD COLUMN lang text NOT NULL DEFAULT ''`,
+		`ALTER TABLE StudyGroups ADD COLUMN lang text NOT NULL DEFAULT ''`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func createRolesTable(tx *sql.Tx) (err error) {
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS UserRoles(
+	    userID bigint NOT NULL,
+	    chatID bigint NOT NULL,
+	    role text NOT NULL,
+	    primary key (userID, chatID)
+	)`)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func addChatAdminsColumn(tx *sql.Tx) (err error) {
+	_, err = tx.Exec(`ALTER TABLE StudyGroups ADD COLUMN chatAdmins text NOT NULL DEFAULT ''`)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func createSanctionsTable(tx *sql.Tx, postgres bool) (err error) {
+	idType := "integer"
+	if postgres {
+		idType = "serial"
+	}
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS Sanctions(
+	    id ` + idType + ` primary key,
+	    userID bigint NOT NULL,
+	    kind text NOT NULL,
+	    reason text NOT NULL DEFAULT '',
+	    byUserID bigint NOT NULL,
+	    time bigint NOT NULL,
+	    until bigint NOT NULL DEFAULT 0,
+	    liftedBy bigint NOT NULL DEFAULT 0,
+	    liftedTime bigint NOT NULL DEFAULT 0,
+	    notified integer NOT NULL DEFAULT 0
+	)`,
+		`CREATE INDEX IF NOT EXISTS sanctions_user_id ON Sanctions (userID, id)`,
+	}
+	for _, query := range queries {
+		_, err = tx.Exec(query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *SQLStore) tableExists(name string) (exists bool, err error) {
+	var count int
+	var row *sql.Row
+	if s.driver == PostgresDriver {
+		// postgres folds unquoted names to lower case
+		row = s.queryRow(`SELECT count(*) FROM information_schema.tables
+		                      WHERE table_schema = current_schema() AND table_name = lower(?)`, name)
+	} else {
+		row = s.queryRow(`SELECT count(*) FROM sqlite_master
+		                      WHERE type = 'table' AND name = ?`, name)
+	}
+	err = row.Scan(&count)
+	if err != nil {
+		return
+	}
+	exists = count > 0
+	return
+}
+
+func (s *SQLStore) schemaVersion() (version int, err error) {
+	row := s.db.QueryRow(`SELECT coalesce(max(version), 0) FROM schema_version`)
+	err = row.Scan(&version)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// reports current schema version and migrations, which are not applied yet
+func (s *SQLStore) migrationStatus() (status *MigrationStatus, err error) {
+	status = new(MigrationStatus)
+	versioned, err := s.tableExists("schema_version")
+	if err != nil {
+		return
+	}
+	if versioned {
+		status.CurrentVersion, err = s.schemaVersion()
+		if err != nil {
+			return
+		}
+	} else {
+		status.Legacy, err = s.tableExists("Questions")
+		if err != nil {
+			return
+		}
+	}
+	for _, m := range s.migrations() {
+		if m.Version > status.CurrentVersion {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+	return
+}
+
+// brings database schema to the latest version. All pending migrations run in
+// one transaction, with dryRun it is rolled back, so the database stays untouched
+func (s *SQLStore) migrate(dryRun bool) (err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	status, err := s.migrationStatus()
+	if err != nil {
+		return
+	}
+	if status.Legacy {
+		logger.Info("Found database without schema version, upgrading it in place")
+	}
+	if len(status.Pending) == 0 {
+		logger.Info("Database schema is up to date", "version", status.CurrentVersion)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil || dryRun {
+			rollbackErr := tx.Rollback()
+			if rollbackErr != nil {
+				logger.Error("Error rolling back migrations", "err", rollbackErr)
+			}
+		}
+	}()
+
+	err = createSchemaVersionTable(tx)
+	if err != nil {
+		return
+	}
+	for _, m := range status.Pending {
+		logger.Info("Applying migration", "version", m.Version, "description", m.Description)
+		err = m.Up(tx)
+		if err != nil {
+			err = fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Description, err)
+			return
+		}
+		_, err = tx.Exec(s.rebind(`INSERT INTO schema_version (version, description, time)
+		                      VALUES (?, ?, ?)`), m.Version, m.Description, time.Now().Unix())
+		if err != nil {
+			return
+		}
+	}
+
+	lastVersion := status.Pending[len(status.Pending)-1].Version
+	if dryRun {
+		logger.Info("Dry run: migrations succeeded and were rolled back", "version", lastVersion)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+	logger.Info("Database schema migrated", "version", lastVersion)
+	return
+}
+
+func printMigrationStatus(status *MigrationStatus) {
+	fmt.Printf("Current schema version: %d\n", status.CurrentVersion)
+	if status.Legacy {
+		fmt.Println("Database was created before schema versioning and will be upgraded in place")
+	}
+	if len(status.Pending) == 0 {
+		fmt.Println("No pending migrations")
+		return
+	}
+	fmt.Println("Pending migrations:")
+	for _, m := range status.Pending {
+		fmt.Printf("  %d: %s\n", m.Version, m.Description)
+	}
+}
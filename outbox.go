@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"sync"
+	"time"
+)
+
+// telegram allows about 30 messages a second overall, one a second
+// to a private chat and 20 a minute to a group
+const globalSendInterval = time.Second / 30
+const privateChatSendInterval = time.Second
+const groupChatSendInterval = 3 * time.Second
+const maxSendAttempts = 5
+const sendRetryDelay = 2 * time.Second
+const outboxIdleWait = time.Minute
+const maxAnswerRetryAfter = 5 // seconds, a user waits for answers to queries and buttons
+
+var OutboxStopped = errors.New("Outbox is stopped")
+
+// Outbox is the only way messages go out. Requests to a chat are sent one by one
+// in the order they came, a request waiting for a retry holds back the ones after it.
+// Answers to inline queries and buttons are not bound to a chat, they only wait for the global limit
+type Outbox struct {
+	sync.Mutex
+	queues    map[int64][]*outboxRequest
+	busy      map[int64]bool      // chats with a request being sent
+	notBefore map[int64]time.Time // chats wait for their limit or retry_after
+	nextSlot  time.Time           // of the global limit
+	stopping  bool
+	stats     OutboxStats
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// OutboxStats are numbers of the outbox, Queued and Chats are the current depth
+type OutboxStats struct {
+	Queued  int // requests not sent yet
+	Chats   int // chats they are for
+	Sent    int
+	Retried int
+	Failed  int // given up
+}
+
+type outboxRequest struct {
+	chatID   int64
+	call     func() (tgbotapi.Message, error)
+	retry    bool // resend on transient errors, otherwise the caller retries itself
+	attempts int
+	logger   *Logger                             // of the update the request is made for, retries are logged to it
+	done     func(m tgbotapi.Message, err error) // may be nil
+}
+
+var outbox *Outbox
+
+func NewOutbox() (o *Outbox) {
+	o = &Outbox{
+		queues:    make(map[int64][]*outboxRequest),
+		busy:      make(map[int64]bool),
+		notBefore: make(map[int64]time.Time),
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	return
+}
+
+func (o *Outbox) init() {
+	go o.worker()
+}
+
+// queues the message, sent is called with it once it is delivered. Failures
+// are retried and, when the outbox gives up, logged to logger
+func (o *Outbox) send(bot *tgbotapi.BotAPI, msg tgbotapi.MessageConfig, sent func(m tgbotapi.Message),
+	logger *Logger) (err error) {
+	err = o.add(&outboxRequest{
+		chatID: msg.ChatID,
+		call:   func() (tgbotapi.Message, error) { return bot.Send(msg) },
+		retry:  true,
+		logger: logger,
+		done: func(m tgbotapi.Message, err error) {
+			if err != nil {
+				logger.Error("Giving up sending message", "to_chat_id", msg.ChatID, "err", err)
+				return
+			}
+			if sent != nil {
+				sent(m)
+			}
+		},
+	})
+	return
+}
+
+// deletes the message after the requests queued to its chat before, waits for the result.
+// It is tried once, DeletionScheduler retries deletions itself
+func (o *Outbox) delete(bot *tgbotapi.BotAPI, config tgbotapi.DeleteMessageConfig) (err error) {
+	result := make(chan error, 1)
+	err = o.add(&outboxRequest{
+		chatID: config.ChatID,
+		call: func() (m tgbotapi.Message, err error) {
+			_, err = bot.DeleteMessage(config)
+			return
+		},
+		done: func(m tgbotapi.Message, err error) { result <- err },
+	})
+	if err != nil {
+		return
+	}
+	err = <-result
+	return
+}
+
+// makes a request not bound to a chat once the global limit allows it.
+// A short retry_after is waited for once, the user is waiting for the answer
+func (o *Outbox) call(request func() error) (err error) {
+	for attempt := 0; ; attempt++ {
+		o.Lock()
+		now := time.Now()
+		slot := o.nextSlot
+		if slot.Before(now) {
+			slot = now
+		}
+		o.nextSlot = slot.Add(globalSendInterval)
+		o.Unlock()
+		time.Sleep(slot.Sub(now))
+
+		err = request()
+		apiErr, ok := err.(tgbotapi.Error)
+		if attempt > 0 || !ok || apiErr.RetryAfter <= 0 || apiErr.RetryAfter > maxAnswerRetryAfter {
+			return
+		}
+		time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+	}
+}
+
+func (o *Outbox) add(req *outboxRequest) (err error) {
+	o.Lock()
+	defer o.Unlock()
+	if o.stopping {
+		err = OutboxStopped
+		return
+	}
+	o.queues[req.chatID] = append(o.queues[req.chatID], req)
+	o.stats.Queued++
+	o.signal()
+	return
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) Stats() (stats OutboxStats) {
+	o.Lock()
+	defer o.Unlock()
+	stats = o.stats
+	stats.Chats = len(o.queues)
+	return
+}
+
+// stops taking requests and waits for the queued ones at most timeout,
+// returns how many were not sent
+func (o *Outbox) Stop(timeout time.Duration) (unsent int) {
+	o.Lock()
+	o.stopping = true
+	o.Unlock()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		stats := o.Stats()
+		if stats.Queued == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	close(o.stop)
+	<-o.done
+	unsent = o.Stats().Queued
+	return
+}
+
+func (o *Outbox) worker() {
+	defer close(o.done)
+	for {
+		timer := time.NewTimer(o.dispatch(time.Now()))
+		select {
+		case <-o.wake:
+		case <-timer.C:
+		case <-o.stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// starts the first requests of chats which may be sent to now,
+// returns when to look again
+func (o *Outbox) dispatch(now time.Time) (wait time.Duration) {
+	o.Lock()
+	defer o.Unlock()
+	wait = outboxIdleWait
+	for chatID, ready := range o.notBefore {
+		if _, queued := o.queues[chatID]; !queued && !ready.After(now) {
+			delete(o.notBefore, chatID)
+		}
+	}
+	for chatID, queue := range o.queues {
+		if o.busy[chatID] {
+			continue
+		}
+		if ready := o.notBefore[chatID]; ready.After(now) {
+			if ready.Sub(now) < wait {
+				wait = ready.Sub(now)
+			}
+			continue
+		}
+		if o.nextSlot.After(now) {
+			if o.nextSlot.Sub(now) < wait {
+				wait = o.nextSlot.Sub(now)
+			}
+			return
+		}
+		o.busy[chatID] = true
+		o.notBefore[chatID] = now.Add(chatSendInterval(chatID))
+		o.nextSlot = now.Add(globalSendInterval)
+		go o.run(queue[0])
+	}
+	return
+}
+
+func chatSendInterval(chatID int64) time.Duration {
+	if chatID < 0 {
+		return groupChatSendInterval
+	}
+	return privateChatSendInterval
+}
+
+func (o *Outbox) run(req *outboxRequest) {
+	m, err := req.call()
+
+	o.Lock()
+	o.busy[req.chatID] = false
+	if err != nil && req.retry && isTransientError(err) && req.attempts+1 < maxSendAttempts {
+		delay := retryDelay(err, req.attempts, sendRetryDelay)
+		req.attempts++
+		o.stats.Retried++
+		req.logger.Warn("Error sending message, retrying", "to_chat_id", req.chatID, "retry_in", delay,
+			"attempt", req.attempts, "err", err)
+		if ready := time.Now().Add(delay); ready.After(o.notBefore[req.chatID]) {
+			o.notBefore[req.chatID] = ready
+		}
+		o.signal()
+		o.Unlock()
+		return
+	}
+	o.queues[req.chatID] = o.queues[req.chatID][1:]
+	if len(o.queues[req.chatID]) == 0 {
+		delete(o.queues, req.chatID)
+		delete(o.busy, req.chatID)
+	}
+	o.stats.Queued--
+	if err != nil {
+		o.stats.Failed++
+	} else {
+		o.stats.Sent++
+	}
+	o.signal()
+	o.Unlock()
+
+	if req.done != nil {
+		req.done(m, err)
+	}
+}
+
+// sends text to the chat and deletes it in timeToDelete seconds
+func sendTemporary(bot *tgbotapi.BotAPI, msg tgbotapi.MessageConfig, timeToDelete int, logger *Logger) (err error) {
+	err = outbox.send(bot, msg, func(m tgbotapi.Message) {
+		deletionScheduler.schedule(tgbotapi.DeleteMessageConfig{ChatID: m.Chat.ID, MessageID: m.MessageID},
+			timeToDelete, logger)
+	}, logger)
+	return
+}
+
+func answerInlineQuery(bot *tgbotapi.BotAPI, config tgbotapi.InlineConfig) (err error) {
+	err = outbox.call(func() (err error) {
+		_, err = bot.AnswerInlineQuery(config)
+		return
+	})
+	return
+}
+
+// "/outbox" shows the depth of the queue and what happened to sent messages
+func outboxCommandExec(m *tgbotapi.Message, store Store, lang Lang) (reply string, err error) {
+	stats := outbox.Stats()
+	reply = tr(lang, "outbox.stats", stats.Queued, stats.Chats, stats.Sent, stats.Retried, stats.Failed)
+	return
+}
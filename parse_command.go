@@ -2,17 +2,18 @@ package main
 
 import (
 	"github.com/go-telegram-bot-api/telegram-bot-api"
-	"log"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func parseSlashQuestion(m *tgbotapi.Message) (q *Question, err error) {
+// "/question [#group] text", receiver is set once the group is chosen
+func parseSlashQuestion(m *tgbotapi.Message) (q *Question, groupName string, err error) {
 	q = new(Question)
 	q.Date = m.Time().UTC()
-	q.User = m.From.UserName
-	q.Rec = NewReceiver(AllGroupName)
-	q.Text = m.CommandArguments()
+	q.UserID = m.From.ID
+	q.User = userDisplayName(m.From)
+	groupName, q.Text = splitGroupTag(m.CommandArguments())
 	if strings.TrimSpace(q.Text) == "" {
 		err = WrongCommandFormat
 		return
@@ -27,13 +28,17 @@ func parseSlashQuestion(m *tgbotapi.Message) (q *Question, err error) {
 func parseSlashQuestionTo(m *tgbotapi.Message) (q *Question, err error) {
 	q = new(Question)
 	q.Date = m.Time().UTC()
-	q.User = m.From.UserName
-	cmd_args := strings.SplitN(m.CommandArguments(), " ", 3)
-	if len(cmd_args) != 3 {
+	q.UserID = m.From.ID
+	q.User = userDisplayName(m.From)
+	// "@user text of the question": the text is everything after the receiver,
+	// splitting in three took only its first word and refused one-word questions
+	cmd_args := strings.SplitN(m.CommandArguments(), " ", 2)
+	if len(cmd_args) != 2 || strings.TrimSpace(cmd_args[1]) == "" {
 		err = WrongCommandFormat
 		return
 	}
-	q.Rec = NewReceiver(strings.Replace(cmd_args[0], "@", "", -1))
+	// receiver id is resolved by name later, when the store is at hand
+	q.Rec = NewReceiver(UnknownUserID, strings.Replace(cmd_args[0], "@", "", -1))
 	q.Text = cmd_args[1]
 	q.Answers = []*Answer{}
 	q.IsClosed = false
@@ -85,14 +90,14 @@ func parseSlashAnswer(m *tgbotapi.Message) (answer *Answer, err error) {
 		err = WrongCommandFormat
 		return
 	}
-	log.Println(cmd_args)
 	quest_id, err := strconv.Atoi(cmd_args[0])
 	if err != nil {
 		return
 	}
 	answer = &Answer{
 		Text:       cmd_args[1],
-		User:       m.From.UserName,
+		UserID:     m.From.ID,
+		User:       userDisplayName(m.From),
 		QuestionID: quest_id,
 		Date:       m.Time(),
 	}
@@ -124,3 +129,218 @@ func parseSlashOpen(m *tgbotapi.Message) (qID int, err error) {
 	}
 	return
 }
+
+func parseSlashImportant(m *tgbotapi.Message) (n *Note, err error) {
+	n = new(Note)
+	n.Date = m.Time().UTC()
+	n.UserID = m.From.ID
+	n.User = userDisplayName(m.From)
+	n.Text = strings.TrimSpace(m.CommandArguments())
+	if n.Text == "" && m.ReplyToMessage != nil {
+		// note is created from the message the command replies to
+		n.Text = m.ReplyToMessage.Text
+		if n.Text == "" {
+			n.Text = m.ReplyToMessage.Caption
+		}
+	}
+	if strings.TrimSpace(n.Text) == "" {
+		err = WrongCommandFormat
+		return
+	}
+	n.NoteID = -1
+	return
+}
+
+func parseSlashDeleteImportant(m *tgbotapi.Message) (noteID int, err error) {
+	if m.CommandArguments() == "" {
+		err = WrongCommandFormat
+		return
+	}
+	noteID, err = strconv.Atoi(m.CommandArguments())
+	if err != nil {
+		err = WrongCommandFormat
+		return
+	}
+	return
+}
+
+// page number is optional and starts from 1
+func parseSlashPage(m *tgbotapi.Message) (page int, err error) {
+	pageStr := strings.TrimSpace(m.CommandArguments())
+	if pageStr == "" {
+		page = 1
+		return
+	}
+	page, err = strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		err = WrongCommandFormat
+		return
+	}
+	return
+}
+
+// arguments are an optional state (open, closed or all) and an optional page number, in any order
+func parseSlashListMy(m *tgbotapi.Message) (state QuestionState, page int, err error) {
+	state = OpenQuestions
+	page = 1
+	args := strings.Fields(m.CommandArguments())
+	if len(args) > 2 {
+		err = WrongCommandFormat
+		return
+	}
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "open":
+			state = OpenQuestions
+		case "closed":
+			state = ClosedQuestions
+		case "all":
+			state = AllQuestions
+		default:
+			page, err = strconv.Atoi(arg)
+			if err != nil || page < 1 {
+				err = WrongCommandFormat
+				return
+			}
+		}
+	}
+	return
+}
+
+// "/register_group name [notification chat id]"
+func parseSlashRegisterGroup(m *tgbotapi.Message) (name string, notificationChatID int64, err error) {
+	args := strings.Fields(m.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		err = WrongCommandFormat
+		return
+	}
+	name = strings.TrimPrefix(args[0], GroupTagPrefix)
+	if name == "" {
+		err = WrongCommandFormat
+		return
+	}
+	if len(args) == 2 {
+		notificationChatID, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			err = WrongCommandFormat
+			return
+		}
+	}
+	return
+}
+
+// "/group_admin add @user" or "/group_admin remove @user"
+func parseSlashGroupAdmin(m *tgbotapi.Message) (add bool, userName string, err error) {
+	args := strings.Fields(m.CommandArguments())
+	if len(args) != 2 {
+		err = WrongCommandFormat
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "add":
+		add = true
+	case "remove":
+		add = false
+	default:
+		err = WrongCommandFormat
+		return
+	}
+	userName = strings.Replace(args[1], "@", "", -1)
+	return
+}
+
+// "/grant @user role"
+func parseSlashGrant(m *tgbotapi.Message) (userName string, role Role, err error) {
+	args := strings.Fields(m.CommandArguments())
+	if len(args) != 2 {
+		err = WrongCommandFormat
+		return
+	}
+	userName = strings.Replace(args[0], "@", "", -1)
+	role, err = parseRole(args[1])
+	if err != nil {
+		return
+	}
+	return
+}
+
+// "/revoke @user"
+func parseSlashRevoke(m *tgbotapi.Message) (userName string, err error) {
+	args := strings.Fields(m.CommandArguments())
+	if len(args) != 1 {
+		err = WrongCommandFormat
+		return
+	}
+	userName = strings.Replace(args[0], "@", "", -1)
+	return
+}
+
+// "/ban @user [reason]"
+func parseSlashBan(m *tgbotapi.Message) (userName string, reason string, err error) {
+	args := strings.SplitN(strings.TrimSpace(m.CommandArguments()), " ", 2)
+	if args[0] == "" {
+		err = WrongCommandFormat
+		return
+	}
+	userName = strings.Replace(args[0], "@", "", -1)
+	if len(args) == 2 {
+		reason = strings.TrimSpace(args[1])
+	}
+	return
+}
+
+// "/mute @user duration [reason]"
+func parseSlashMute(m *tgbotapi.Message) (userName string, duration time.Duration, reason string, err error) {
+	args := strings.SplitN(strings.TrimSpace(m.CommandArguments()), " ", 3)
+	if len(args) < 2 {
+		err = WrongCommandFormat
+		return
+	}
+	userName = strings.Replace(args[0], "@", "", -1)
+	duration, err = parseDuration(args[1])
+	if err != nil {
+		return
+	}
+	if len(args) == 3 {
+		reason = strings.TrimSpace(args[2])
+	}
+	return
+}
+
+// durations of time.ParseDuration and days like "7d"
+func parseDuration(s string) (duration time.Duration, err error) {
+	if strings.HasSuffix(s, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(s, "d"))
+		duration = time.Duration(days) * 24 * time.Hour
+	} else {
+		duration, err = time.ParseDuration(s)
+	}
+	if err != nil || duration <= 0 {
+		err = WrongCommandFormat
+		return
+	}
+	return
+}
+
+// optional @user and page number, in any order
+func parseSlashSanctions(m *tgbotapi.Message) (userName string, page int, err error) {
+	page = 1
+	args := strings.Fields(m.CommandArguments())
+	if len(args) > 2 {
+		err = WrongCommandFormat
+		return
+	}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "@") {
+			userName = strings.TrimPrefix(arg, "@")
+			continue
+		}
+		page, err = strconv.Atoi(arg)
+		if err != nil || page < 1 {
+			err = WrongCommandFormat
+			return
+		}
+	}
+	return
+}
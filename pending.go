@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// PendingStore keeps messages of MessagePull, so they can outlive the bot process
+type PendingStore interface {
+	// replaces message with the same tag
+	savePending(m *TempMessage) (err error)
+	getPending(tag string) (m *TempMessage, err error)
+	// deletes the message and returns it, only one of concurrent calls gets it
+	takePending(tag string) (m *TempMessage, err error)
+	deletePending(tag string) (err error)
+	// deletes messages saved before the time, it is unix seconds
+	deleteExpiredPending(before int64) (count int, err error)
+	// deletes the oldest messages, so no more than keep are left
+	evictPending(keep int) (count int, err error)
+	countPending() (count int, err error)
+}
+
+const PendingMemory = "memory"
+const PendingInStore = "store"
+
+const pendingQuestion = "question"
+const pendingAnswer = "answer"
+
+// pending store chosen by config, main one by default
+func NewPendingStore(config *AppConfig, store Store) (pending PendingStore, err error) {
+	switch config.PendingStore {
+	case "", PendingInStore:
+		pending = store
+	case PendingMemory:
+		pending = NewMemoryStore()
+	default:
+		err = WrongValue
+	}
+	return
+}
+
+// messages are kept as json with their kind, so they are restored with their type
+func encodePending(m Message) (kind string, data string, err error) {
+	switch m.(type) {
+	case *Question:
+		kind = pendingQuestion
+	case *Answer:
+		kind = pendingAnswer
+	default:
+		err = WrongValue
+		return
+	}
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	data = string(bytes)
+	return
+}
+
+func decodePending(kind string, data string) (m Message, err error) {
+	switch kind {
+	case pendingQuestion:
+		m = new(Question)
+	case pendingAnswer:
+		m = new(Answer)
+	default:
+		err = WrongValue
+		return
+	}
+	err = json.Unmarshal([]byte(data), m)
+	if err != nil {
+		return
+	}
+	return
+}
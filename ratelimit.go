@@ -0,0 +1,169 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"math"
+	"sync"
+	"time"
+)
+
+// buckets full longer than this are forgotten, a new one is full as well
+const rateBucketsCleanInterval = 10 * time.Minute
+
+// RateLimiter keeps token buckets of users and group chats. Budgets are read
+// from the config on every update, so reloaded limits apply at once
+type RateLimiter struct {
+	sync.Mutex
+	buckets   map[rateKey]*tokenBucket
+	lastClean time.Time
+}
+
+// user buckets have chat 0, chat buckets have user 0
+type rateKey struct {
+	userID int
+	chatID int64
+	writes bool
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	warned  bool // the user was told to slow down since the bucket ran out
+}
+
+var rateLimiter = NewRateLimiter()
+
+func NewRateLimiter() (l *RateLimiter) {
+	l = &RateLimiter{buckets: make(map[rateKey]*tokenBucket), lastClean: time.Now()}
+	return
+}
+
+// takes a token from each bucket or, if any of them is empty, from none. Returns how long
+// to wait for the missing token and whether the user is to be told about it
+func (l *RateLimiter) take(now time.Time, keys []rateKey, budgets []RateBudget) (wait time.Duration, warn bool) {
+	l.Lock()
+	defer l.Unlock()
+	l.clean(now)
+	buckets := make([]*tokenBucket, len(keys))
+	for ind, key := range keys {
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &tokenBucket{tokens: float64(budgets[ind].Burst), updated: now}
+			l.buckets[key] = b
+		}
+		b.refill(now, budgets[ind])
+		buckets[ind] = b
+		if b.tokens < 1 {
+			perToken := time.Duration(float64(time.Minute) / float64(budgets[ind].PerMinute))
+			missing := time.Duration((1 - b.tokens) * float64(perToken))
+			if missing > wait {
+				wait = missing
+			}
+		}
+	}
+	if wait > 0 {
+		for _, b := range buckets {
+			if b.tokens < 1 && !b.warned {
+				b.warned = true
+				warn = true
+			}
+		}
+		return
+	}
+	for _, b := range buckets {
+		b.tokens--
+		b.warned = false
+	}
+	return
+}
+
+func (b *tokenBucket) refill(now time.Time, budget RateBudget) {
+	elapsed := now.Sub(b.updated).Minutes()
+	b.tokens = math.Min(float64(budget.Burst), b.tokens+elapsed*float64(budget.PerMinute))
+	b.updated = now
+}
+
+// forgets buckets which would be full by now
+func (l *RateLimiter) clean(now time.Time) {
+	if now.Sub(l.lastClean) < rateBucketsCleanInterval {
+		return
+	}
+	l.lastClean = now
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= rateBucketsCleanInterval {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// group chat of the update, 0 for private chats and inline queries
+func updateChat(update *Update) int64 {
+	switch {
+	case update.CallbackQuery != nil:
+		if update.CallbackQuery.Message != nil {
+			return commandChat(update.CallbackQuery.Message.Chat)
+		}
+	case update.Message != nil:
+		return commandChat(update.Message.Chat)
+	}
+	return 0
+}
+
+// stops updates of users and chats over their budgets, reports whether the update is stopped.
+// The user is asked to slow down once, until a token is taken again the updates are just dropped
+func checkRateLimits(bot *tgbotapi.BotAPI, update *Update, store Store, config *AppConfig,
+	logger *Logger) (stopped bool) {
+	from, writes := updateAuthor(update)
+	if from == nil {
+		return
+	}
+	chatID := updateChat(update)
+	role, err := userRole(store, from.ID, chatID)
+	if err != nil {
+		logger.Error("Error getting role", "err", err)
+	} else if permits(role, ActionExceedLimits) {
+		return
+	}
+
+	limits := config.RateLimits
+	var keys []rateKey
+	var budgets []RateBudget
+	add := func(key rateKey, budget RateBudget) {
+		if budget.PerMinute > 0 {
+			keys = append(keys, key)
+			budgets = append(budgets, budget)
+		}
+	}
+	if writes {
+		add(rateKey{userID: from.ID, writes: true}, limits.UserWrites)
+	} else {
+		add(rateKey{userID: from.ID}, limits.UserReads)
+	}
+	if chatID != 0 {
+		if writes {
+			add(rateKey{chatID: chatID, writes: true}, limits.ChatWrites)
+		} else {
+			add(rateKey{chatID: chatID}, limits.ChatReads)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	wait, warn := rateLimiter.take(time.Now(), keys, budgets)
+	if wait == 0 {
+		return
+	}
+	stopped = true
+	logger.Info("Update rate limited", "wait", wait, "warned", warn)
+	if !warn {
+		return
+	}
+	seconds := int(math.Ceil(wait.Seconds()))
+	err = replyToUpdate(bot, update, store, config, func(lang Lang) string {
+		return tr(lang, "ratelimit.slow_down", seconds)
+	}, logger)
+	if err != nil {
+		logger.Error("Error sending rate limit notice", "err", err)
+	}
+	return
+}
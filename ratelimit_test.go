@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	user := rateKey{userID: 1, writes: true}
+	chat := rateKey{chatID: -100, writes: true}
+	budgets := map[rateKey]RateBudget{
+		user: {PerMinute: 6, Burst: 2}, // a token in 10 seconds
+		chat: {PerMinute: 60, Burst: 1},
+	}
+	steps := []struct {
+		name  string
+		after time.Duration
+		keys  []rateKey
+		wait  time.Duration
+		warn  bool
+	}{
+		{"burst", 0, []rateKey{user}, 0, false},
+		{"burst", 0, []rateKey{user}, 0, false},
+		{"empty bucket", 0, []rateKey{user}, 10 * time.Second, true},
+		{"warned once", 0, []rateKey{user}, 10 * time.Second, false},
+		{"half refilled", 5 * time.Second, []rateKey{user}, 5 * time.Second, false},
+		{"refilled", 10 * time.Second, []rateKey{user, chat}, 0, false},
+		// the chat bucket is full again, but the user one is not
+		{"user and chat", 12 * time.Second, []rateKey{user, chat}, 8 * time.Second, true},
+		{"nothing taken from chat", 12 * time.Second, []rateKey{chat}, 0, false},
+		// both buckets are forgotten, the new user one is full
+		{"cleaned", 12*time.Second + rateBucketsCleanInterval, []rateKey{user}, 0, false},
+		{"cleaned", 12*time.Second + rateBucketsCleanInterval, []rateKey{user}, 0, false},
+		{"cleaned", 12*time.Second + rateBucketsCleanInterval, []rateKey{user}, 10 * time.Second, true},
+	}
+	limiter := NewRateLimiter()
+	start := limiter.lastClean
+	for ind, step := range steps {
+		var stepBudgets []RateBudget
+		for _, key := range step.keys {
+			stepBudgets = append(stepBudgets, budgets[key])
+		}
+		wait, warn := limiter.take(start.Add(step.after), step.keys, stepBudgets)
+		if wait.Round(time.Millisecond) != step.wait || warn != step.warn {
+			t.Errorf("step %d (%s): got wait %v, warn %v, want %v, %v", ind, step.name, wait, warn, step.wait, step.warn)
+		}
+	}
+	if len(limiter.buckets) != 1 {
+		t.Errorf("%d buckets are kept after cleaning, want 1", len(limiter.buckets))
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"sort"
+	"strings"
+)
+
+// ChatType is a set of chats, where a slash command may be used
+type ChatType int
+
+const (
+	PrivateChat ChatType = 1 << iota
+	GroupChat
+	AnyChat = PrivateChat | GroupChat
+)
+
+// Name is a key of the message catalog
+type CommandArg struct {
+	Name     string
+	Optional bool
+}
+
+// lang is the language of replies to the author
+type SlashHandler func(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error)
+
+// args is the query without the command name
+type InlineHandler func(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery, args string,
+	store Store, lang Lang, logger *Logger) (err error)
+
+// Command describes a bot command, Slash and Inline handle its forms,
+// a command without one of them doesn't have that form.
+// Its description is "cmd.<name>" of the message catalog, examples are "examples.<name>"
+type Command struct {
+	Name    string
+	Aliases []string
+	Args    []CommandArg
+	Chats   ChatType // chats of the slash form, AnyChat if not set
+	Action  Action   // checked in the chat of the command, ActionUse if not set
+	Slash   SlashHandler
+	Inline  InlineHandler
+}
+
+func (c *Command) help(lang Lang) string {
+	return tr(lang, "cmd."+c.Name)
+}
+
+// full examples, like "/answer 12 текст ответа" or "@bot list_answers 12"
+func (c *Command) examples(lang Lang) []string {
+	text, ok := lookupMessage(lang, "examples."+c.Name)
+	if !ok {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func (c *Command) usage(lang Lang) string {
+	args := make([]string, len(c.Args))
+	for ind, arg := range c.Args {
+		if arg.Optional {
+			args[ind] = "[" + tr(lang, arg.Name) + "]"
+		} else {
+			args[ind] = "<" + tr(lang, arg.Name) + ">"
+		}
+	}
+	return strings.TrimSpace("/" + c.Name + " " + strings.Join(args, " "))
+}
+
+// the last argument takes the rest of the line, so only the count of required ones is checked
+func (c *Command) checkArgs(args string) (err error) {
+	required := 0
+	for _, arg := range c.Args {
+		if !arg.Optional {
+			required++
+		}
+	}
+	if len(strings.Fields(args)) < required {
+		err = WrongCommandFormat
+		return
+	}
+	return
+}
+
+func (c *Command) allowedIn(chat *tgbotapi.Chat) bool {
+	chats := c.Chats
+	if chats == 0 {
+		chats = AnyChat
+	}
+	if isUserChat(chat) {
+		return chats&PrivateChat != 0
+	}
+	return chats&GroupChat != 0
+}
+
+func (c *Command) action() Action {
+	if c.Action == "" {
+		return ActionUse
+	}
+	return c.Action
+}
+
+func (c *Command) allowedFor(role Role) bool {
+	return permits(role, c.action())
+}
+
+type CommandRegistry struct {
+	commands []*Command
+	byName   map[string]*Command // names and aliases
+}
+
+var commandRegistry = &CommandRegistry{byName: make(map[string]*Command)}
+
+func (r *CommandRegistry) register(c *Command) {
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if _, ok := r.byName[name]; ok {
+			logger.Fatal("Command is registered twice", "command", name)
+		}
+		r.byName[name] = c
+	}
+	r.commands = append(r.commands, c)
+}
+
+func (r *CommandRegistry) lookup(name string) (c *Command, ok bool) {
+	c, ok = r.byName[strings.ToLower(name)]
+	return
+}
+
+// commands sorted by name
+func (r *CommandRegistry) list() (commands []*Command) {
+	commands = append(commands, r.commands...)
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return
+}
+
+func commandExec(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store Store, logger *Logger) (reply string, err error) {
+	m := update.Message
+	lang := userLang(store, m.From, m.Chat)
+	c, ok := commandRegistry.lookup(m.Command())
+	if !ok || c.Slash == nil {
+		logger.Info("Unknown command")
+		err = UknownCommand
+		reply = tr(lang, "command.unknown")
+		return
+	}
+	if !c.allowedIn(m.Chat) {
+		err = WrongChatType
+		if c.Chats == PrivateChat {
+			reply = tr(lang, "command.private_only")
+		} else {
+			reply = tr(lang, "command.group_only")
+		}
+		return
+	}
+	if !authorize(store, m.From.ID, c.action(), commandChat(m.Chat), logger) {
+		err = NotEnoughPermissions
+		reply = tr(lang, "error.permissions")
+		return
+	}
+	err = c.checkArgs(m.CommandArguments())
+	if err != nil {
+		reply = tr(lang, "command.usage", c.usage(lang))
+		return
+	}
+	reply, err = c.Slash(bot, m, store, lang, logger)
+	return
+}
+
+func processInlineQuery(bot *tgbotapi.BotAPI, update *tgbotapi.Update, store Store, logger *Logger) (err error) {
+	query := update.InlineQuery
+	logger.Info("Inline query received", "from", query.From.UserName, "query", RedactedText(query.Query))
+	lang := userLang(store, query.From, nil)
+
+	if query.Query == "" {
+		err = sendEnterReply(bot, update, lang)
+		if err != nil {
+			logger.Error("Error sending enter reply", "err", err)
+			return
+		}
+		return
+	}
+	command, commandArgs := parseQuery(query.Query)
+	c, ok := commandRegistry.lookup(command)
+	if !ok || c.Inline == nil {
+		err = sendNotExistReply(bot, update, lang)
+		if err != nil {
+			logger.Error("Error sending not exists reply", "err", err)
+			return
+		}
+		return
+	}
+	if !authorize(store, query.From.ID, c.action(), 0, logger) {
+		sendSimpleStringReply(bot, query.ID, tr(lang, "error.permissions"))
+		err = NotEnoughPermissions
+		return
+	}
+	err = c.Inline(bot, query, commandArgs, store, lang, logger)
+	if err != nil {
+		logger.Error("Error sending inline reply", "err", err)
+	}
+	return
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// settings used only at startup, reloaded values of them wait for a restart
+var restartSettings = map[string]bool{
+	"TelegramBotToken":     true,
+	"DBDriver":             true,
+	"DBSource":             true,
+	"Webhook":              true,
+	"PendingStore":         true,
+	"PendingTTL":           true,
+	"PendingLimit":         true,
+	"PendingCleanInterval": true,
+	"AdminSyncInterval":    true,
+	"Workers":              true,
+	"WorkerQueueSize":      true,
+}
+
+// values of these are not shown in reports
+var secretSettings = map[string]bool{
+	"TelegramBotToken": true,
+	"CallbackSecret":   true,
+}
+
+// one reload at a time, so reports follow each other
+var reloadLock sync.Mutex
+
+// reads config again and replaces the current one, changes are reported to
+// the admin log chat and to reportChatID if it is set and another chat
+func reloadConfig(bot *tgbotapi.BotAPI, store Store, reportChatID int64, logger *Logger) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	old := currentConfig()
+	config, err := loadAppConfig(true)
+	if err != nil {
+		logger.Error("Config is not reloaded", "err", err)
+		reportToAdmins(bot, store, old.AdminLogChatID, reportChatID, func(lang Lang) string {
+			return tr(lang, "config.failed", err)
+		}, logger)
+		return
+	}
+	resolveAdminNames(store, config, logger)
+	changed, waiting := keepRestartSettings(old, config)
+	setAppConfig(config)
+	logger.Info("Config is reloaded", "changed", strings.Join(changed, ","), "waiting", strings.Join(waiting, ","))
+
+	if !reflect.DeepEqual(old.Groups, config.Groups) {
+		err = registerConfigGroups(store, config)
+		if err != nil {
+			logger.Error("Error registering groups", "err", err)
+		}
+	}
+	if !reflect.DeepEqual(old.Admins, config.Admins) || !reflect.DeepEqual(old.Groups, config.Groups) {
+		go syncBotCommands(bot, store, logger)
+	}
+	reportToAdmins(bot, store, config.AdminLogChatID, reportChatID, func(lang Lang) string {
+		return configDiff(old, config, changed, waiting, lang)
+	}, logger)
+}
+
+// copies settings used only at startup from old to config,
+// returns names of changed settings and of the kept ones
+func keepRestartSettings(old *AppConfig, config *AppConfig) (changed []string, waiting []string) {
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(config).Elem()
+	for i := 0; i < newValue.NumField(); i++ {
+		name := newValue.Type().Field(i).Name
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+		changed = append(changed, name)
+		if restartSettings[name] {
+			waiting = append(waiting, name)
+			newValue.Field(i).Set(oldValue.Field(i))
+		}
+	}
+	return
+}
+
+// report of a reload: "Setting: old -> new" for every changed setting
+func configDiff(old *AppConfig, config *AppConfig, changed []string, waiting []string, lang Lang) string {
+	if len(changed) == 0 {
+		return tr(lang, "config.unchanged")
+	}
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(config).Elem()
+	lines := []string{tr(lang, "config.reloaded")}
+	for _, name := range changed {
+		if restartSettings[name] {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", name,
+			formatSetting(name, oldValue.FieldByName(name)), formatSetting(name, newValue.FieldByName(name))))
+	}
+	if len(waiting) > 0 {
+		lines = append(lines, tr(lang, "config.restart", strings.Join(waiting, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatSetting(name string, value reflect.Value) string {
+	if secretSettings[name] {
+		return "***"
+	}
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return "-"
+	}
+	data, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprintf("%v", value.Interface())
+	}
+	return string(data)
+}
+
+// sends text in the language of each chat, chats equal to 0 are skipped
+func reportToAdmins(bot *tgbotapi.BotAPI, store Store, logChatID int64, reportChatID int64,
+	text func(lang Lang) string, logger *Logger) {
+	chats := []int64{logChatID}
+	if reportChatID != logChatID {
+		chats = append(chats, reportChatID)
+	}
+	for _, chatID := range chats {
+		if chatID == 0 {
+			continue
+		}
+		err := outbox.send(bot, tgbotapi.NewMessage(chatID, text(chatLang(store, chatID))), nil, logger)
+		if err != nil {
+			logger.Error("Error sending report", "to_chat_id", chatID, "err", err)
+		}
+	}
+}
+
+// "/reload_config" rereads config like SIGHUP does. The reload waits for
+// handlers of updates in progress, this one too, so it runs on its own
+func reloadConfigCommandExec(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	go reloadConfig(bot, store, m.Chat.ID, logger)
+	reply = tr(lang, "config.reloading")
+	return
+}
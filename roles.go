@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"sort"
+	"strings"
+)
+
+// Role is who a user is, roles are compared by rank: banned < member < moderator < admin < owner.
+// Owners are AppConfig.Admins, other roles are granted in the store for a group chat
+// or, with chat id 0, for all chats
+type Role int
+
+const (
+	RoleMember Role = iota
+	RoleModerator
+	RoleAdmin
+	RoleOwner
+	RoleBanned Role = -1
+)
+
+var roleNames = map[Role]string{
+	RoleBanned:    "banned",
+	RoleMember:    "member",
+	RoleModerator: "moderator",
+	RoleAdmin:     "admin",
+	RoleOwner:     "owner",
+}
+
+func (r Role) String() string {
+	name, ok := roleNames[r]
+	if !ok {
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+	return name
+}
+
+func parseRole(s string) (role Role, err error) {
+	for r, name := range roleNames {
+		if strings.EqualFold(s, name) {
+			role = r
+			return
+		}
+	}
+	err = WrongValue
+	return
+}
+
+// UserRole is a role granted to a user, ChatID is 0 for roles in all chats
+type UserRole struct {
+	UserID int
+	ChatID int64
+	Role   Role
+}
+
+// Action is something not everyone may do
+type Action string
+
+const (
+	ActionUse            Action = "use"             // commands without an action of their own
+	ActionPost           Action = "post"            // add questions, answers and notes, muted users can't
+	ActionCloseQuestion  Action = "close_question"  // close and reopen questions of others
+	ActionDeleteQuestion Action = "delete_question" // of others
+	ActionDeleteAnswer   Action = "delete_answer"   // of others
+	ActionDeleteNote     Action = "delete_note"     // of others
+	ActionManageGroup    Action = "manage_group"    // register it and change its language
+	ActionManageRoles    Action = "manage_roles"    // grant roles below the own one
+	ActionGroupAdmins    Action = "group_admins"    // change admins listed in the group
+	ActionMuteUsers      Action = "mute_users"
+	ActionBanUsers       Action = "ban_users" // and lift bans and mutes
+	ActionReloadConfig   Action = "reload_config"
+	ActionExceedLimits   Action = "exceed_limits" // not be slowed down by rate limits
+	ActionViewStats      Action = "view_stats"    // see queues of updates and messages
+)
+
+// the lowest role allowed to do an action. Authors of questions,
+// answers and notes may do anything but banned with their own
+var policy = map[Action]Role{
+	ActionUse:            RoleMember,
+	ActionPost:           RoleMember,
+	ActionCloseQuestion:  RoleModerator,
+	ActionDeleteQuestion: RoleModerator,
+	ActionDeleteAnswer:   RoleModerator,
+	ActionDeleteNote:     RoleAdmin,
+	ActionManageGroup:    RoleAdmin,
+	ActionManageRoles:    RoleAdmin,
+	ActionGroupAdmins:    RoleOwner,
+	ActionMuteUsers:      RoleModerator,
+	ActionBanUsers:       RoleAdmin,
+	ActionReloadConfig:   RoleOwner,
+	ActionExceedLimits:   RoleAdmin,
+	ActionViewStats:      RoleOwner,
+}
+
+// adds ids of known users from config.AdminNames to config.Admins, names of
+// users the bot hasn't met yet stay there and are tried again on reload
+func resolveAdminNames(store Store, config *AppConfig, logger *Logger) {
+	var unknown []string
+	for _, name := range config.AdminNames {
+		user, err := store.findUserByName(name)
+		if err == UserDoesntExist {
+			logger.Warn("Admin username is unknown, the user is not an admin until they write to the bot",
+				"username", name)
+		} else if err != nil {
+			logger.Error("Error finding admin", "username", name, "err", err)
+		}
+		if err != nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		found := false
+		for _, id := range config.Admins {
+			found = found || id == user.ID
+		}
+		if !found {
+			config.Admins = append(config.Admins, user.ID)
+		}
+		logger.Info("Admin username migrated to id, replace it in the config", "username", name, "user_id", user.ID)
+	}
+	config.AdminNames = unknown
+}
+
+func isOwner(userID int) bool {
+	for _, id := range currentConfig().Admins {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// role of the user in the chat, chatID is 0 or a private chat for the role in all chats.
+// A ban in the chat or in all chats outweighs other roles
+func userRole(store Store, userID int, chatID int64) (role Role, err error) {
+	if isOwner(userID) {
+		role = RoleOwner
+		return
+	}
+	role, err = store.getRole(userID, 0)
+	if err != nil || role == RoleBanned || chatID >= 0 {
+		return
+	}
+	chatRole, err := store.getRole(userID, chatID)
+	if err != nil {
+		return
+	}
+	if chatRole == RoleBanned {
+		role = RoleBanned
+		return
+	}
+	if chatRole > role {
+		role = chatRole
+	}
+	g, groupErr := store.getGroup(chatID)
+	if groupErr == nil && g.IsAdmin(userID) && role < RoleAdmin {
+		role = RoleAdmin
+	}
+	return
+}
+
+func permits(role Role, action Action) bool {
+	required, ok := policy[action]
+	if !ok {
+		logger.Error("Action is not in the policy", "action", action)
+		return false
+	}
+	return role >= required
+}
+
+// the only place, which decides if the user may do the action in the chat.
+// authors are users doing it to their own things, they need only not to be banned
+func authorize(store Store, userID int, action Action, chatID int64, logger *Logger, authors ...int) bool {
+	role, err := userRole(store, userID, chatID)
+	if err != nil {
+		logger.Error("Error getting role", "err", err)
+		return false
+	}
+	if role != RoleBanned {
+		for _, author := range authors {
+			if author == userID {
+				return true
+			}
+		}
+	}
+	if permits(role, action) {
+		return true
+	}
+	logger.Warn("Denied", "action", action, "role_chat_id", chatID, "role", role, "needs", policy[action])
+	return false
+}
+
+// roles of group chats apply to their questions, roles in all chats to the rest
+func questionChat(q *Question) int64 {
+	if q.Rec.IsGroup() {
+		return q.Rec.ID
+	}
+	return 0
+}
+
+// author and receiver may close and reopen the question
+func authorizeCloseQuestion(store Store, userID int, q *Question, logger *Logger) bool {
+	authors := []int{q.UserID}
+	if !q.Rec.IsGroup() {
+		authors = append(authors, int(q.Rec.ID))
+	}
+	return authorize(store, userID, ActionCloseQuestion, questionChat(q), logger, authors...)
+}
+
+// chat, whose roles apply to commands sent there
+func commandChat(chat *tgbotapi.Chat) int64 {
+	if chat == nil || isUserChat(chat) {
+		return 0
+	}
+	return chat.ID
+}
+
+// "/grant @user moderator" in a group chat grants the role there, in the private chat in all chats.
+// Users change roles only of users below them and only to roles below their own
+func grantCommandExec(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	userName, role, err := parseSlashGrant(m)
+	if err != nil {
+		reply = tr(lang, "roles.format")
+		return
+	}
+	reply, err = changeRole(bot, m, store, userName, role, lang, logger)
+	return
+}
+
+// "/revoke @user" takes back the role granted in this chat or, in the private chat, in all chats
+func revokeCommandExec(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store, lang Lang,
+	logger *Logger) (reply string, err error) {
+	userName, err := parseSlashRevoke(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	reply, err = changeRole(bot, m, store, userName, RoleMember, lang, logger)
+	return
+}
+
+func changeRole(bot *tgbotapi.BotAPI, m *tgbotapi.Message, store Store,
+	userName string, role Role, lang Lang, logger *Logger) (reply string, err error) {
+	chatID := commandChat(m.Chat)
+	if role == RoleOwner {
+		reply = tr(lang, "roles.owner_config")
+		err = WrongValue
+		return
+	}
+	user, err := store.findUserByName(userName)
+	if err != nil {
+		if err == UserDoesntExist {
+			reply = tr(lang, "user.unknown")
+		} else {
+			reply = tr(lang, "error.db")
+		}
+		return
+	}
+	actorRole, err := userRole(store, m.From.ID, chatID)
+	if err != nil {
+		reply = tr(lang, "error.db")
+		return
+	}
+	targetRole, err := userRole(store, user.ID, chatID)
+	if err != nil {
+		reply = tr(lang, "error.db")
+		return
+	}
+	if actorRole != RoleOwner && (targetRole >= actorRole || role >= actorRole) {
+		logger.Warn("Denied changing role", "target_user_id", user.ID, "target_role", targetRole,
+			"new_role", role, "role_chat_id", chatID, "role", actorRole)
+		err = NotEnoughPermissions
+		reply = tr(lang, "error.permissions")
+		return
+	}
+	err = store.setRole(user.ID, chatID, role)
+	if err != nil {
+		logger.Error("Error setting role", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	logger.Info("Role changed", "target_user_id", user.ID, "role_chat_id", chatID, "new_role", role)
+	go syncBotCommands(bot, store, logger)
+	reply = tr(lang, "roles.set", user.Mention(), role)
+	return
+}
+
+// "/roles" lists roles granted in this chat or, in the private chat, in all chats
+func listRolesCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	chatID := commandChat(m.Chat)
+	roles, err := store.findRoles()
+	if err != nil {
+		logger.Error("Error listing roles", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	lines := []string{}
+	for _, r := range roles {
+		if r.ChatID != chatID {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", storedUserMention(store, r.UserID), r.Role))
+	}
+	if len(lines) == 0 {
+		reply = tr(lang, "roles.none")
+		return
+	}
+	sort.Strings(lines)
+	reply = strings.Join(lines, "\n")
+	return
+}
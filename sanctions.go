@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"strings"
+	"time"
+)
+
+// author of the update and whether the update adds a question, an answer or a note
+func updateAuthor(update *Update) (from *tgbotapi.User, posts bool) {
+	switch {
+	case update.CallbackQuery != nil:
+		command := strings.SplitN(update.CallbackQuery.Data, CallbackDataDelimiter, 2)[0]
+		return update.CallbackQuery.From, command == CallbackAddCommand
+	case update.InlineQuery != nil:
+		command, _ := parseQuery(update.InlineQuery.Query)
+		return update.InlineQuery.From, commandPosts(command)
+	case update.Message != nil && update.Message.IsCommand():
+		return update.Message.From, commandPosts(update.Message.Command())
+	}
+	return nil, false
+}
+
+func commandPosts(name string) bool {
+	c, ok := commandRegistry.lookup(name)
+	return ok && c.action() == ActionPost
+}
+
+// stops updates of banned users and posts of muted ones, reports whether the update
+// is stopped. The user is told about each sanction once, later updates are just dropped
+func checkSanctions(bot *tgbotapi.BotAPI, update *Update, store Store, config *AppConfig,
+	logger *Logger) (stopped bool) {
+	from, posts := updateAuthor(update)
+	if from == nil {
+		return
+	}
+	sanctions, err := store.findActiveSanctions(from.ID, time.Now())
+	if err != nil {
+		logger.Error("Error getting sanctions", "err", err)
+		return
+	}
+	for _, sanction := range sanctions {
+		if sanction.Kind == SanctionMute && !posts {
+			continue
+		}
+		stopped = true
+		logger.Info("Update dropped", "sanction", sanction.Kind, "sanction_id", sanction.ID)
+		if sanction.Notified {
+			return
+		}
+		err = replyToUpdate(bot, update, store, config, func(lang Lang) string {
+			return sanctionNotice(sanction, lang)
+		}, logger)
+		if err != nil {
+			logger.Error("Error sending sanction notice", "err", err)
+			return
+		}
+		err = store.markSanctionNotified(sanction.ID)
+		if err != nil {
+			logger.Error("Error saving sanction notice", "err", err)
+		}
+		return
+	}
+	return
+}
+
+// replies to the update in the language of its author, replies to
+// messages are deleted together with the messages like errors are
+func replyToUpdate(bot *tgbotapi.BotAPI, update *Update, store Store, config *AppConfig,
+	text func(lang Lang) string, logger *Logger) (err error) {
+	switch {
+	case update.CallbackQuery != nil:
+		lang := userLang(store, update.CallbackQuery.From, nil)
+		err = sendCallbackNotification(bot, update.CallbackQuery.ID, text(lang))
+	case update.InlineQuery != nil:
+		lang := userLang(store, update.InlineQuery.From, nil)
+		err = sendSimpleStringReply(bot, update.InlineQuery.ID, text(lang))
+	default:
+		m := update.Message
+		lang := userLang(store, m.From, m.Chat)
+		msg := tgbotapi.NewMessage(m.Chat.ID, text(lang))
+		msg.ReplyToMessageID = m.MessageID
+		timeToDelete := config.ErrorsTimeToDelete
+		err = sendTemporary(bot, msg, timeToDelete, logger)
+		if err != nil {
+			return
+		}
+		deletionScheduler.schedule(tgbotapi.DeleteMessageConfig{ChatID: m.Chat.ID, MessageID: m.MessageID},
+			timeToDelete, logger)
+	}
+	return
+}
+
+func sanctionNotice(sanction *Sanction, lang Lang) string {
+	if sanction.Kind == SanctionMute {
+		return tr(lang, "sanction.mute_notice", formatDate(lang, sanction.Until), sanctionReason(sanction, lang))
+	}
+	if sanction.Until.IsZero() {
+		return tr(lang, "sanction.ban_notice", sanctionReason(sanction, lang))
+	}
+	return tr(lang, "sanction.ban_until_notice", formatDate(lang, sanction.Until), sanctionReason(sanction, lang))
+}
+
+func sanctionReason(sanction *Sanction, lang Lang) string {
+	if sanction.Reason == "" {
+		return tr(lang, "sanction.no_reason")
+	}
+	return sanction.Reason
+}
+
+// mention of a user met by the bot, "id<telegram id>" for others
+func storedUserMention(store Store, userID int) string {
+	user, err := store.getUser(userID)
+	if err != nil {
+		return fmt.Sprintf("id%d", userID)
+	}
+	return user.Mention()
+}
+
+// "/ban @user [reason]"
+func banCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	userName, reason, err := parseSlashBan(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	reply, err = addSanction(m, store, &Sanction{Kind: SanctionBan, Reason: reason}, userName, lang, logger)
+	return
+}
+
+// "/mute @user 2h [reason]", durations are like 30m, 12h or 7d
+func muteCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	userName, duration, reason, err := parseSlashMute(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	sanction := &Sanction{Kind: SanctionMute, Reason: reason, Until: time.Now().Add(duration)}
+	reply, err = addSanction(m, store, sanction, userName, lang, logger)
+	return
+}
+
+// users may sanction only users below them
+func addSanction(m *tgbotapi.Message, store Store, sanction *Sanction,
+	userName string, lang Lang, logger *Logger) (reply string, err error) {
+	user, err := store.findUserByName(userName)
+	if err != nil {
+		if err == UserDoesntExist {
+			reply = tr(lang, "user.unknown")
+		} else {
+			reply = tr(lang, "error.db")
+		}
+		return
+	}
+	actorRole, err := userRole(store, m.From.ID, 0)
+	if err != nil {
+		reply = tr(lang, "error.db")
+		return
+	}
+	targetRole, err := userRole(store, user.ID, 0)
+	if err != nil {
+		reply = tr(lang, "error.db")
+		return
+	}
+	if targetRole >= actorRole {
+		logger.Warn("Denied sanction", "sanction", sanction.Kind, "target_user_id", user.ID,
+			"target_role", targetRole, "role", actorRole)
+		err = NotEnoughPermissions
+		reply = tr(lang, "error.permissions")
+		return
+	}
+	sanction.UserID = user.ID
+	sanction.ByUserID = m.From.ID
+	sanction.Date = time.Now()
+	_, err = store.addSanction(sanction)
+	if err != nil {
+		logger.Error("Error adding sanction", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	logger.Info("Sanction added", "sanction", sanction.Kind, "target_user_id", user.ID,
+		"until", sanction.Until, "reason", RedactedText(sanction.Reason))
+	if sanction.Kind == SanctionMute {
+		reply = tr(lang, "sanction.muted", user.Mention(), formatDate(lang, sanction.Until))
+	} else {
+		reply = tr(lang, "sanction.banned", user.Mention())
+	}
+	return
+}
+
+// "/unban @user" lifts active bans and mutes of the user
+func unbanCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	userName, err := parseSlashRevoke(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	user, err := store.findUserByName(userName)
+	if err != nil {
+		if err == UserDoesntExist {
+			reply = tr(lang, "user.unknown")
+		} else {
+			reply = tr(lang, "error.db")
+		}
+		return
+	}
+	lifted, err := store.liftSanctions(user.ID, m.From.ID, time.Now())
+	if err != nil {
+		logger.Error("Error lifting sanctions", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	if lifted == 0 {
+		reply = tr(lang, "sanction.none_active", user.Mention())
+		return
+	}
+	logger.Info("Sanctions lifted", "target_user_id", user.ID, "lifted", lifted)
+	reply = tr(lang, "sanction.lifted", user.Mention())
+	return
+}
+
+// "/bans [@user] [page]" lists bans and mutes, newest first
+func listSanctionsCommandExec(m *tgbotapi.Message, store Store, lang Lang, logger *Logger) (reply string, err error) {
+	userName, page, err := parseSlashSanctions(m)
+	if err != nil {
+		reply = tr(lang, "error.format")
+		return
+	}
+	userID := 0
+	if userName != "" {
+		var user *User
+		user, err = store.findUserByName(userName)
+		if err != nil {
+			if err == UserDoesntExist {
+				reply = tr(lang, "user.unknown")
+			} else {
+				reply = tr(lang, "error.db")
+			}
+			return
+		}
+		userID = user.ID
+	}
+	sanctions, err := store.findSanctions(userID, ListPageSize, (page-1)*ListPageSize)
+	if err != nil {
+		logger.Error("Error listing sanctions", "err", err)
+		reply = tr(lang, "error.db")
+		return
+	}
+	if len(sanctions) == 0 {
+		reply = tr(lang, "sanctions.none")
+		return
+	}
+	lines := make([]string, len(sanctions))
+	for ind, sanction := range sanctions {
+		lines[ind] = sanctionLine(store, sanction, lang)
+	}
+	reply = strings.Join(lines, "\n")
+	args := ""
+	if userName != "" {
+		args = "@" + userName
+	}
+	reply += nextPageHint("bans", args, page, len(sanctions), lang)
+	return
+}
+
+func sanctionLine(store Store, sanction *Sanction, lang Lang) string {
+	line := tr(lang, "sanctions.line", sanction.ID, tr(lang, "sanction."+string(sanction.Kind)),
+		storedUserMention(store, sanction.UserID), formatDate(lang, sanction.Date),
+		storedUserMention(store, sanction.ByUserID), sanctionReason(sanction, lang))
+	if !sanction.Until.IsZero() {
+		line += tr(lang, "sanctions.until", formatDate(lang, sanction.Until))
+	}
+	if !sanction.Lifted.IsZero() {
+		line += tr(lang, "sanctions.lifted", storedUserMention(store, sanction.LiftedBy), formatDate(lang, sanction.Lifted))
+	}
+	return line
+}
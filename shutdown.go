@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+func stopWebhook(server *http.Server, timeoutSeconds int) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if err != nil {
+		logger.Error("Error stopping webhook server", "err", err)
+	}
+}
+
+// called once updates are not fetched anymore and all received ones are given to the workers
+func shutdown(store Store, timeoutSeconds int) {
+	logger.Info("Waiting for active handlers")
+	if !updatePool.Stop(time.Duration(timeoutSeconds) * time.Second) {
+		logger.Warn("Handlers didn't finish in time", "timeout_seconds", timeoutSeconds)
+	}
+	workers := updatePool.Stats()
+
+	pending := messagePull.Shutdown()
+
+	deletionScheduler.Stop()
+	chatAdminsSync.Stop()
+	unsent := outbox.Stop(time.Duration(timeoutSeconds) * time.Second)
+	deletions, err := store.countDeletions()
+	if err != nil {
+		logger.Error("Error counting scheduled deletions", "err", err)
+	}
+
+	store.Close()
+
+	// deletions are postponed till the next start, the rest is lost
+	logger.Info("Unfinished work", "updates_in_progress", workers.Active, "updates_not_handled", workers.Queued,
+		"pending_inline_messages", pending, "scheduled_deletions", deletions, "unsent_messages", unsent)
+	logger.Info("Bot stopped")
+}
@@ -2,30 +2,42 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
-	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// creates new SQLStore instance, connects to sqldatabase and creates, if not exists, required tables
-func NewSQLStore(path string) (store *SQLStore, err error) {
-	db, err := sql.Open("sqlite3", path)
+const SQLiteDriver = "sqlite3"
+const PostgresDriver = "postgres"
+
+// creates new SQLStore instance, connects to sqldatabase and migrates its schema to the latest version.
+// source is a file path for sqlite3 and a connection string for postgres
+func NewSQLStore(driver string, source string) (store *SQLStore, err error) {
+	store, err = OpenSQLStore(driver, source)
 	if err != nil {
 		return
 	}
-	store = &SQLStore{db: db, path: path}
-	err = store.createQuestionsTable()
+	err = store.migrate(false)
 	if err != nil {
 		return
 	}
-	err = store.createAnswersTable()
-	if err != nil {
+	return
+}
+
+// connects to sqldatabase without touching its schema
+func OpenSQLStore(driver string, source string) (store *SQLStore, err error) {
+	if driver != SQLiteDriver && driver != PostgresDriver {
+		err = fmt.Errorf("unsupported database driver %q", driver)
 		return
 	}
-	err = store.createUsersTable()
+	db, err := sql.Open(driver, source)
 	if err != nil {
 		return
 	}
+	store = &SQLStore{db: db, path: source, driver: driver}
 	return
 }
 
@@ -33,103 +45,271 @@ func NewSQLStore(path string) (store *SQLStore, err error) {
 func (s *SQLStore) Close() {
 	err := s.db.Close()
 	if err != nil {
-		log.Printf("Error while closing sqlstore: %v", err)
+		logger.Error("Error closing sqlstore", "err", err)
+	}
+}
+
+// queries are written with sqlite "?" placeholders, postgres needs them numbered.
+// "?" inside string literals and quoted identifiers is kept as is
+func (s *SQLStore) rebind(query string) string {
+	if s.driver != PostgresDriver {
+		return query
 	}
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			// a doubled quote closes and reopens the literal, which keeps it quoted
+			if r == quote {
+				quote = 0
+			}
+			b.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			b.WriteRune(r)
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (s *SQLStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.Query(s.rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(s.rebind(query), args...)
+}
+
+func (s *SQLStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
 }
 
-func (s *SQLStore) createQuestionsTable() (err error) {
-	creationQuery := `
-	create table if not exists Questions(
-		id integer primary key,
-		user text,
-		content text,
-		time integer,
-		receiver text,
-		isClosed integer,
-		chatID integer
-	)`
-	_, err = s.db.Exec(creationQuery)
+// executes insert and returns id of the new row. Postgres driver doesn't support LastInsertId
+func (s *SQLStore) insert(tx *sql.Tx, query string, args ...interface{}) (id int, err error) {
+	if s.driver == PostgresDriver {
+		err = tx.QueryRow(s.rebind(query+" RETURNING id"), args...).Scan(&id)
+		return
+	}
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return
+	}
+	id64, err := result.LastInsertId()
+	id = int(id64)
 	if err != nil {
 		return
 	}
 	return
 }
 
-func (s *SQLStore) createAnswersTable() (err error) {
-	creationQuery := `
-	create table if not exists Answers(
-		id integer primary key,
-		user text,
-		content text,
-		time integer,
-		questionID integer
-	)`
-	_, err = s.db.Exec(creationQuery)
+// times are stored as unix seconds and always read back in UTC
+func storedTime(unixTime int64) time.Time {
+	return time.Unix(unixTime, 0).UTC()
+}
+
+// User is identified by telegram id, Name is the username (may be empty) and
+// can change at any time, FullName is used for users without username
+type User struct {
+	ID       int
+	Name     string
+	FullName string
+	ChatID   int64 // personal chat with bot, 0 if the user hasn't started it
+
+	LanguageCode string // language of the user's telegram
+	Lang         Lang   // language chosen with /language, empty to follow LanguageCode
+}
+
+func (u *User) DisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.FullName
+}
+
+// "@username", or the full name as is, it can't be used as a mention
+func (u *User) Mention() string {
+	if u.Name != "" {
+		return "@" + u.Name
+	}
+	return u.FullName
+}
+
+// adds new user or refreshes name and chat of the known one. Questions, answers
+// and notes follow the new display name, rows written before the bot knew the
+// user's id are bound to it by username
+func (s *SQLStore) saveUser(user *User) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	tx, err := s.db.Begin()
 	if err != nil {
 		return
 	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	exec := func(query string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(s.rebind(query), args...)
+	}
+
+	var old User
+	row := tx.QueryRow(s.rebind(`SELECT name, fullName, chatID, languageCode FROM Users WHERE id = ?`), user.ID)
+	err = row.Scan(&old.Name, &old.FullName, &old.ChatID, &old.LanguageCode)
+	if err == sql.ErrNoRows {
+		err = nil
+		exec(`INSERT INTO Users (id, name, fullName, chatID, languageCode) VALUES (?, ?, ?, ?, ?)`,
+			user.ID, user.Name, user.FullName, user.ChatID, user.LanguageCode)
+	} else if err == nil {
+		chatID := user.ChatID
+		if chatID == 0 {
+			chatID = old.ChatID
+		}
+		languageCode := user.LanguageCode
+		if languageCode == "" {
+			languageCode = old.LanguageCode
+		}
+		// lang is the user's own choice and is changed only by setUserLang
+		exec(`UPDATE Users SET name = ?, fullName = ?, chatID = ?, languageCode = ? WHERE id = ?`,
+			user.Name, user.FullName, chatID, languageCode, user.ID)
+		if old.DisplayName() != user.DisplayName() {
+			exec(`UPDATE Questions SET "user" = ? WHERE userID = ?`, user.DisplayName(), user.ID)
+			exec(`UPDATE Questions SET receiver = ? WHERE receiverID = ?`, user.DisplayName(), user.ID)
+			exec(`UPDATE Answers SET "user" = ? WHERE userID = ?`, user.DisplayName(), user.ID)
+			exec(`UPDATE Notes SET "user" = ? WHERE userID = ?`, user.DisplayName(), user.ID)
+		}
+	}
+	if user.Name == "" {
+		return
+	}
+	// usernames are unique, somebody who had this one before has renamed
+	exec(`UPDATE Users SET name = '' WHERE lower(name) = lower(?) AND id != ?`, user.Name, user.ID)
+	exec(`UPDATE Questions SET userID = ? WHERE userID = 0 AND lower("user") = lower(?)`, user.ID, user.Name)
+	exec(`UPDATE Questions SET receiverID = ? WHERE receiverID = 0 AND lower(receiver) = lower(?)`,
+		user.ID, user.Name)
+	exec(`UPDATE Answers SET userID = ? WHERE userID = 0 AND lower("user") = lower(?)`, user.ID, user.Name)
+	exec(`UPDATE Notes SET userID = ? WHERE userID = 0 AND lower("user") = lower(?)`, user.ID, user.Name)
 	return
 }
 
-func (s *SQLStore) createUsersTable() (err error) {
-	creationQuery := `
-	CREATE TABLE IF NOT EXISTS Users(
-	    id integer,
-	    name text primary key,
-	    chatID
-	)`
-	_, err = s.db.Exec(creationQuery)
-	if err != nil {
+func (s *SQLStore) getUser(userID int) (user *User, err error) {
+	user = new(User)
+	row := s.queryRow(`SELECT id, name, fullName, chatID, languageCode, lang FROM Users WHERE id = ?`, userID)
+	err = row.Scan(&user.ID, &user.Name, &user.FullName, &user.ChatID, &user.LanguageCode, &user.Lang)
+	if err == sql.ErrNoRows {
+		err = UserDoesntExist
 		return
 	}
 	return
 }
 
-type User struct {
-	ID     int
-	Name   string
-	ChatID int64
+// usernames are case insensitive in telegram
+func (s *SQLStore) findUserByName(name string) (user *User, err error) {
+	user = new(User)
+	row := s.queryRow(`SELECT id, name, fullName, chatID, languageCode, lang FROM Users
+	                       WHERE name != '' AND lower(name) = lower(?)`, name)
+	err = row.Scan(&user.ID, &user.Name, &user.FullName, &user.ChatID, &user.LanguageCode, &user.Lang)
+	if err == sql.ErrNoRows {
+		err = UserDoesntExist
+		return
+	}
+	return
 }
 
-func (s *SQLStore) addUser(user *User) (err error) {
+// empty lang makes replies follow the user's telegram language again
+func (s *SQLStore) setUserLang(userID int, lang Lang) (err error) {
 	s.Lock()
 	defer s.Unlock()
-	tx, err := s.db.Begin()
-	defer tx.Commit()
-	_, err = tx.Exec(`INSERT INTO Users (id, name, chatID)
-	                VALUES (?, ?, ?)`, user.ID, user.Name, user.ChatID)
+	result, err := s.exec(`UPDATE Users SET lang = ? WHERE id = ?`, string(lang), userID)
+	if err != nil {
+		return
+	}
+	updated, err := result.RowsAffected()
 	if err != nil {
 		return
 	}
+	if updated == 0 {
+		err = UserDoesntExist
+		return
+	}
 	return
 }
 
-func (s *SQLStore) getUserChatID(userName string) (chatID int64, err error) {
-	row := s.db.QueryRow(`SELECT chatID FROM Users
-                                      WHERE name = ?`, userName)
+func (s *SQLStore) getUserChatID(userID int) (chatID int64, err error) {
+	row := s.queryRow(`SELECT chatID FROM Users
+                                      WHERE id = ?`, userID)
 	err = row.Scan(&chatID)
-	if err != nil {
+	if err == sql.ErrNoRows || (err == nil && chatID == 0) {
+		err = UnknownUserChat
 		return
 	}
 	return
 }
 
-func (s *SQLStore) createNotesTable() (err error) {
-	creationQuery := `
-	CREATE TABLE IF NOT EXISTS Notes (
-	    id integer primary key
-	    user text
-	    content text
-	    time integer
-	)`
-	_, err = s.db.Exec(creationQuery)
-	if err != nil {
-		return
+const questionColumns = `id, userID, "user", content, time, receiverID, receiver, isClosed, chatID`
+const answerColumns = `id, userID, "user", content, time, questionID`
+const noteColumns = `id, userID, "user", content, time`
+
+func scanQuestions(rows *sql.Rows) (questions []*Question, err error) {
+	for rows.Next() {
+		var q Question
+		var unixTime int64
+		var recID int64
+		var recName string
+		err = rows.Scan(&q.QuestionID, &q.UserID, &q.User, &q.Text, &unixTime,
+			&recID, &recName, &q.IsClosed, &q.ChatID)
+		if err != nil {
+			return
+		}
+		q.Rec = NewReceiver(recID, recName)
+		q.Date = storedTime(unixTime)
+		questions = append(questions, &q)
+	}
+	return
+}
+
+func scanAnswers(rows *sql.Rows) (answers []*Answer, err error) {
+	for rows.Next() {
+		var a Answer
+		var unixTime int64
+		err = rows.Scan(&a.AnswerID, &a.UserID, &a.User, &a.Text, &unixTime, &a.QuestionID)
+		if err != nil {
+			return
+		}
+		a.Date = storedTime(unixTime)
+		answers = append(answers, &a)
+	}
+	return
+}
+
+func scanNotes(rows *sql.Rows) (notes []*Note, err error) {
+	for rows.Next() {
+		var n Note
+		var unixTime int64
+		err = rows.Scan(&n.NoteID, &n.UserID, &n.User, &n.Text, &unixTime)
+		if err != nil {
+			return
+		}
+		n.Date = storedTime(unixTime)
+		notes = append(notes, &n)
 	}
 	return
 }
 
-func (s *SQLStore) addNote(n *Note) (err error) {
+func (s *SQLStore) addNote(n *Note) (noteID int, err error) {
 	s.Lock()
 	defer s.Unlock()
 	tx, err := s.db.Begin()
@@ -137,37 +317,85 @@ func (s *SQLStore) addNote(n *Note) (err error) {
 		return
 	}
 	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
 		*err = tx.Commit()
 	}(tx, &err)
-	insertQuery, err := tx.Prepare(`
-	    INSERT INTO Notes (user, content, time)
-	    VALUES (?, ?, ?)`)
+	noteID, err = s.insert(tx, `
+	    INSERT INTO Notes (userID, "user", content, time)
+	    VALUES (?, ?, ?, ?)`, n.UserID, n.User, n.Text, n.Date.Unix())
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) getNote(noteID int) (note *Note, err error) {
+	rows, err := s.query(`SELECT `+noteColumns+`
+                                      FROM Notes
+                                          WHERE id = ?`, noteID)
 	if err != nil {
 		return
 	}
-	defer insertQuery.Close()
-	_, err = insertQuery.Exec(n.User, n.Text, n.Date.Unix())
+	defer rows.Close()
+	notes, err := scanNotes(rows)
 	if err != nil {
 		return
 	}
+	if len(notes) == 0 {
+		err = NoteDoesntExist
+		return
+	}
+	note = notes[0]
 	return
 }
 
-func (s *SQLStore) getNote(noteId int) (note *Note, err error) {
-	rows, err := s.db.Query(`SELECT (id, user, content, time)
-                                      FROM Notes
-                                          WHERE id = ?`, noteId)
+func (s *SQLStore) findNotes(limit int, offset int) (notes []*Note, err error) {
+	rows, err := s.query(`SELECT `+noteColumns+`
+                            FROM Notes
+                            ORDER BY time DESC, id DESC
+                            LIMIT ?
+                            OFFSET ?`,
+		limit, offset)
+	if err != nil {
+		return
+	}
 	defer rows.Close()
-	if rows.Next() {
+	notes, err = scanNotes(rows)
+	return
+}
 
-	} else {
-		err = NoteDoesntExist
+func (s *SQLStore) deleteNote(noteID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
+		*err = tx.Commit()
+	}(tx, &err)
+
+	delete_query, err := tx.Prepare(s.rebind("DELETE FROM Notes WHERE id = ?"))
+	if err != nil {
+		return
+	}
+	defer delete_query.Close()
+	_, err = delete_query.Exec(noteID)
+	if err != nil {
+		return
 	}
 	return
 }
 
 func (s *SQLStore) closeQuestion(questionID int) (err error) {
-	_, err = s.db.Exec("UPDATE Questions SET isClosed = 1 WHERE id = ?",
+	_, err = s.exec("UPDATE Questions SET isClosed = 1 WHERE id = ?",
 		questionID)
 	if err != nil {
 		return
@@ -176,7 +404,7 @@ func (s *SQLStore) closeQuestion(questionID int) (err error) {
 }
 
 func (s *SQLStore) openQuestion(questionID int) (err error) {
-	_, err = s.db.Exec("UPDATE Questions SET isClosed = 0 WHERE id = ?",
+	_, err = s.exec("UPDATE Questions SET isClosed = 0 WHERE id = ?",
 		questionID)
 	if err != nil {
 		return
@@ -184,43 +412,36 @@ func (s *SQLStore) openQuestion(questionID int) (err error) {
 	return
 }
 
-func (s *SQLStore) findQuestionsTo(receiver string,
+func (s *SQLStore) findQuestionsTo(receiverID int64,
+	limit int, offset int) (questions []*Question, err error) {
+	questions, err = s.findQuestionsToByState(receiverID, OpenQuestions, limit, offset)
+	return
+}
+
+func (s *SQLStore) findQuestionsToByState(receiverID int64, state QuestionState,
 	limit int, offset int) (questions []*Question, err error) {
 
-	rows, err := s.db.Query(`SELECT id, user, content, time,  receiver, isClosed, chatID
+	rows, err := s.query(`SELECT `+questionColumns+`
                             FROM Questions
-                                WHERE receiver = ? AND isClosed = 0
-                            ORDER BY time DESC
+                                WHERE receiverID = ? AND `+stateCondition(state)+`
+                            ORDER BY time DESC, id DESC
                             LIMIT ?
                             OFFSET ?`,
-		receiver, limit, offset)
+		receiverID, limit, offset)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-
-	for rows.Next() {
-		var q Question
-		var unixTime int64
-		var rec_name string
-		err = rows.Scan(&q.QuestionID, &q.User, &q.Text, &unixTime, &rec_name, &q.IsClosed, &q.ChatID)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		q.Rec = NewReceiver(rec_name)
-		q.Date = time.Unix(unixTime, 0).UTC()
-		questions = append(questions, &q)
-	}
+	questions, err = scanQuestions(rows)
 	return
 }
 
 func (s *SQLStore) findAnswersFor(questionID int,
 	limit int, offset int) (answers []*Answer, err error) {
-	rows, err := s.db.Query(`SELECT id, user, content, time, questionID
+	rows, err := s.query(`SELECT `+answerColumns+`
                                    FROM Answers
                                    WHERE questionID = ?
-                                   ORDER BY time DESC
+                                   ORDER BY time DESC, id DESC
                                    LIMIT ?
                                    OFFSET ?`,
 		questionID, limit, offset)
@@ -228,43 +449,20 @@ func (s *SQLStore) findAnswersFor(questionID int,
 		return
 	}
 	defer rows.Close()
-	for rows.Next() {
-		var a Answer
-		var unixTime int64
-		err = rows.Scan(&a.AnswerID, &a.User, &a.Text, &unixTime, &a.QuestionID)
-		if err != nil {
-			return
-		}
-		log.Println(unixTime)
-		a.Date = time.Unix(unixTime, 0)
-		answers = append(answers, &a)
-	}
+	answers, err = scanAnswers(rows)
 	return
 }
 
-func (s *SQLStore) findAllQuestionsTo(receiver string) (questions []*Question, err error) {
-	rows, err := s.db.Query(`SELECT id, user, content, time,  receiver, isClosed, chatID
+func (s *SQLStore) findAllQuestionsTo(receiverID int64) (questions []*Question, err error) {
+	rows, err := s.query(`SELECT `+questionColumns+`
                             FROM Questions
-                                WHERE receiver = ? AND isClosed = 0
-                            ORDER BY time DESC`, receiver)
+                                WHERE receiverID = ? AND isClosed = 0
+                            ORDER BY time DESC, id DESC`, receiverID)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-
-	for rows.Next() {
-		var q Question
-		var unixTime int64
-		var rec_name string
-		err = rows.Scan(&q.QuestionID, &q.User, &q.Text, &unixTime, &rec_name, &q.IsClosed, &q.ChatID)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		q.Rec = NewReceiver(rec_name)
-		q.Date = time.Unix(unixTime, 0).UTC()
-		questions = append(questions, &q)
-	}
+	questions, err = scanQuestions(rows)
 	return
 }
 
@@ -280,29 +478,22 @@ func (s *SQLStore) addQuestion(q *Question) (questionID int, err error) {
 		return
 	}
 	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
 		*err = tx.Commit()
 	}(tx, &err)
 
-	insertQuery, err := tx.Prepare(`
-	INSERT INTO Questions
-	    (user, content, time, receiver, isClosed, chatID)
-		    VALUES (?, ?, ?, ?, ?, ?)`)
-	if err != nil {
-		log.Println(err)
-		return
+	var isClosed int
+	if q.IsClosed {
+		isClosed = 1
 	}
-	defer insertQuery.Close()
-	if err != nil {
-		return
-	}
-	result, err := insertQuery.Exec(q.User, q.Text, q.Date.Unix(),
-		q.Rec.User, q.IsClosed, q.ChatID)
-	if err != nil {
-		return
-	}
-
-	questionID64, err := result.LastInsertId()
-	questionID = int(questionID64)
+	questionID, err = s.insert(tx, `
+	INSERT INTO Questions
+	    (userID, "user", content, time, receiverID, receiver, isClosed, chatID)
+		    VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, q.UserID, q.User, q.Text, q.Date.Unix(),
+		q.Rec.ID, q.Rec.User, isClosed, q.ChatID)
 	if err != nil {
 		return
 	}
@@ -317,25 +508,17 @@ func (s *SQLStore) addAnswer(a *Answer) (answerID int, err error) {
 		return
 	}
 	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
 		*err = tx.Commit()
 	}(tx, &err)
 
-	insertQuery, err := tx.Prepare(
+	answerID, err = s.insert(tx,
 		`INSERT INTO Answers
-		     (user, content, time, questionID)
-			 VALUES (?, ?, ?, ?)`)
-	if err != nil {
-		return
-	}
-	defer insertQuery.Close()
-
-	result, err := insertQuery.Exec(a.User, a.Text, a.Date.Unix(), a.QuestionID)
-	if err != nil {
-		return
-	}
-
-	answerID64, err := result.LastInsertId()
-	answerID = int(answerID64)
+		     (userID, "user", content, time, questionID)
+			 VALUES (?, ?, ?, ?, ?)`, a.UserID, a.User, a.Text, a.Date.Unix(), a.QuestionID)
 	if err != nil {
 		return
 	}
@@ -350,14 +533,18 @@ func (s *SQLStore) deleteQuestion(questionID int) (err error) {
 		return
 	}
 	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
 		*err = tx.Commit()
 	}(tx, &err)
 
-	delete_query, err := tx.Prepare("DELETE FROM Questions WHERE id = ?")
-	defer delete_query.Close()
+	delete_query, err := tx.Prepare(s.rebind("DELETE FROM Questions WHERE id = ?"))
 	if err != nil {
 		return
 	}
+	defer delete_query.Close()
 	_, err = delete_query.Exec(questionID)
 	if err != nil {
 		return
@@ -373,14 +560,18 @@ func (s *SQLStore) deleteAnswer(answerID int) (err error) {
 		return
 	}
 	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
 		*err = tx.Commit()
 	}(tx, &err)
 
-	delete_query, err := tx.Prepare("DELETE FROM Answers WHERE id = ?")
-	defer delete_query.Close()
+	delete_query, err := tx.Prepare(s.rebind("DELETE FROM Answers WHERE id = ?"))
 	if err != nil {
 		return
 	}
+	defer delete_query.Close()
 	_, err = delete_query.Exec(answerID)
 	if err != nil {
 		return
@@ -389,125 +580,652 @@ func (s *SQLStore) deleteAnswer(answerID int) (err error) {
 }
 
 func (s *SQLStore) findAllAnswersFor(questionID int) (answers []*Answer, err error) {
-	rows, err := s.db.Query(`SELECT id, user, content, time, questionID
+	rows, err := s.query(`SELECT `+answerColumns+`
                                    FROM Answers
                                    WHERE questionID = ?
-                                   ORDER BY time DESC`,
+                                   ORDER BY time DESC, id DESC`,
 		questionID)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	for rows.Next() {
-		var a Answer
-		var unixTime int64
-		err = rows.Scan(&a.AnswerID, &a.User, &a.Text, &unixTime, &a.QuestionID)
-		if err != nil {
-			return
-		}
-		a.Date = time.Unix(unixTime, 0)
-		answers = append(answers, &a)
-	}
+	answers, err = scanAnswers(rows)
 	return
 }
 
 func (s *SQLStore) getQuestion(questionID int) (q *Question, err error) {
-	rows, err := s.db.Query("SELECT id, user, content, time,  receiver, isClosed, chatID FROM Questions WHERE id = ?", questionID)
+	rows, err := s.query(`SELECT `+questionColumns+` FROM Questions WHERE id = ?`, questionID)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	q = new(Question)
-	var unixTime int64
-	var recName string
-	if rows.Next() {
-		err = rows.Scan(&q.QuestionID, &q.User, &q.Text, &unixTime, &recName, &q.IsClosed,
-			&q.ChatID)
-		if err != nil {
-			return
-		}
-	} else {
+	questions, err := scanQuestions(rows)
+	if err != nil {
+		return
+	}
+	if len(questions) == 0 {
 		err = QuestionDoesntExist
 		return
 	}
-	q.Date = time.Unix(unixTime, 0)
-	q.Rec = &Receiver{recName}
+	q = questions[0]
 	return
 }
 
 func (s *SQLStore) getAnswer(answerID int) (a *Answer, err error) {
-	rows, err := s.db.Query("SELECT id, user, content, time, questionID FROM Answers WHERE id = ?", answerID)
+	rows, err := s.query(`SELECT `+answerColumns+` FROM Answers WHERE id = ?`, answerID)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	a = new(Answer)
-	var unixTime int64
-	if rows.Next() {
-		err = rows.Scan(&a.AnswerID, &a.User, &a.Text, &unixTime, &a.QuestionID)
-		if err != nil {
-			return
-		}
-	} else {
+	answers, err := scanAnswers(rows)
+	if err != nil {
+		return
+	}
+	if len(answers) == 0 {
 		err = AnswerDoesntExist
 		return
 	}
-	a.Date = time.Unix(unixTime, 0)
+	a = answers[0]
+	return
+}
+
+// sql condition on Questions.isClosed matching the state
+func stateCondition(state QuestionState) string {
+	switch state {
+	case ClosedQuestions:
+		return "isClosed = 1"
+	case AllQuestions:
+		return "1 = 1"
+	default:
+		return "isClosed = 0"
+	}
+}
+
+func (s *SQLStore) findQuestionsFrom(userID int,
+	limit int, offset int) (questions []*Question, err error) {
+	questions, err = s.findQuestionsFromByState(userID, OpenQuestions, limit, offset)
 	return
 }
 
-func (s *SQLStore) findQuestionsFrom(user string,
+func (s *SQLStore) findQuestionsFromByState(userID int, state QuestionState,
 	limit int, offset int) (questions []*Question, err error) {
 
-	rows, err := s.db.Query(`SELECT id, user, content, time,  receiver, isClosed, chatID
-                            FROM Questions WHERE user = ? AND isClosed = 0
-                            ORDER BY time DESC
+	rows, err := s.query(`SELECT `+questionColumns+`
+                            FROM Questions WHERE userID = ? AND `+stateCondition(state)+`
+                            ORDER BY time DESC, id DESC
                             LIMIT ?
                             OFFSET ?`,
-		user, limit, offset)
+		userID, limit, offset)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
+	questions, err = scanQuestions(rows)
+	return
+}
 
-	for rows.Next() {
-		var q Question
-		var unixTime int64
-		var rec_name string
-		err = rows.Scan(&q.QuestionID, &q.User, &q.Text, &unixTime, &rec_name, &q.IsClosed, &q.ChatID)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		q.Rec = NewReceiver(rec_name)
-		q.Date = time.Unix(unixTime, 0).UTC()
-		questions = append(questions, &q)
+// answers written by user, filtered by state of the answered question
+func (s *SQLStore) findAnswersFrom(userID int, state QuestionState,
+	limit int, offset int) (answers []*Answer, err error) {
+	query := `SELECT ` + answerColumns + `
+                      FROM Answers
+		              WHERE userID = ?`
+	if state != AllQuestions {
+		query += `
+		              AND questionID IN (SELECT id FROM Questions
+		                  WHERE ` + stateCondition(state) + `)`
 	}
+	query += `
+		              ORDER BY time DESC, id DESC
+		              LIMIT ?
+		              OFFSET ?`
+	rows, err := s.query(query, userID, limit, offset)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	answers, err = scanAnswers(rows)
 	return
 }
 
-func (s *SQLStore) getAnswersFor(user string, limit int, offset int) (answers []*Answer, err error) {
-	rows, err := s.db.Query(`SELECT id, user, content, time, questionID
+// answers to questions asked by user
+func (s *SQLStore) getAnswersFor(userID int, limit int, offset int) (answers []*Answer, err error) {
+	rows, err := s.query(`SELECT `+answerColumns+`
                       FROM Answers
 		              WHERE Answers.questionID
 		              IN (SELECT id FROM Questions
-		                  WHERE user = ?)
-		              ORDER BY time DESC
+		                  WHERE userID = ?)
+		              ORDER BY time DESC, id DESC
 		              LIMIT ?
-		              OFFSET ?`, user, limit, offset)
+		              OFFSET ?`, userID, limit, offset)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	for rows.Next() {
-		var answer Answer
-		var date int64
-		err = rows.Scan(&answer.AnswerID, &answer.User, &answer.Text, &date, &answer.QuestionID)
+	answers, err = scanAnswers(rows)
+	return
+}
+
+// admins of a group are kept as comma separated ids
+func joinIDs(ids []int) string {
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = strconv.Itoa(id)
+	}
+	return strings.Join(strIDs, ",")
+}
+
+func splitIDs(s string) (ids []int, err error) {
+	for _, strID := range strings.Split(s, ",") {
+		if strID == "" {
+			continue
+		}
+		var id int
+		id, err = strconv.Atoi(strID)
 		if err != nil {
 			return
 		}
-		answer.Date = time.Unix(date, 0)
-		answers = append(answers, &answer)
+		ids = append(ids, id)
+	}
+	return
+}
+
+func (s *SQLStore) saveGroup(g *Group) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	result, err := s.exec(`UPDATE StudyGroups SET name = ?, notificationChatID = ?, admins = ?, lang = ?
+	                           WHERE chatID = ?`, g.Name, g.NotificationChatID, joinIDs(g.Admins), string(g.Lang), g.ChatID)
+	if err != nil {
+		return
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if updated == 0 {
+		_, err = s.exec(`INSERT INTO StudyGroups (chatID, name, notificationChatID, admins, lang)
+		                     VALUES (?, ?, ?, ?, ?)`, g.ChatID, g.Name, g.NotificationChatID, joinIDs(g.Admins), string(g.Lang))
+		if err != nil {
+			return
+		}
+	}
+	// questions keep the group name as receiver, so a renamed group is renamed there too
+	_, err = s.exec(`UPDATE Questions SET receiver = ? WHERE receiverID = ?`, g.Name, g.ChatID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) queryGroups(query string, args ...interface{}) (groups []*Group, err error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g Group
+		var admins, chatAdmins string
+		err = rows.Scan(&g.ChatID, &g.Name, &g.NotificationChatID, &admins, &g.Lang, &chatAdmins)
+		if err != nil {
+			return
+		}
+		g.Admins, err = splitIDs(admins)
+		if err != nil {
+			return
+		}
+		g.ChatAdmins, err = splitIDs(chatAdmins)
+		if err != nil {
+			return
+		}
+		groups = append(groups, &g)
+	}
+	return
+}
+
+func (s *SQLStore) getGroup(chatID int64) (g *Group, err error) {
+	groups, err := s.queryGroups(`SELECT chatID, name, notificationChatID, admins, lang, chatAdmins
+	                                  FROM StudyGroups WHERE chatID = ?`, chatID)
+	if err != nil {
+		return
+	}
+	if len(groups) == 0 {
+		err = GroupDoesntExist
+		return
+	}
+	g = groups[0]
+	return
+}
+
+func (s *SQLStore) findGroupByName(name string) (g *Group, err error) {
+	groups, err := s.queryGroups(`SELECT chatID, name, notificationChatID, admins, lang, chatAdmins
+	                                  FROM StudyGroups WHERE lower(name) = lower(?)`, name)
+	if err != nil {
+		return
+	}
+	if len(groups) == 0 {
+		err = GroupDoesntExist
+		return
+	}
+	g = groups[0]
+	return
+}
+
+func (s *SQLStore) findGroups() (groups []*Group, err error) {
+	groups, err = s.queryGroups(`SELECT chatID, name, notificationChatID, admins, lang, chatAdmins
+	                                 FROM StudyGroups ORDER BY name`)
+	return
+}
+
+func (s *SQLStore) setGroupChatAdmins(chatID int64, admins []int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.exec(`UPDATE StudyGroups SET chatAdmins = ? WHERE chatID = ?`, joinIDs(admins), chatID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) deleteGroup(chatID int64) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.exec(`DELETE FROM StudyGroups WHERE chatID = ?`, chatID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// RoleMember for users without a role in the chat
+func (s *SQLStore) getRole(userID int, chatID int64) (role Role, err error) {
+	var name string
+	row := s.queryRow(`SELECT role FROM UserRoles WHERE userID = ? AND chatID = ?`, userID, chatID)
+	err = row.Scan(&name)
+	if err == sql.ErrNoRows {
+		role, err = RoleMember, nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	role, err = parseRole(name)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// RoleMember removes the role
+func (s *SQLStore) setRole(userID int, chatID int64, role Role) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if role == RoleMember {
+		_, err = s.exec(`DELETE FROM UserRoles WHERE userID = ? AND chatID = ?`, userID, chatID)
+		return
+	}
+	result, err := s.exec(`UPDATE UserRoles SET role = ? WHERE userID = ? AND chatID = ?`,
+		role.String(), userID, chatID)
+	if err != nil {
+		return
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if updated == 0 {
+		_, err = s.exec(`INSERT INTO UserRoles (userID, chatID, role) VALUES (?, ?, ?)`,
+			userID, chatID, role.String())
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *SQLStore) findRoles() (roles []*UserRole, err error) {
+	rows, err := s.query(`SELECT userID, chatID, role FROM UserRoles ORDER BY chatID, userID`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r UserRole
+		var name string
+		err = rows.Scan(&r.UserID, &r.ChatID, &name)
+		if err != nil {
+			return
+		}
+		r.Role, err = parseRole(name)
+		if err != nil {
+			return
+		}
+		roles = append(roles, &r)
+	}
+	return
+}
+
+// unix time of t, 0 for the zero time
+func optionalUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func optionalStoredTime(unixTime int64) time.Time {
+	if unixTime == 0 {
+		return time.Time{}
+	}
+	return storedTime(unixTime)
+}
+
+func (s *SQLStore) addSanction(sanction *Sanction) (sanctionID int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
+		*err = tx.Commit()
+	}(tx, &err)
+	sanctionID, err = s.insert(tx, `
+	    INSERT INTO Sanctions (userID, kind, reason, byUserID, time, until)
+	    VALUES (?, ?, ?, ?, ?, ?)`, sanction.UserID, string(sanction.Kind), sanction.Reason,
+		sanction.ByUserID, sanction.Date.Unix(), optionalUnix(sanction.Until))
+	if err != nil {
+		return
+	}
+	return
+}
+
+const sanctionColumns = `id, userID, kind, reason, byUserID, time, until, liftedBy, liftedTime, notified`
+
+func (s *SQLStore) querySanctions(query string, args ...interface{}) (sanctions []*Sanction, err error) {
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sanction Sanction
+		var date, until, lifted int64
+		err = rows.Scan(&sanction.ID, &sanction.UserID, &sanction.Kind, &sanction.Reason, &sanction.ByUserID,
+			&date, &until, &sanction.LiftedBy, &lifted, &sanction.Notified)
+		if err != nil {
+			return
+		}
+		sanction.Date = storedTime(date)
+		sanction.Until = optionalStoredTime(until)
+		sanction.Lifted = optionalStoredTime(lifted)
+		sanctions = append(sanctions, &sanction)
+	}
+	return
+}
+
+func (s *SQLStore) findActiveSanctions(userID int, now time.Time) (sanctions []*Sanction, err error) {
+	sanctions, err = s.querySanctions(`SELECT `+sanctionColumns+` FROM Sanctions
+	                                       WHERE userID = ? AND liftedTime = 0 AND (until = 0 OR until > ?)
+	                                           ORDER BY id`, userID, now.Unix())
+	return
+}
+
+func (s *SQLStore) findSanctions(userID int, limit int, offset int) (sanctions []*Sanction, err error) {
+	if userID == 0 {
+		sanctions, err = s.querySanctions(`SELECT `+sanctionColumns+` FROM Sanctions
+		                                       ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+		return
+	}
+	sanctions, err = s.querySanctions(`SELECT `+sanctionColumns+` FROM Sanctions WHERE userID = ?
+	                                       ORDER BY id DESC LIMIT ? OFFSET ?`, userID, limit, offset)
+	return
+}
+
+// lifts active sanctions of the user
+func (s *SQLStore) liftSanctions(userID int, liftedBy int, now time.Time) (lifted int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	result, err := s.exec(`UPDATE Sanctions SET liftedBy = ?, liftedTime = ?
+	                           WHERE userID = ? AND liftedTime = 0 AND (until = 0 OR until > ?)`,
+		liftedBy, now.Unix(), userID, now.Unix())
+	if err != nil {
+		return
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	lifted = int(count)
+	return
+}
+
+func (s *SQLStore) markSanctionNotified(sanctionID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.exec(`UPDATE Sanctions SET notified = 1 WHERE id = ?`, sanctionID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) addDeletion(d *ScheduledDeletion) (deletionID int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
+		*err = tx.Commit()
+	}(tx, &err)
+	deletionID, err = s.insert(tx, `
+	    INSERT INTO ScheduledDeletions (chatID, messageID, due, attempts)
+	    VALUES (?, ?, ?, ?)`, d.ChatID, d.MessageID, d.Due.Unix(), d.Attempts)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) findDueDeletions(now time.Time, limit int) (deletions []*ScheduledDeletion, err error) {
+	rows, err := s.query(`SELECT id, chatID, messageID, due, attempts
+	                          FROM ScheduledDeletions
+	                              WHERE due <= ? ORDER BY due, id LIMIT ?`, now.Unix(), limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d ScheduledDeletion
+		var due int64
+		err = rows.Scan(&d.ID, &d.ChatID, &d.MessageID, &due, &d.Attempts)
+		if err != nil {
+			return
+		}
+		d.Due = storedTime(due)
+		deletions = append(deletions, &d)
+	}
+	return
+}
+
+func (s *SQLStore) rescheduleDeletion(deletionID int, due time.Time, attempts int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.exec(`UPDATE ScheduledDeletions SET due = ?, attempts = ? WHERE id = ?`,
+		due.Unix(), attempts, deletionID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) deleteDeletion(deletionID int) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.exec(`DELETE FROM ScheduledDeletions WHERE id = ?`, deletionID)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) countDeletions() (count int, err error) {
+	err = s.queryRow(`SELECT count(*) FROM ScheduledDeletions`).Scan(&count)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) savePending(m *TempMessage) (err error) {
+	kind, data, err := encodePending(m.Message)
+	if err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
+		*err = tx.Commit()
+	}(tx, &err)
+	_, err = tx.Exec(s.rebind(`DELETE FROM PendingMessages WHERE tag = ?`), m.Tag)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec(s.rebind(`INSERT INTO PendingMessages (tag, kind, data, time)
+	                               VALUES (?, ?, ?, ?)`), m.Tag, kind, data, m.Time)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) getPending(tag string) (m *TempMessage, err error) {
+	var kind, data string
+	m = &TempMessage{Tag: tag}
+	err = s.queryRow(`SELECT kind, data, time FROM PendingMessages WHERE tag = ?`,
+		tag).Scan(&kind, &data, &m.Time)
+	if err == sql.ErrNoRows {
+		err = PendingDoesntExist
+		return
+	}
+	if err != nil {
+		return
+	}
+	m.Message, err = decodePending(kind, data)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// the row is deleted in the same transaction, a concurrent take finds nothing to delete
+func (s *SQLStore) takePending(tag string) (m *TempMessage, err error) {
+	s.Lock()
+	defer s.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer func(tx *sql.Tx, err *error) {
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
+		*err = tx.Commit()
+	}(tx, &err)
+	var kind, data string
+	m = &TempMessage{Tag: tag}
+	err = tx.QueryRow(s.rebind(`SELECT kind, data, time FROM PendingMessages WHERE tag = ?`),
+		tag).Scan(&kind, &data, &m.Time)
+	if err == sql.ErrNoRows {
+		err = PendingDoesntExist
+		return
+	}
+	if err != nil {
+		return
+	}
+	result, err := tx.Exec(s.rebind(`DELETE FROM PendingMessages WHERE tag = ?`), tag)
+	if err != nil {
+		return
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if deleted == 0 {
+		err = PendingDoesntExist
+		return
+	}
+	m.Message, err = decodePending(kind, data)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) deletePending(tag string) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.exec(`DELETE FROM PendingMessages WHERE tag = ?`, tag)
+	if err != nil {
+		return
+	}
+	return
+}
+
+func (s *SQLStore) deleteExpiredPending(before int64) (count int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	result, err := s.exec(`DELETE FROM PendingMessages WHERE time < ?`, before)
+	if err != nil {
+		return
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	count = int(deleted)
+	return
+}
+
+func (s *SQLStore) evictPending(keep int) (count int, err error) {
+	s.Lock()
+	defer s.Unlock()
+	result, err := s.exec(`DELETE FROM PendingMessages WHERE tag NOT IN (
+	                           SELECT tag FROM PendingMessages ORDER BY time DESC, tag LIMIT ?)`, keep)
+	if err != nil {
+		return
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	count = int(deleted)
+	return
+}
+
+func (s *SQLStore) countPending() (count int, err error) {
+	err = s.queryRow(`SELECT count(*) FROM PendingMessages`).Scan(&count)
+	if err != nil {
+		return
 	}
 	return
 }
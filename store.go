@@ -0,0 +1,82 @@
+package main
+
+import "time"
+
+// Store is everything handlers need from the storage of questions, answers, users,
+// groups, roles, sanctions, notes, scheduled deletions of bot messages and unconfirmed inline messages.
+// SQLStore implements it for sqlite3 and postgres, MemoryStore keeps data in memory only
+type Store interface {
+	PendingStore
+
+	addQuestion(q *Question) (questionID int, err error)
+	getQuestion(questionID int) (q *Question, err error)
+	deleteQuestion(questionID int) (err error)
+	closeQuestion(questionID int) (err error)
+	openQuestion(questionID int) (err error)
+	findQuestionsTo(receiverID int64, limit int, offset int) (questions []*Question, err error)
+	findQuestionsToByState(receiverID int64, state QuestionState,
+		limit int, offset int) (questions []*Question, err error)
+	findAllQuestionsTo(receiverID int64) (questions []*Question, err error)
+	findQuestionsFrom(userID int, limit int, offset int) (questions []*Question, err error)
+	findQuestionsFromByState(userID int, state QuestionState,
+		limit int, offset int) (questions []*Question, err error)
+
+	addAnswer(a *Answer) (answerID int, err error)
+	getAnswer(answerID int) (a *Answer, err error)
+	deleteAnswer(answerID int) (err error)
+	findAnswersFor(questionID int, limit int, offset int) (answers []*Answer, err error)
+	findAllAnswersFor(questionID int) (answers []*Answer, err error)
+	getAnswersFor(userID int, limit int, offset int) (answers []*Answer, err error)
+	findAnswersFrom(userID int, state QuestionState, limit int, offset int) (answers []*Answer, err error)
+
+	saveUser(user *User) (err error)
+	getUser(userID int) (user *User, err error)
+	findUserByName(name string) (user *User, err error)
+	getUserChatID(userID int) (chatID int64, err error)
+	setUserLang(userID int, lang Lang) (err error)
+
+	saveGroup(g *Group) (err error)
+	getGroup(chatID int64) (g *Group, err error)
+	findGroupByName(name string) (g *Group, err error)
+	findGroups() (groups []*Group, err error)
+	deleteGroup(chatID int64) (err error)
+	// saveGroup keeps ChatAdmins, they are changed only here
+	setGroupChatAdmins(chatID int64, admins []int) (err error)
+
+	getRole(userID int, chatID int64) (role Role, err error)
+	setRole(userID int, chatID int64, role Role) (err error)
+	findRoles() (roles []*UserRole, err error)
+
+	addSanction(s *Sanction) (sanctionID int, err error)
+	findActiveSanctions(userID int, now time.Time) (sanctions []*Sanction, err error)
+	// newest first, userID 0 for sanctions of all users
+	findSanctions(userID int, limit int, offset int) (sanctions []*Sanction, err error)
+	liftSanctions(userID int, liftedBy int, now time.Time) (lifted int, err error)
+	markSanctionNotified(sanctionID int) (err error)
+
+	addDeletion(d *ScheduledDeletion) (deletionID int, err error)
+	findDueDeletions(now time.Time, limit int) (deletions []*ScheduledDeletion, err error)
+	rescheduleDeletion(deletionID int, due time.Time, attempts int) (err error)
+	deleteDeletion(deletionID int) (err error)
+	countDeletions() (count int, err error)
+
+	addNote(n *Note) (noteID int, err error)
+	getNote(noteID int) (note *Note, err error)
+	findNotes(limit int, offset int) (notes []*Note, err error)
+	deleteNote(noteID int) (err error)
+
+	Close()
+}
+
+// opens the store selected in config
+func NewStore(config *AppConfig) (store Store, err error) {
+	if config.DBDriver == MemoryDriver {
+		store = NewMemoryStore()
+		return
+	}
+	store, err = NewSQLStore(config.DBDriver, config.DBSource)
+	if err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// storeFactory opens an empty store for one test case
+type storeFactory struct {
+	name string
+	open func(t *testing.T) Store
+}
+
+var storeFactories = []storeFactory{
+	{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+	{"sqlite", openSQLiteTestStore},
+}
+
+var sqliteTestStores int
+
+// every case gets its own in-memory database, it lives while the store keeps a connection
+func openSQLiteTestStore(t *testing.T) Store {
+	sqliteTestStores++
+	source := fmt.Sprintf("file:store%d?mode=memory&cache=shared", sqliteTestStores)
+	store, err := NewSQLStore(SQLiteDriver, source)
+	if err != nil {
+		t.Fatalf("can't open sqlite store: %v", err)
+	}
+	store.db.SetMaxIdleConns(1)
+	return store
+}
+
+// the suite runs against postgres only when a database for it is given
+const postgresTestDSNEnv = "FBBBOT_TEST_POSTGRES_DSN"
+
+func init() {
+	if os.Getenv(postgresTestDSNEnv) != "" {
+		storeFactories = append(storeFactories, storeFactory{"postgres", openPostgresTestStore})
+	}
+}
+
+// cases share the database, every case starts with empty tables
+func openPostgresTestStore(t *testing.T) Store {
+	store, err := NewSQLStore(PostgresDriver, os.Getenv(postgresTestDSNEnv))
+	if err != nil {
+		t.Fatalf("can't open postgres store: %v", err)
+	}
+	_, err = store.exec(`TRUNCATE Questions, Answers, Users, Notes, StudyGroups, ScheduledDeletions,
+	                         PendingMessages, UserRoles, Sanctions RESTART IDENTITY`)
+	if err != nil {
+		store.Close()
+		t.Fatalf("can't clear postgres tables: %v", err)
+	}
+	return store
+}
+
+func TestRebind(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT id FROM Users WHERE id = ?`, `SELECT id FROM Users WHERE id = $1`},
+		{`UPDATE Users SET name = ? WHERE id = ?`, `UPDATE Users SET name = $1 WHERE id = $2`},
+		{`SELECT id FROM Notes WHERE content = '?' AND id = ?`, `SELECT id FROM Notes WHERE content = '?' AND id = $1`},
+		{`SELECT id FROM Notes WHERE content = 'it''s ?' AND id = ?`, `SELECT id FROM Notes WHERE content = 'it''s ?' AND id = $1`},
+		{`SELECT "who?" FROM Notes WHERE id = ?`, `SELECT "who?" FROM Notes WHERE id = $1`},
+		{`UPDATE Questions SET "user" = ? WHERE userID = ?`, `UPDATE Questions SET "user" = $1 WHERE userID = $2`},
+	}
+	postgres := &SQLStore{driver: PostgresDriver}
+	sqlite := &SQLStore{driver: SQLiteDriver}
+	for _, c := range cases {
+		if got := postgres.rebind(c.query); got != c.want {
+			t.Errorf("rebind(%q) = %q, want %q", c.query, got, c.want)
+		}
+		if got := sqlite.rebind(c.query); got != c.query {
+			t.Errorf("sqlite rebind(%q) = %q, want it unchanged", c.query, got)
+		}
+	}
+}
+
+// cases of the conformance suite, every store must pass all of them
+var storeCases = []struct {
+	name string
+	run  func(t *testing.T, store Store)
+}{
+	{"questions are newest first", testQuestionOrder},
+	{"questions are filtered by isClosed", testQuestionStates},
+	{"questions are paged", testQuestionPages},
+	{"answers are ordered and filtered", testAnswers},
+	{"notes are ordered and paged", testNotes},
+	{"missing rows", testMissingRows},
+	{"deleted notes and answers are gone", testDeletes},
+	{"pending messages are taken once", testTakePending},
+	{"pending messages expire and are evicted", testExpirePending},
+	{"users are renamed and bound by username", testUsers},
+	{"roles are set and listed", testRoles},
+	{"sanctions are found and lifted", testSanctions},
+	{"deletions are due in order", testDeletions},
+	{"group chat admins are kept by saveGroup", testGroupChatAdmins},
+}
+
+func TestStoreConformance(t *testing.T) {
+	for _, factory := range storeFactories {
+		for _, c := range storeCases {
+			t.Run(factory.name+"/"+c.name, func(t *testing.T) {
+				store := factory.open(t)
+				defer store.Close()
+				c.run(t, store)
+			})
+		}
+	}
+}
+
+var testTime = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+const (
+	testAsker    = 101
+	testReceiver = 202
+	testAnswerer = 303
+)
+
+func addTestQuestion(t *testing.T, store Store, text string, date time.Time) (questionID int) {
+	questionID, err := store.addQuestion(&Question{
+		UserID: testAsker,
+		User:   "asker",
+		Text:   text,
+		Date:   date,
+		Rec:    NewReceiver(testReceiver, "receiver"),
+		ChatID: testAsker,
+	})
+	if err != nil {
+		t.Fatalf("addQuestion(%q): %v", text, err)
+	}
+	return
+}
+
+func addTestAnswer(t *testing.T, store Store, questionID int, text string, date time.Time) (answerID int) {
+	answerID, err := store.addAnswer(&Answer{
+		UserID:     testAnswerer,
+		User:       "answerer",
+		Text:       text,
+		Date:       date,
+		QuestionID: questionID,
+	})
+	if err != nil {
+		t.Fatalf("addAnswer(%q): %v", text, err)
+	}
+	return
+}
+
+func questionIDs(questions []*Question) (ids []int) {
+	for _, q := range questions {
+		ids = append(ids, q.QuestionID)
+	}
+	return
+}
+
+func answerIDs(answers []*Answer) (ids []int) {
+	for _, a := range answers {
+		ids = append(ids, a.AnswerID)
+	}
+	return
+}
+
+func noteIDs(notes []*Note) (ids []int) {
+	for _, n := range notes {
+		ids = append(ids, n.NoteID)
+	}
+	return
+}
+
+func expectIDs(t *testing.T, what string, got []int, want ...int) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s: got ids %v, want %v", what, got, want)
+	}
+}
+
+// stores return dates in UTC whatever the local time zone is
+func expectUTC(t *testing.T, what string, date time.Time) {
+	t.Helper()
+	if date.Location() != time.UTC {
+		t.Errorf("%s: date %v is in %v, want UTC", what, date, date.Location())
+	}
+}
+
+func expectErr(t *testing.T, what string, got error, want error) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s: got error %v, want %v", what, got, want)
+	}
+}
+
+func testQuestionOrder(t *testing.T, store Store) {
+	first := addTestQuestion(t, store, "first", testTime)
+	second := addTestQuestion(t, store, "second", testTime.Add(time.Minute))
+	// same time as the second one, the later id goes first
+	third := addTestQuestion(t, store, "third", testTime.Add(time.Minute))
+
+	questions, err := store.findQuestionsTo(testReceiver, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findQuestionsTo", questionIDs(questions), third, second, first)
+	questions, err = store.findAllQuestionsTo(testReceiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findAllQuestionsTo", questionIDs(questions), third, second, first)
+	questions, err = store.findQuestionsFrom(testAsker, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findQuestionsFrom", questionIDs(questions), third, second, first)
+
+	q, err := store.getQuestion(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Text != "second" || q.UserID != testAsker || q.Rec.ID != testReceiver || !q.Date.Equal(testTime.Add(time.Minute)) {
+		t.Errorf("getQuestion: got %+v", q)
+	}
+	expectUTC(t, "getQuestion", q.Date)
+	for ind := 1; ind < len(questions); ind++ {
+		if questions[ind].Date.After(questions[ind-1].Date) {
+			t.Errorf("findQuestionsFrom: %v goes after %v", questions[ind].Date, questions[ind-1].Date)
+		}
+	}
+}
+
+func testQuestionStates(t *testing.T, store Store) {
+	open := addTestQuestion(t, store, "open", testTime)
+	closed := addTestQuestion(t, store, "closed", testTime.Add(time.Minute))
+	reopened := addTestQuestion(t, store, "reopened", testTime.Add(2*time.Minute))
+	for _, id := range []int{closed, reopened} {
+		if err := store.closeQuestion(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.openQuestion(reopened); err != nil {
+		t.Fatal(err)
+	}
+
+	states := []struct {
+		state QuestionState
+		want  []int
+	}{
+		{OpenQuestions, []int{reopened, open}},
+		{ClosedQuestions, []int{closed}},
+		{AllQuestions, []int{reopened, closed, open}},
+	}
+	for _, s := range states {
+		questions, err := store.findQuestionsToByState(testReceiver, s.state, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, fmt.Sprintf("findQuestionsToByState(%d)", s.state), questionIDs(questions), s.want...)
+		questions, err = store.findQuestionsFromByState(testAsker, s.state, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, fmt.Sprintf("findQuestionsFromByState(%d)", s.state), questionIDs(questions), s.want...)
+	}
+	questions, err := store.findQuestionsTo(testReceiver, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findQuestionsTo", questionIDs(questions), reopened, open)
+	q, err := store.getQuestion(closed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.IsClosed {
+		t.Errorf("getQuestion: question %d is not closed", closed)
+	}
+}
+
+func testQuestionPages(t *testing.T, store Store) {
+	var ids []int
+	for ind := 0; ind < 5; ind++ {
+		ids = append(ids, addTestQuestion(t, store, fmt.Sprintf("question %d", ind), testTime.Add(time.Duration(ind)*time.Minute)))
+	}
+	pages := []struct {
+		limit  int
+		offset int
+		want   []int
+	}{
+		{2, 0, []int{ids[4], ids[3]}},
+		{2, 2, []int{ids[2], ids[1]}},
+		{2, 4, []int{ids[0]}},
+		{2, 5, nil},
+		{10, 0, []int{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+	}
+	for _, p := range pages {
+		questions, err := store.findQuestionsTo(testReceiver, p.limit, p.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, fmt.Sprintf("findQuestionsTo limit %d offset %d", p.limit, p.offset),
+			questionIDs(questions), p.want...)
+		questions, err = store.findQuestionsFromByState(testAsker, AllQuestions, p.limit, p.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, fmt.Sprintf("findQuestionsFromByState limit %d offset %d", p.limit, p.offset),
+			questionIDs(questions), p.want...)
+	}
+}
+
+func testAnswers(t *testing.T, store Store) {
+	open := addTestQuestion(t, store, "open", testTime)
+	closed := addTestQuestion(t, store, "closed", testTime)
+	if err := store.closeQuestion(closed); err != nil {
+		t.Fatal(err)
+	}
+	first := addTestAnswer(t, store, open, "first", testTime)
+	second := addTestAnswer(t, store, open, "second", testTime.Add(time.Minute))
+	third := addTestAnswer(t, store, open, "third", testTime.Add(time.Minute))
+	toClosed := addTestAnswer(t, store, closed, "to closed", testTime)
+
+	answers, err := store.findAnswersFor(open, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findAnswersFor", answerIDs(answers), third, second, first)
+	answers, err = store.findAnswersFor(open, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findAnswersFor limit 2 offset 1", answerIDs(answers), second, first)
+	answers, err = store.findAllAnswersFor(open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findAllAnswersFor", answerIDs(answers), third, second, first)
+	for ind, a := range answers {
+		expectUTC(t, "findAllAnswersFor", a.Date)
+		if ind > 0 && a.Date.After(answers[ind-1].Date) {
+			t.Errorf("findAllAnswersFor: %v goes after %v", a.Date, answers[ind-1].Date)
+		}
+	}
+	answers, err = store.getAnswersFor(testAsker, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "getAnswersFor", answerIDs(answers), third, second, toClosed, first)
+
+	states := []struct {
+		state QuestionState
+		want  []int
+	}{
+		{OpenQuestions, []int{third, second, first}},
+		{ClosedQuestions, []int{toClosed}},
+		{AllQuestions, []int{third, second, toClosed, first}},
+	}
+	for _, s := range states {
+		answers, err = store.findAnswersFrom(testAnswerer, s.state, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, fmt.Sprintf("findAnswersFrom(%d)", s.state), answerIDs(answers), s.want...)
+	}
+}
+
+func testNotes(t *testing.T, store Store) {
+	var ids []int
+	for ind, date := range []time.Time{testTime, testTime.Add(time.Minute), testTime.Add(time.Minute)} {
+		id, err := store.addNote(&Note{UserID: testAsker, User: "asker", Text: fmt.Sprintf("note %d", ind), Date: date})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	pages := []struct {
+		limit  int
+		offset int
+		want   []int
+	}{
+		{10, 0, []int{ids[2], ids[1], ids[0]}},
+		{1, 1, []int{ids[1]}},
+		{2, 2, []int{ids[0]}},
+		{2, 3, nil},
+	}
+	for _, p := range pages {
+		notes, err := store.findNotes(p.limit, p.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, fmt.Sprintf("findNotes limit %d offset %d", p.limit, p.offset), noteIDs(notes), p.want...)
+	}
+	note, err := store.getNote(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Text != "note 0" || note.UserID != testAsker || !note.Date.Equal(testTime) {
+		t.Errorf("getNote: got %+v", note)
+	}
+	expectUTC(t, "getNote", note.Date)
+}
+
+func testMissingRows(t *testing.T, store Store) {
+	_, err := store.getGroup(-100)
+	expectErr(t, "getGroup", err, GroupDoesntExist)
+	_, err = store.findGroupByName("nobody")
+	expectErr(t, "findGroupByName", err, GroupDoesntExist)
+	_, err = store.getUser(testAsker)
+	expectErr(t, "getUser", err, UserDoesntExist)
+	_, err = store.findUserByName("nobody")
+	expectErr(t, "findUserByName", err, UserDoesntExist)
+	err = store.setUserLang(testAsker, LangEn)
+	expectErr(t, "setUserLang", err, UserDoesntExist)
+	_, err = store.getUserChatID(testAsker)
+	expectErr(t, "getUserChatID", err, UnknownUserChat)
+	_, err = store.getQuestion(1)
+	expectErr(t, "getQuestion", err, QuestionDoesntExist)
+	_, err = store.getAnswer(1)
+	expectErr(t, "getAnswer", err, AnswerDoesntExist)
+	_, err = store.getNote(1)
+	expectErr(t, "getNote", err, NoteDoesntExist)
+
+	// a group which was deleted is missing as well
+	err = store.saveGroup(&Group{ChatID: -100, Name: "group"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.deleteGroup(-100); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.getGroup(-100)
+	expectErr(t, "getGroup after deleteGroup", err, GroupDoesntExist)
+}
+
+func testDeletes(t *testing.T, store Store) {
+	kept, err := store.addNote(&Note{UserID: testAsker, User: "asker", Text: "kept", Date: testTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := store.addNote(&Note{UserID: testAsker, User: "asker", Text: "deleted", Date: testTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.deleteNote(deleted); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.getNote(deleted)
+	expectErr(t, "getNote after deleteNote", err, NoteDoesntExist)
+	notes, err := store.findNotes(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findNotes after deleteNote", noteIDs(notes), kept)
+
+	questionID := addTestQuestion(t, store, "question", testTime)
+	keptAnswer := addTestAnswer(t, store, questionID, "kept", testTime)
+	deletedAnswer := addTestAnswer(t, store, questionID, "deleted", testTime)
+	if err = store.deleteAnswer(deletedAnswer); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.getAnswer(deletedAnswer)
+	expectErr(t, "getAnswer after deleteAnswer", err, AnswerDoesntExist)
+	answers, err := store.findAnswersFor(questionID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findAnswersFor after deleteAnswer", answerIDs(answers), keptAnswer)
+
+	// deleting a row twice is not an error
+	if err = store.deleteNote(deleted); err != nil {
+		t.Errorf("deleteNote of a deleted note: %v", err)
+	}
+	if err = store.deleteAnswer(deletedAnswer); err != nil {
+		t.Errorf("deleteAnswer of a deleted answer: %v", err)
+	}
+}
+
+func testTakePending(t *testing.T, store Store) {
+	question := &Question{UserID: testAsker, User: "asker", Text: "question", Date: testTime,
+		Rec: NewReceiver(testReceiver, "receiver")}
+	m := &TempMessage{Message: question, Tag: question.GetHash(), Time: testTime.Unix()}
+	if err := store.savePending(m); err != nil {
+		t.Fatal(err)
+	}
+	taken, err := store.takePending(m.Tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q, ok := taken.Message.(*Question); !ok || q.Text != "question" || q.Rec.ID != testReceiver {
+		t.Errorf("takePending: got %+v", taken.Message)
+	}
+	_, err = store.takePending(m.Tag)
+	expectErr(t, "second takePending", err, PendingDoesntExist)
+	_, err = store.getPending(m.Tag)
+	expectErr(t, "getPending after takePending", err, PendingDoesntExist)
+}
+
+func savePendingQuestion(t *testing.T, store Store, tag string, unixTime int64) {
+	question := &Question{UserID: testAsker, User: "asker", Text: tag, Date: testTime,
+		Rec: NewReceiver(testReceiver, "receiver")}
+	if err := store.savePending(&TempMessage{Message: question, Tag: tag, Time: unixTime}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectPending(t *testing.T, store Store, what string, tags map[string]bool) {
+	t.Helper()
+	for tag, kept := range tags {
+		_, err := store.getPending(tag)
+		if kept && err != nil {
+			t.Errorf("%s: getPending(%q): %v", what, tag, err)
+		}
+		if !kept && err != PendingDoesntExist {
+			t.Errorf("%s: getPending(%q) got error %v, want %v", what, tag, err, PendingDoesntExist)
+		}
+	}
+}
+
+func testExpirePending(t *testing.T, store Store) {
+	now := testTime.Unix()
+	savePendingQuestion(t, store, "old", now-100)
+	savePendingQuestion(t, store, "b", now-10)
+	savePendingQuestion(t, store, "a", now-10)
+	savePendingQuestion(t, store, "new", now)
+
+	count, err := store.deleteExpiredPending(now - 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("deleteExpiredPending: deleted %d, want 1", count)
+	}
+	expectPending(t, store, "deleteExpiredPending", map[string]bool{"old": false, "a": true, "b": true, "new": true})
+
+	// the newest are kept, of messages with the same time the first tags are
+	count, err = store.evictPending(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("evictPending: deleted %d, want 1", count)
+	}
+	expectPending(t, store, "evictPending", map[string]bool{"a": true, "b": false, "new": true})
+	count, err = store.evictPending(2)
+	if err != nil || count != 0 {
+		t.Errorf("evictPending of a store within the limit: deleted %d, %v", count, err)
+	}
+	count, err = store.countPending()
+	if err != nil || count != 2 {
+		t.Errorf("countPending: got %d, %v, want 2", count, err)
+	}
+}
+
+func testUsers(t *testing.T, store Store) {
+	// written before the bot knew the answerer, only the username was kept
+	questionID := addTestQuestion(t, store, "question", testTime)
+	answerID, err := store.addAnswer(&Answer{UserID: UnknownUserID, User: "Answerer_Name",
+		Text: "answer", Date: testTime, QuestionID: questionID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.saveUser(&User{ID: testAsker, FullName: "Asker Person", ChatID: testAsker, LanguageCode: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.saveUser(&User{ID: testAnswerer, Name: "answerer_name", FullName: "Answerer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := store.getAnswer(answerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.UserID != testAnswerer {
+		t.Errorf("answer of a username is bound to user %d, want %d", a.UserID, testAnswerer)
+	}
+
+	// a rename without chat and language keeps the known ones
+	if err = store.setUserLang(testAsker, LangRu); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.saveUser(&User{ID: testAsker, Name: "asker_name", FullName: "Asker Person"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.getUser(testAsker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "asker_name" || user.ChatID != testAsker || user.LanguageCode != "en" || user.Lang != LangRu {
+		t.Errorf("getUser after rename: got %+v", user)
+	}
+	q, err := store.getQuestion(questionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.User != "asker_name" {
+		t.Errorf("question of a renamed user has author %q, want %q", q.User, "asker_name")
+	}
+	chatID, err := store.getUserChatID(testAsker)
+	if err != nil || chatID != testAsker {
+		t.Errorf("getUserChatID: got %d, %v, want %d", chatID, err, testAsker)
+	}
+
+	// usernames are case insensitive and belong to one user at a time
+	user, err = store.findUserByName("ASKER_NAME")
+	if err != nil || user.ID != testAsker {
+		t.Errorf("findUserByName: got %+v, %v", user, err)
+	}
+	if err = store.saveUser(&User{ID: testReceiver, Name: "Asker_Name"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err = store.findUserByName("asker_name")
+	if err != nil || user.ID != testReceiver {
+		t.Errorf("findUserByName of a taken username: got %+v, %v", user, err)
+	}
+	user, err = store.getUser(testAsker)
+	if err != nil || user.Name != "" {
+		t.Errorf("getUser of a user who lost the username: got %+v, %v", user, err)
+	}
+}
+
+func testRoles(t *testing.T, store Store) {
+	role, err := store.getRole(testAsker, -100)
+	if err != nil || role != RoleMember {
+		t.Errorf("getRole without a role: got %v, %v, want %v", role, err, RoleMember)
+	}
+	roles := []struct {
+		userID int
+		chatID int64
+		role   Role
+	}{
+		{testAnswerer, -100, RoleModerator},
+		{testAsker, -100, RoleModerator},
+		{testAsker, 0, RoleAdmin},
+		{testReceiver, -200, RoleBanned},
+		// replaces the moderator
+		{testAsker, -100, RoleAdmin},
+	}
+	for _, r := range roles {
+		if err = store.setRole(r.userID, r.chatID, r.role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	role, err = store.getRole(testAsker, -100)
+	if err != nil || role != RoleAdmin {
+		t.Errorf("getRole: got %v, %v, want %v", role, err, RoleAdmin)
+	}
+
+	// RoleMember removes the role
+	if err = store.setRole(testAnswerer, -100, RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	found, err := store.findRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range found {
+		got = append(got, fmt.Sprintf("%d/%d/%v", r.UserID, r.ChatID, r.Role))
+	}
+	want := []string{
+		fmt.Sprintf("%d/-200/%v", testReceiver, RoleBanned),
+		fmt.Sprintf("%d/-100/%v", testAsker, RoleAdmin),
+		fmt.Sprintf("%d/0/%v", testAsker, RoleAdmin),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("findRoles: got %v, want %v", got, want)
+	}
+}
+
+func testSanctions(t *testing.T, store Store) {
+	add := func(userID int, kind SanctionKind, until time.Time) (sanctionID int) {
+		sanctionID, err := store.addSanction(&Sanction{UserID: userID, Kind: kind, Reason: "reason",
+			ByUserID: testAnswerer, Date: testTime, Until: until})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	ban := add(testAsker, SanctionBan, time.Time{})
+	expired := add(testAsker, SanctionMute, testTime.Add(time.Minute))
+	mute := add(testAsker, SanctionMute, testTime.Add(time.Hour))
+	other := add(testReceiver, SanctionBan, time.Time{})
+
+	now := testTime.Add(2 * time.Minute)
+	active, err := store.findActiveSanctions(testAsker, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, s := range active {
+		ids = append(ids, s.ID)
+		expectUTC(t, "findActiveSanctions", s.Date)
+	}
+	expectIDs(t, "findActiveSanctions", ids, ban, mute)
+	if len(active) == 2 {
+		if active[0].Kind != SanctionBan || !active[0].Until.IsZero() || active[0].Reason != "reason" {
+			t.Errorf("findActiveSanctions: got ban %+v", active[0])
+		}
+		if !active[1].Until.Equal(testTime.Add(time.Hour)) {
+			t.Errorf("findActiveSanctions: mute until %v, want %v", active[1].Until, testTime.Add(time.Hour))
+		}
+		expectUTC(t, "findActiveSanctions until", active[1].Until)
+	}
+
+	// newest first
+	all, err := store.findSanctions(0, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = nil
+	for _, s := range all {
+		ids = append(ids, s.ID)
+	}
+	expectIDs(t, "findSanctions of all users", ids, other, mute, expired, ban)
+	page, err := store.findSanctions(testAsker, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = nil
+	for _, s := range page {
+		ids = append(ids, s.ID)
+	}
+	expectIDs(t, "findSanctions limit 2 offset 1", ids, expired, ban)
+
+	if err = store.markSanctionNotified(ban); err != nil {
+		t.Fatal(err)
+	}
+	lifted, err := store.liftSanctions(testAsker, testReceiver, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifted != 2 {
+		t.Errorf("liftSanctions: lifted %d, want 2", lifted)
+	}
+	active, err = store.findActiveSanctions(testAsker, now)
+	if err != nil || len(active) != 0 {
+		t.Errorf("findActiveSanctions after liftSanctions: got %d, %v", len(active), err)
+	}
+	all, err = store.findSanctions(testAsker, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range all {
+		if s.ID == ban && (!s.Notified || s.LiftedBy != testReceiver || !s.Lifted.Equal(now)) {
+			t.Errorf("findSanctions: got lifted ban %+v", s)
+		}
+		if s.ID == expired && !s.Lifted.IsZero() {
+			t.Errorf("findSanctions: expired mute is lifted %+v", s)
+		}
+	}
+}
+
+func testDeletions(t *testing.T, store Store) {
+	var ids []int
+	for ind, due := range []time.Time{testTime.Add(time.Minute), testTime, testTime, testTime.Add(time.Hour)} {
+		id, err := store.addDeletion(&ScheduledDeletion{ChatID: -100, MessageID: ind + 1, Due: due})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	deletionIDs := func(deletions []*ScheduledDeletion) (ids []int) {
+		for _, d := range deletions {
+			ids = append(ids, d.ID)
+			expectUTC(t, "findDueDeletions", d.Due)
+		}
+		return
+	}
+
+	// the earliest first, the same due by id
+	due, err := store.findDueDeletions(testTime.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findDueDeletions", deletionIDs(due), ids[1], ids[2], ids[0])
+	due, err = store.findDueDeletions(testTime.Add(time.Minute), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findDueDeletions limit 2", deletionIDs(due), ids[1], ids[2])
+	if len(due) > 0 && (due[0].ChatID != -100 || due[0].MessageID != 2) {
+		t.Errorf("findDueDeletions: got %+v", due[0])
+	}
+
+	if err = store.rescheduleDeletion(ids[1], testTime.Add(2*time.Minute), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.deleteDeletion(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	due, err = store.findDueDeletions(testTime.Add(2*time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "findDueDeletions after changes", deletionIDs(due), ids[0], ids[1])
+	if len(due) == 2 && due[1].Attempts != 1 {
+		t.Errorf("findDueDeletions: rescheduled deletion has %d attempts, want 1", due[1].Attempts)
+	}
+	count, err := store.countDeletions()
+	if err != nil || count != 3 {
+		t.Errorf("countDeletions: got %d, %v, want 3", count, err)
+	}
+}
+
+func testGroupChatAdmins(t *testing.T, store Store) {
+	group := &Group{ChatID: -100, Name: "group", Admins: []int{testAsker}}
+	if err := store.saveGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.setGroupChatAdmins(-100, []int{testAnswerer, testReceiver}); err != nil {
+		t.Fatal(err)
+	}
+	// saving the group again doesn't touch its chat admins
+	group.Name = "renamed"
+	if err := store.saveGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	g, err := store.getGroup(-100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Name != "renamed" || fmt.Sprint(g.Admins) != fmt.Sprint([]int{testAsker}) ||
+		fmt.Sprint(g.ChatAdmins) != fmt.Sprint([]int{testAnswerer, testReceiver}) {
+		t.Errorf("getGroup: got %+v", g)
+	}
+	if err = store.setGroupChatAdmins(-100, nil); err != nil {
+		t.Fatal(err)
+	}
+	g, err = store.findGroupByName("renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.ChatAdmins) != 0 {
+		t.Errorf("findGroupByName: chat admins are %v after they were cleared", g.ChatAdmins)
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"database/sql"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,7 +14,10 @@ type Message interface {
 	GetHash() string
 }
 
+// User fields of questions, answers and notes are display names kept for output,
+// UserID is the telegram id of the author and is used for everything else
 type Question struct {
+	UserID     int
 	User       string
 	Text       string
 	Date       time.Time
@@ -23,11 +28,17 @@ type Question struct {
 	QuestionID int
 }
 
+// the same text to another receiver is another question
 func (q *Question) GetHash() string {
-	return GetMD5Hash(q.Text + "|" + q.User)
+	receiver := ""
+	if q.Rec != nil {
+		receiver = strconv.FormatInt(q.Rec.ID, 10) + "|" + strings.ToLower(q.Rec.User)
+	}
+	return GetMD5Hash(q.Text + "|" + strconv.Itoa(q.UserID) + "|" + receiver)
 }
 
 type Answer struct {
+	UserID     int
 	User       string
 	Text       string
 	Date       time.Time
@@ -36,37 +47,191 @@ type Answer struct {
 }
 
 func (a *Answer) GetHash() string {
-	return GetMD5Hash(a.Text + "|" + a.User)
+	return GetMD5Hash(a.Text + "|" + strconv.Itoa(a.UserID) + "|" + strconv.Itoa(a.QuestionID))
 }
 
+// QuestionState selects questions (or answers to them) by whether the question is closed
+type QuestionState int
+
+const (
+	OpenQuestions QuestionState = iota
+	ClosedQuestions
+	AllQuestions
+)
+
+// Receiver is either a user (ID is a telegram user id) or a group (ID is its chat id).
+// ID is UnknownUserID for users, which the bot hasn't met yet
 type Receiver struct {
+	ID   int64
 	User string
 }
 
-func NewReceiver(user string) *Receiver {
-	return &Receiver{user}
+func NewReceiver(id int64, user string) *Receiver {
+	return &Receiver{ID: id, User: user}
+}
+
+func NewGroupReceiver(g *Group) *Receiver {
+	return &Receiver{ID: g.ChatID, User: g.Name}
+}
+
+func (r *Receiver) IsGroup() bool {
+	return r.ID < 0
+}
+
+// Group is a study group chat with its own pool of questions
+type Group struct {
+	ChatID             int64
+	Name               string
+	Admins             []int // telegram ids of group admins, in addition to AppConfig.Admins
+	ChatAdmins         []int // administrators of the group's telegram chat, kept in sync with telegram
+	NotificationChatID int64 // where notifications about group questions go, 0 for the group chat itself
+	Lang               Lang  // default language of the group chat, empty for DefaultLang
+}
+
+func (g *Group) NotificationChat() int64 {
+	if g.NotificationChatID != 0 {
+		return g.NotificationChatID
+	}
+	return g.ChatID
+}
+
+func (g *Group) IsAdmin(userID int) bool {
+	for _, id := range g.Admins {
+		if id == userID {
+			return true
+		}
+	}
+	for _, id := range g.ChatAdmins {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// ScheduledDeletion is a bot message, which should be deleted at Due
+type ScheduledDeletion struct {
+	ID        int
+	ChatID    int64
+	MessageID int
+	Due       time.Time
+	Attempts  int // failed attempts so far
+}
+
+// SanctionKind is what a sanction forbids: a ban any use of the bot,
+// a mute new questions, answers and notes
+type SanctionKind string
+
+const (
+	SanctionBan  SanctionKind = "ban"
+	SanctionMute SanctionKind = "mute"
+)
+
+// Sanction is a ban or a mute of a user in all chats of the bot. Until is zero
+// for sanctions without end, Lifted is zero unless LiftedBy lifted it earlier
+type Sanction struct {
+	ID       int
+	UserID   int
+	Kind     SanctionKind
+	Reason   string
+	ByUserID int
+	Date     time.Time
+	Until    time.Time
+	LiftedBy int
+	Lifted   time.Time
+	Notified bool // the user got the reply about it
+}
+
+func (s *Sanction) ActiveAt(now time.Time) bool {
+	return s.Lifted.IsZero() && (s.Until.IsZero() || now.Before(s.Until))
 }
 
 type SQLStore struct {
-	db   *sql.DB
-	path string
+	db     *sql.DB
+	path   string
+	driver string
 	sync.Mutex
 }
 
 type Note struct {
 	NoteID int
+	UserID int
 	User   string
 	Text   string
 	Date   time.Time
 }
 
 type AppConfig struct {
-	TelegramBotToken          string
-	Admins                    []string
+	TelegramBotToken string
+	Admins           []int // telegram ids of owners of the bot, they have every permission
+	AdminLogChatID   int64 // chat for reports to admins, like changes of reloaded config
+	Groups           []*Group
+	DefaultGroup     string // name of the group used when a command doesn't choose one
+	DBDriver         string // "sqlite3" (default), "postgres" or "memory"
+	// sqlite file path or postgres connection string. Bots sharing one postgres
+	// database keep their tables apart with search_path=<schema> in the connection string
+	DBSource                  string
 	ErrorsTimeToDelete        int
 	CommandsTimeToDelete      int
 	InlineAnswersTimeToDelete int
 	NotificationsTimeToDelete int
+	Webhook                   *WebhookSettings // nil for long polling
+	ShutdownTimeout           int              // seconds to wait for active handlers on exit
+	Workers                   int              // updates handled at once
+	WorkerQueueSize           int              // updates waiting for each worker before receiving stops
+	// "debug", "info" (default), "warn" or "error", texts of users are logged only at debug.
+	// Lines are "logfmt" (default) or "json"
+	LogLevel  string
+	LogFormat string
+	// seconds between reads of groups' telegram administrators,
+	// 0 to follow only updates about chat members
+	AdminSyncInterval int
+	// unconfirmed inline questions and answers are kept in the main store ("store",
+	// default) or only in memory ("memory") for PendingTTL seconds, at most PendingLimit of them.
+	// Expired ones are removed every PendingCleanInterval seconds
+	PendingStore         string
+	PendingTTL           int
+	PendingLimit         int
+	PendingCleanInterval int
+	// key of callback data signatures, derived from TelegramBotToken if empty.
+	// Buttons older than CallbackTTL seconds are rejected
+	CallbackSecret string
+	CallbackTTL    int
+	// budgets of users and of group chats, admins are not limited
+	RateLimits RateLimitSettings
+	// usernames from Admins of old config files, resolveAdminNames moves
+	// them to Admins as ids once the bot knows the users
+	AdminNames []string `json:"-"`
+}
+
+// WebhookSettings make the bot receive updates through its own http server
+type WebhookSettings struct {
+	URL         string // public address telegram posts updates to, e.g. https://example.org:8443/bot
+	ListenAddr  string // address of the local server, e.g. ":8443"
+	Path        string // path updates are accepted on, "/" by default
+	SecretToken string // required, sent back by telegram in X-Telegram-Bot-Api-Secret-Token
+	// with both set the server speaks https itself, the certificate is also
+	// uploaded to telegram, so it may be self-signed
+	CertFile string
+	KeyFile  string
+	// don't call setWebhook, for local runs fed with recorded updates
+	SkipRegistration bool
+}
+
+// RateLimitSettings are token buckets for updates. Writes add questions, answers
+// and notes, reads are the other commands, inline queries and buttons
+type RateLimitSettings struct {
+	UserWrites RateBudget
+	UserReads  RateBudget
+	ChatWrites RateBudget // of all users in a group chat together
+	ChatReads  RateBudget
+}
+
+// RateBudget lets through Burst updates at once and PerMinute updates a minute after that,
+// PerMinute 0 turns the limit off
+type RateBudget struct {
+	PerMinute int
+	Burst     int
 }
 
 type TempMessage struct {
@@ -75,13 +240,14 @@ type TempMessage struct {
 	Time    int64
 }
 
+// MessagePull keeps inline questions and answers until their author confirms them
 type MessagePull struct {
-	sync.Mutex
+	sync.Mutex    // serializes adding with eviction
+	store         PendingStore
 	cleanInterval int
-	storeTime     int
-	messages      chan *TempMessage
+	storeTime     int // seconds unconfirmed message is kept
+	maxSize       int // the oldest messages are evicted above it, 0 for no limit
+	logger        *Logger
 	stop          chan struct{}
-	get           chan string
-	outMessages   chan Message
-	delete chan string // delete message immediately
+	done          chan struct{}
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// updates waiting longer than this for a worker are logged
+const slowUpdateWait = 5 * time.Second
+
+// UpdatePool handles updates with a fixed number of workers. Updates of one user
+// (or one chat for updates without a user) always go to the same worker, so they
+// are handled in the order they came. When the queue of a worker is full, submit
+// waits, and updates stay with telegram until there is room
+type UpdatePool struct {
+	bot      *tgbotapi.BotAPI
+	store    Store
+	queues   []chan queuedUpdate
+	handlers sync.WaitGroup
+	queued   int64 // updates waiting for a worker
+	active   int64 // updates being handled
+
+	statsLock sync.Mutex
+	handled   int
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+type queuedUpdate struct {
+	update   Update
+	received time.Time
+}
+
+// UpdatePoolStats are numbers of the pool, waits are from receiving an update to starting its handling
+type UpdatePoolStats struct {
+	Workers int
+	Queued  int
+	Active  int
+	Handled int
+	AvgWait time.Duration
+	MaxWait time.Duration
+}
+
+var updatePool *UpdatePool
+
+func NewUpdatePool(bot *tgbotapi.BotAPI, store Store, workers int, queueSize int) (p *UpdatePool) {
+	p = &UpdatePool{bot: bot, store: store, queues: make([]chan queuedUpdate, workers)}
+	for ind := range p.queues {
+		p.queues[ind] = make(chan queuedUpdate, queueSize)
+	}
+	return
+}
+
+func (p *UpdatePool) init() {
+	for ind := range p.queues {
+		p.handlers.Add(1)
+		go p.worker(ind)
+	}
+}
+
+// queues the update to the worker of its user, waits while the queue is full
+func (p *UpdatePool) submit(update Update) {
+	ind := int(uint64(updateKey(&update)) % uint64(len(p.queues)))
+	atomic.AddInt64(&p.queued, 1)
+	queued := queuedUpdate{update: update, received: time.Now()}
+	select {
+	case p.queues[ind] <- queued:
+	default:
+		logger.Warn("Queue of the worker is full, waiting", "worker", ind, "update_id", update.UpdateID)
+		p.queues[ind] <- queued
+	}
+}
+
+// user of the update or, for updates without one, its chat
+func updateKey(update *Update) int64 {
+	switch {
+	case update.MyChatMember != nil:
+		return update.MyChatMember.Chat.ID
+	case update.ChatMember != nil:
+		return update.ChatMember.Chat.ID
+	case update.CallbackQuery != nil:
+		return int64(update.CallbackQuery.From.ID)
+	case update.InlineQuery != nil:
+		return int64(update.InlineQuery.From.ID)
+	case update.Message != nil && update.Message.From != nil:
+		return int64(update.Message.From.ID)
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	}
+	return 0
+}
+
+func (p *UpdatePool) worker(ind int) {
+	defer p.handlers.Done()
+	for queued := range p.queues[ind] {
+		atomic.AddInt64(&p.queued, -1)
+		p.recordWait(queued.update.UpdateID, time.Since(queued.received))
+		atomic.AddInt64(&p.active, 1)
+		p.handle(&queued.update)
+		atomic.AddInt64(&p.active, -1)
+	}
+}
+
+func (p *UpdatePool) handle(update *Update) {
+	// the update is handled with the config current when it's taken,
+	// a reload meanwhile applies to the next updates
+	processUpdate(p.bot, update, p.store, currentConfig())
+}
+
+func (p *UpdatePool) recordWait(updateID int, wait time.Duration) {
+	if wait >= slowUpdateWait {
+		logger.Warn("Update waited for a worker", "update_id", updateID, "wait", wait)
+	}
+	p.statsLock.Lock()
+	defer p.statsLock.Unlock()
+	p.handled++
+	p.totalWait += wait
+	if wait > p.maxWait {
+		p.maxWait = wait
+	}
+}
+
+func (p *UpdatePool) Stats() (stats UpdatePoolStats) {
+	p.statsLock.Lock()
+	defer p.statsLock.Unlock()
+	stats = UpdatePoolStats{
+		Workers: len(p.queues),
+		Queued:  int(atomic.LoadInt64(&p.queued)),
+		Active:  int(atomic.LoadInt64(&p.active)),
+		Handled: p.handled,
+		MaxWait: p.maxWait,
+	}
+	if p.handled > 0 {
+		stats.AvgWait = p.totalWait / time.Duration(p.handled)
+	}
+	return
+}
+
+// takes no more updates and waits for the queued ones, reports whether they were handled in time.
+// Updates must not be submitted after it
+func (p *UpdatePool) Stop(timeout time.Duration) (finished bool) {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	done := make(chan struct{})
+	go func() {
+		p.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		finished = true
+	case <-time.After(timeout):
+	}
+	return
+}
+
+// "/workers" shows how busy the workers are and how long updates wait for them
+func workersCommandExec(m *tgbotapi.Message, store Store, lang Lang) (reply string, err error) {
+	stats := updatePool.Stats()
+	reply = tr(lang, "workers.stats", stats.Workers, stats.Active, stats.Queued, stats.Handled,
+		stats.AvgWait.Round(time.Millisecond), stats.MaxWait.Round(time.Millisecond))
+	return
+}
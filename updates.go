@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Update is tgbotapi.Update with kinds of updates the library doesn't know
+type Update struct {
+	tgbotapi.Update
+	MyChatMember *ChatMemberUpdated `json:"my_chat_member"` // status of the bot itself changed
+	ChatMember   *ChatMemberUpdated `json:"chat_member"`
+}
+
+type UpdatesChannel <-chan Update
+
+// ChatMemberUpdated of the bot api
+type ChatMemberUpdated struct {
+	Chat          tgbotapi.Chat       `json:"chat"`
+	From          tgbotapi.User       `json:"from"`
+	Date          int                 `json:"date"`
+	OldChatMember tgbotapi.ChatMember `json:"old_chat_member"`
+	NewChatMember tgbotapi.ChatMember `json:"new_chat_member"`
+}
+
+// telegram sends chat_member updates only when they are asked for
+var allowedUpdates = []string{"message", "inline_query", "callback_query", "my_chat_member", "chat_member"}
+
+func allowedUpdatesParam() string {
+	data, _ := json.Marshal(allowedUpdates)
+	return string(data)
+}
+
+const pollingRetryDelay = 3 * time.Second
+
+// getUpdates of the library can't ask for allowed updates, nor be cancelled
+func getUpdates(ctx context.Context, bot *tgbotapi.BotAPI, offset int, timeout int) (updates []Update, err error) {
+	v := url.Values{}
+	if offset != 0 {
+		v.Add("offset", strconv.Itoa(offset))
+	}
+	v.Add("timeout", strconv.Itoa(timeout))
+	v.Add("allowed_updates", allowedUpdatesParam())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf(tgbotapi.APIEndpoint, bot.Token, "getUpdates"), strings.NewReader(v.Encode()))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := bot.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var apiResp tgbotapi.APIResponse
+	err = json.NewDecoder(resp.Body).Decode(&apiResp)
+	if err != nil {
+		return
+	}
+	if !apiResp.Ok {
+		parameters := tgbotapi.ResponseParameters{}
+		if apiResp.Parameters != nil {
+			parameters = *apiResp.Parameters
+		}
+		err = tgbotapi.Error{Message: apiResp.Description, ResponseParameters: parameters}
+		return
+	}
+	err = json.Unmarshal(apiResp.Result, &updates)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// long polls getUpdates till stop is called. Telegram takes an update as delivered
+// when a later getUpdates skips it, so only updates given to the channel are skipped.
+// stop cancels the poll being made, acknowledges the given updates and closes the channel
+func pollUpdates(bot *tgbotapi.BotAPI, timeout int) (updates UpdatesChannel, stop func()) {
+	ch := make(chan Update, bot.Buffer)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(ch)
+		offset := 0
+		defer func() {
+			if offset == 0 {
+				return
+			}
+			// updates received but not given out are sent again on the next start
+			_, err := getUpdates(context.Background(), bot, offset, 0)
+			if err != nil {
+				logger.Error("Error acknowledging updates", "offset", offset, "err", err)
+			}
+		}()
+		for ctx.Err() == nil {
+			received, err := getUpdates(ctx, bot, offset, timeout)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.Warn("Error getting updates, retrying", "retry_in", pollingRetryDelay, "err", err)
+				select {
+				case <-time.After(pollingRetryDelay):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			for _, update := range received {
+				if update.UpdateID < offset {
+					continue
+				}
+				select {
+				case ch <- update:
+					offset = update.UpdateID + 1
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	updates = ch
+	stop = func() {
+		cancel()
+		<-done
+	}
+	return
+}
@@ -4,35 +4,38 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"github.com/go-telegram-bot-api/telegram-bot-api"
-	"log"
-	"time"
+	"regexp"
+	"strings"
 )
 
-func inGroup(userList []string, user string) (flag bool) {
-	for _, value := range userList {
-		if value == user {
-			flag = true
-			return
-		}
+var userNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{4,31}$`)
+
+// username without "@" or, for users without it, their full name
+func userDisplayName(u *tgbotapi.User) string {
+	if u.UserName != "" {
+		return strings.Replace(u.UserName, "@", "", -1)
 	}
-	flag = false
-	return
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
 }
 
-func messageDeleter(bot *tgbotapi.BotAPI, config tgbotapi.DeleteMessageConfig, waitTime int) {
-	time.Sleep(time.Second * time.Duration(waitTime))
-
-	log.Printf("Deleting message %d from chat %d", config.MessageID, config.ChatID)
-	_, err := bot.DeleteMessage(config)
+// mention of the author of a question, answer or note. Only the known user
+// tells if the stored display name is a username, otherwise it's shown as is
+func authorMention(store Store, userID int, name string) string {
+	user, err := store.getUser(userID)
 	if err != nil {
-		log.Println(err)
-		return
+		return name
 	}
+	return user.Mention()
 }
 
-func formatDate(d time.Time) (s string) {
-	s = d.Local().Format(dateFormat)
-	return
+// text cut to maxLength characters with "..." at the end, runes are counted
+// so cyrillic letters are not cut in half
+func shortText(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	return string(runes[:maxLength]) + "..."
 }
 
 func GetMD5Hash(text string) string {
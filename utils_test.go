@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShortText(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"short", "short"},
+		{strings.Repeat("a", 64), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 65), strings.Repeat("a", 64) + "..."},
+		{strings.Repeat("я", 65), strings.Repeat("я", 64) + "..."},
+	}
+	for _, test := range tests {
+		if got := shortText(test.text, 64); got != test.want {
+			t.Errorf("shortText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
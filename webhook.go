@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// telegram accepts 1-256 characters A-Z, a-z, 0-9, _ and -
+var secretTokenFormat = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+func validateWebhookSettings(w *WebhookSettings) (err error) {
+	if w.ListenAddr == "" {
+		err = errors.New("webhook: ListenAddr is required")
+		return
+	}
+	if w.URL == "" && !w.SkipRegistration {
+		err = errors.New("webhook: URL is required to register the webhook")
+		return
+	}
+	// without the token anyone who finds the address can post updates
+	if w.SecretToken == "" {
+		err = errors.New("webhook: SecretToken is required")
+		return
+	}
+	if !secretTokenFormat.MatchString(w.SecretToken) {
+		err = errors.New("webhook: SecretToken must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+		return
+	}
+	if (w.CertFile == "") != (w.KeyFile == "") {
+		err = errors.New("webhook: CertFile and KeyFile must be set together")
+		return
+	}
+	if w.Path == "" {
+		w.Path = "/"
+	}
+	return
+}
+
+// handler for updates posted by telegram, they are passed to updates.
+// Requests without the configured secret token are rejected
+func newWebhookHandler(secretToken string, updates chan<- Update, logger *Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.Header.Get(secretTokenHeader)
+		if secretToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secretToken)) != 1 {
+			logger.Warn("Rejected webhook request with a wrong secret token", "remote_addr", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var update Update
+		err := json.NewDecoder(r.Body).Decode(&update)
+		if err != nil {
+			logger.Warn("Error decoding webhook update", "remote_addr", r.RemoteAddr, "err", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		updates <- update
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// setWebhook of the library can't pass secret_token and allowed_updates
+func registerWebhook(bot *tgbotapi.BotAPI, w *WebhookSettings) (err error) {
+	if w.CertFile != "" {
+		params := map[string]string{"url": w.URL, "allowed_updates": allowedUpdatesParam(),
+			"secret_token": w.SecretToken}
+		_, err = bot.UploadFile("setWebhook", params, "certificate", w.CertFile)
+		if err != nil {
+			return
+		}
+		return
+	}
+	v := url.Values{}
+	v.Add("url", w.URL)
+	v.Add("allowed_updates", allowedUpdatesParam())
+	v.Add("secret_token", w.SecretToken)
+	_, err = bot.MakeRequest("setWebhook", v)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// registers the webhook and starts the server, updates come to the returned channel
+func startWebhook(bot *tgbotapi.BotAPI, w *WebhookSettings, logger *Logger) (updates UpdatesChannel,
+	server *http.Server, err error) {
+	logger = logger.With("component", "webhook")
+	err = validateWebhookSettings(w)
+	if err != nil {
+		return
+	}
+	if !w.SkipRegistration {
+		err = registerWebhook(bot, w)
+		if err != nil {
+			return
+		}
+		logger.Info("Webhook registered", "url", w.URL)
+	}
+
+	ch := make(chan Update, bot.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(w.Path, newWebhookHandler(w.SecretToken, ch, logger))
+	server = &http.Server{Addr: w.ListenAddr, Handler: mux}
+
+	go func() {
+		var serveErr error
+		if w.CertFile != "" {
+			serveErr = server.ListenAndServeTLS(w.CertFile, w.KeyFile)
+		} else {
+			serveErr = server.ListenAndServe()
+		}
+		if serveErr != http.ErrServerClosed {
+			logger.Fatal("Webhook server failed", "err", serveErr)
+		}
+	}()
+	logger.Info("Listening for webhook updates", "addr", w.ListenAddr, "path", w.Path)
+	updates = ch
+	return
+}